@@ -0,0 +1,233 @@
+package client
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/codingpa-ws/foxbox/internal/archive"
+	"github.com/codingpa-ws/foxbox/internal/fsdiff"
+	"github.com/codingpa-ws/foxbox/internal/security"
+)
+
+const boxFSEnv = "FOXBOX_BOXFS"
+
+func init() {
+	if _, ok := os.LookupEnv(boxFSEnv); ok {
+		err := boxFSHelper()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+}
+
+// An operation on the file system of a box, see runBoxFS.
+type boxFSOp struct {
+	// Writes a tar archive of the file system to stdout, or
+	// with Path, one of the file at Path named Name
+	Archive bool
+	// Extracts a tar archive of a single file from stdin to Path,
+	// see archive.ExtractAt
+	Extract bool
+	Path    string
+	Name    string
+	// Writes the changes to the directory at Base as JSON,
+	// or as image layer if Layer is set, see fsdiff
+	Diff  bool
+	Base  string
+	Layer bool
+	// Leaves out files foxbox creates when running the box
+	// with the given name and volume paths, see runtimeFile.
+	SkipRuntime bool
+	Box         string
+	Volumes     []string
+}
+
+// Files created by foxbox when running a box.
+var runtimeFiles = []string{
+	"dev/null", "dev/zero", "dev/full", "dev/tty", "dev/random", "dev/urandom",
+	"dev/stdin", "dev/stdout", "dev/stderr", "dev/fd",
+}
+
+// Runs op on the file system of a box. File systems of copy boxes and
+// running boxes are accessed from here, while the overlay of a stopped
+// box is mounted by a helper process in its own user and mount namespace.
+func (client *client) runBoxFS(name string, op boxFSOp, stdin io.Reader, stdout io.Writer) error {
+	entry, err := client.store.GetEntry(name)
+	if err != nil {
+		return err
+	}
+	name = entry.Name()
+	config, err := getBoxConfig(entry)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("reading box config: %w", err)
+	}
+	op.Box = name
+	if config.Run != nil {
+		for _, volume := range config.Run.Volumes {
+			op.Volumes = append(op.Volumes, volume.BoxPath)
+		}
+	}
+
+	pid, running, err := entry.GetPID()
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("getting box pid: %w", err)
+	}
+	if running {
+		// Overlays and volumes are only mounted in the box’s mount
+		// namespace. The trailing slash makes walking the file system
+		// follow the symlink to it.
+		return op.run(filepath.Join("/proc", strconv.Itoa(pid), "root")+"/", stdin, stdout)
+	}
+	overlay, err := boxOverlayOptions(entry)
+	if err != nil {
+		return err
+	}
+	if overlay == "" {
+		return op.run(entry.FileSystem(), stdin, stdout)
+	}
+
+	encoded, err := encodeBoxFSOp(op)
+	if err != nil {
+		return err
+	}
+	executable, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("finding foxbox executable: %w", err)
+	}
+	uid, gid, err := security.GetUserIdentifiers()
+	if err != nil {
+		return err
+	}
+	stderr := new(strings.Builder)
+	cmd := exec.Command(executable)
+	cmd.Dir = entry.FileSystem()
+	cmd.Env = []string{boxFSEnv + "=" + encoded, "FOXBOX_OVERLAY=" + overlay}
+	cmd.Stdin = stdin
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Cloneflags:  syscall.CLONE_NEWUSER | syscall.CLONE_NEWNS,
+		UidMappings: []syscall.SysProcIDMap{{ContainerID: 0, HostID: int(uid), Size: 1}},
+		GidMappings: []syscall.SysProcIDMap{{ContainerID: 0, HostID: int(gid), Size: 1}},
+	}
+	err = cmd.Run()
+	if err != nil {
+		return fmt.Errorf("mounting box file system: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+// Runs in the helper process started by runBoxFS.
+func boxFSHelper() error {
+	op, err := decodeBoxFSOp()
+	if err != nil {
+		return err
+	}
+	err = mountOverlay()
+	if err != nil {
+		return err
+	}
+	return op.run(".", os.Stdin, os.Stdout)
+}
+
+func (self boxFSOp) run(root string, stdin io.Reader, stdout io.Writer) error {
+	var skip func(path, name string) bool
+	if self.SkipRuntime {
+		skip = self.runtimeFile
+	}
+	switch {
+	case self.Diff:
+		changes, err := fsdiff.DiffFiltered(self.Base, root, func(path, name string) bool {
+			// Mount points in running boxes
+			return name == "proc" || name == "tmp" || (skip != nil && skip(path, name))
+		})
+		if err != nil {
+			return err
+		}
+		if self.Layer {
+			return fsdiff.WriteLayer(stdout, root, changes)
+		}
+		return json.NewEncoder(stdout).Encode(changes)
+	case self.Extract:
+		return archive.ExtractAt(stdin, root, self.Path)
+	case self.Archive && self.Path != "":
+		return archive.CreateAt(stdout, root, self.Path, self.Name)
+	case self.Archive:
+		return archive.CreateFiltered(stdout, root, skip)
+	}
+	return nil
+}
+
+// Reports whether the file is created by foxbox when running the
+// box: the contents of /proc, /tmp and volumes, device files,
+// the generated resolv.conf and hostname.
+func (self boxFSOp) runtimeFile(path, name string) bool {
+	switch {
+	case strings.HasPrefix(name, "proc/"), strings.HasPrefix(name, "tmp/"):
+		return true
+	case slices.Contains(runtimeFiles, name):
+		return true
+	case name == "etc/resolv.conf":
+		content, err := readRegularFile(path)
+		return err == nil && string(content) == resolvConf
+	case name == "etc/hostname":
+		// Missing in boxes imported or created from commits
+		// until they run
+		content, err := readRegularFile(path)
+		return os.IsNotExist(err) || (err == nil && string(content) == self.Box+"\n")
+	}
+	for _, volume := range self.Volumes {
+		volume = strings.Trim(filepath.Clean("/"+volume), "/")
+		if volume != "" && (name == volume || strings.HasPrefix(name, volume+"/")) {
+			return true
+		}
+	}
+	return false
+}
+
+// Reads the file at path unless it’s something else, like a FIFO
+// that would block reading.
+func readRegularFile(path string) ([]byte, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.Mode().IsRegular() {
+		return nil, fmt.Errorf("%s: not a regular file", path)
+	}
+	return os.ReadFile(path)
+}
+
+func encodeBoxFSOp(op boxFSOp) (string, error) {
+	buf := new(bytes.Buffer)
+	err := gob.NewEncoder(buf).Encode(op)
+	if err != nil {
+		return "", fmt.Errorf("serializing box file system operation: %w", err)
+	}
+	return fmt.Sprintf("%x", buf.String()), nil
+}
+
+func decodeBoxFSOp() (op boxFSOp, err error) {
+	var b []byte
+	_, err = fmt.Sscanf(os.Getenv(boxFSEnv), "%x", &b)
+	if err != nil {
+		return op, fmt.Errorf("reading %s: %w", boxFSEnv, err)
+	}
+	err = gob.NewDecoder(bytes.NewReader(b)).Decode(&op)
+	if err != nil {
+		return op, fmt.Errorf("decoding box file system operation: %w", err)
+	}
+	return
+}
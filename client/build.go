@@ -0,0 +1,656 @@
+package client
+
+import (
+	"archive/tar"
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/codingpa-ws/foxbox/internal/archive"
+	"github.com/codingpa-ws/foxbox/internal/foxfile"
+	"github.com/codingpa-ws/foxbox/internal/fsdiff"
+	"github.com/codingpa-ws/foxbox/internal/store"
+	"github.com/codingpa-ws/foxbox/internal/toolchain"
+	"github.com/klauspost/pgzip"
+)
+
+type BuildOptions struct {
+	// Directory that copy sources are relative to, defaults to .
+	Context string
+	// Defaults to Foxfile in the context directory
+	Foxfile string
+	// Name to store the image as
+	Tag string
+	// When to pull the image of the from instruction,
+	// defaults to PullMissing.
+	Pull PullPolicy
+	// Runs all steps instead of using cached results
+	NoCache bool
+	// URL of the toolchains.json used by install instructions,
+	// defaults to FOXBOX_TOOLCHAINS or toolchain.DefaultURL.
+	Toolchains string
+	// How merge instructions without --on-conflict resolve
+	// conflicts, defaults to ConflictFail.
+	OnConflict ConflictPolicy
+
+	// Receive the progress and the output of run steps
+	Stdout io.Writer
+	Stderr io.Writer
+}
+
+func (self BuildOptions) getContext() string {
+	if self.Context == "" {
+		return "."
+	}
+	return self.Context
+}
+
+func (self BuildOptions) getFoxfile() string {
+	if self.Foxfile == "" {
+		return filepath.Join(self.getContext(), "Foxfile")
+	}
+	return self.Foxfile
+}
+
+// How merge instructions resolve conflicting changes of images.
+type ConflictPolicy string
+
+const (
+	// Fails the build
+	ConflictFail ConflictPolicy = ConflictPolicy(fsdiff.PolicyFail)
+	// Keeps the change of the earlier image
+	ConflictLeft ConflictPolicy = ConflictPolicy(fsdiff.PolicyLeft)
+	// Keeps the change of the later image
+	ConflictRight ConflictPolicy = ConflictPolicy(fsdiff.PolicyRight)
+)
+
+func (self BuildOptions) getToolchains() string {
+	if self.Toolchains == "" {
+		return toolchain.URL()
+	}
+	return self.Toolchains
+}
+
+func (self BuildOptions) getOnConflict() fsdiff.Policy {
+	if self.OnConflict == "" {
+		return fsdiff.PolicyFail
+	}
+	return fsdiff.Policy(self.OnConflict)
+}
+
+func (self BuildOptions) getStdout() io.Writer {
+	if self.Stdout == nil {
+		return os.Stdout
+	}
+	return self.Stdout
+}
+
+func (self BuildOptions) getStderr() io.Writer {
+	if self.Stderr == nil {
+		return os.Stderr
+	}
+	return self.Stderr
+}
+
+// Builds an image from a Foxfile, see package foxfile. run steps are
+// executed in a temporary box and copy steps copy files from the
+// context into it. The file system after each of these steps is
+// cached, keyed on the instruction, all steps before it and, for
+// copy, the copied files, so unchanged steps aren’t run again.
+func (client *client) Build(opt *BuildOptions) (image Image, err error) {
+	opt = newOr(opt)
+	err = validateImageName(opt.Tag)
+	if err != nil {
+		return
+	}
+
+	f, err := os.Open(opt.getFoxfile())
+	if err != nil {
+		return
+	}
+	instructions, err := foxfile.Parse(f)
+	f.Close()
+	if err != nil {
+		return image, fmt.Errorf("parsing %s: %w", opt.getFoxfile(), err)
+	}
+	err = os.MkdirAll(client.store.BuildCacheBase(), 0755)
+	if err != nil {
+		return
+	}
+
+	b := &builder{client: client, opt: opt}
+	defer func() {
+		if b.box != "" {
+			err = errors.Join(err, client.Delete(b.box, nil))
+		}
+	}()
+
+	for i, instruction := range instructions {
+		fmt.Fprintf(opt.getStdout(), "[%d/%d] %s\n", i+1, len(instructions), instruction)
+		err = b.step(instruction)
+		if err != nil {
+			return image, fmt.Errorf("line %d: %w", instruction.Line, err)
+		}
+	}
+
+	source, gzipped := b.snapshot, true
+	if source == "" {
+		source, gzipped = b.imagePath, b.imageGzipped
+	}
+	err = client.writeImage(opt.Tag, gzipped, &b.config, func(w io.Writer) error {
+		f, err := os.Open(source)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(w, f)
+		return err
+	})
+	if err != nil {
+		return
+	}
+	return Image{Name: opt.Tag}, nil
+}
+
+type builder struct {
+	client *client
+	opt    *BuildOptions
+	config ImageConfig
+	// Cache key of the steps so far
+	key string
+
+	// The image of the from instruction
+	image        string
+	imagePath    string
+	imageGzipped bool
+
+	// Snapshot of the file system after the last step that
+	// changed it, empty as long as it is the image
+	snapshot string
+	// Temporary box created by the first step that isn’t cached
+	// and the snapshot its file system is at
+	box         string
+	boxSnapshot string
+
+	// Fetched by the first install instruction
+	catalog *toolchain.Catalog
+}
+
+func (self *builder) step(instruction foxfile.Instruction) error {
+	switch instruction.Keyword {
+	case foxfile.From:
+		return self.from(instruction)
+	case foxfile.Run:
+		return self.run(instruction)
+	case foxfile.Copy:
+		return self.copy(instruction)
+	case foxfile.Merge:
+		return self.merge(instruction)
+	case foxfile.Install:
+		return self.install(instruction)
+	}
+
+	self.key = cacheKey(self.key, instruction.String())
+	switch instruction.Keyword {
+	case foxfile.Env:
+		env, err := instruction.EnvVars()
+		if err != nil {
+			return err
+		}
+		self.config.Env = mergeEnv(self.config.Env, env)
+	case foxfile.Workdir:
+		words, err := foxfile.Words(instruction.Args)
+		if err != nil {
+			return err
+		}
+		self.config.WorkingDir = self.boxPath(words[0])
+	case foxfile.Cmd:
+		cmd, err := instruction.Command()
+		if err != nil {
+			return err
+		}
+		self.config.Cmd = cmd
+	case foxfile.Entrypoint:
+		entrypoint, err := instruction.Command()
+		if err != nil {
+			return err
+		}
+		// Like docker, the cmd of the image doesn’t apply anymore
+		self.config.Entrypoint, self.config.Cmd = entrypoint, nil
+	default:
+		return fmt.Errorf("unsupported instruction %s", instruction.Keyword)
+	}
+	return nil
+}
+
+func (self *builder) from(instruction foxfile.Instruction) (err error) {
+	if self.image != "" {
+		return errors.New("only one from instruction is supported")
+	}
+	words, err := foxfile.Words(instruction.Args)
+	if err != nil {
+		return
+	}
+	self.image, self.imagePath, self.imageGzipped, err = self.client.resolveImage(&CreateOptions{
+		Image: words[0],
+		Pull:  self.opt.Pull,
+	})
+	if err != nil {
+		return
+	}
+	digest, err := imageDigest(self.client.store, self.image, self.imagePath)
+	if err != nil {
+		return
+	}
+	config, err := imageConfig(self.client.store, self.image)
+	if err != nil {
+		return
+	}
+	self.config = *newOr(config)
+	self.key = cacheKey(digest)
+	return nil
+}
+
+func (self *builder) run(instruction foxfile.Instruction) error {
+	command, err := instruction.Command()
+	if err != nil {
+		return err
+	}
+	return self.change(cacheKey(self.key, instruction.String()), func(fileSystem string) error {
+		saved, err := archiveFiles(fileSystem, buildRuntimeFiles)
+		if err != nil {
+			return err
+		}
+		// Networking needs the resolv.conf of foxbox
+		err = extractFiles(fileSystem, map[string][]byte{"etc/resolv.conf": resolvConfArchive()})
+		if err != nil {
+			return err
+		}
+		err = self.client.Run(self.box, &RunOptions{
+			Command:          command,
+			Entrypoint:       []string{""},
+			Env:              self.config.Env,
+			WorkDir:          self.config.WorkingDir,
+			User:             self.config.User,
+			Stdin:            strings.NewReader(""),
+			Stdout:           self.opt.getStdout(),
+			Stderr:           self.opt.getStderr(),
+			EnableNetworking: true,
+		})
+		if err != nil {
+			return fmt.Errorf("running %s: %w", instruction.Args, err)
+		}
+		return extractFiles(fileSystem, saved)
+	})
+}
+
+// Copies files and directories from the context. Sources may be
+// glob patterns. The destination is a directory if it ends with a
+// slash or if there are multiple sources. Like docker, the contents
+// of directories are copied, not the directories themselves.
+func (self *builder) copy(instruction foxfile.Instruction) error {
+	words, err := foxfile.Words(instruction.Args)
+	if err != nil {
+		return err
+	}
+	dst := self.boxPath(words[len(words)-1])
+	intoDir := strings.HasSuffix(words[len(words)-1], "/")
+
+	context, err := filepath.EvalSymlinks(self.opt.getContext())
+	if err != nil {
+		return fmt.Errorf("resolving context: %w", err)
+	}
+	var sources []string
+	for _, pattern := range words[:len(words)-1] {
+		// Sources can’t be outside of the context
+		pattern = filepath.Join(context, filepath.FromSlash(path.Clean("/"+pattern)))
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return err
+		}
+		if len(matches) == 0 {
+			return fmt.Errorf("copy: %s: %w", pattern, os.ErrNotExist)
+		}
+		for _, match := range matches {
+			err = checkInContext(context, match)
+			if err != nil {
+				return err
+			}
+		}
+		sources = append(sources, matches...)
+	}
+	intoDir = intoDir || len(sources) > 1
+
+	inputs, err := hashFiles(sources)
+	if err != nil {
+		return fmt.Errorf("hashing sources: %w", err)
+	}
+	return self.change(cacheKey(self.key, instruction.String(), inputs), func(fileSystem string) error {
+		for _, source := range sources {
+			info, err := os.Lstat(source)
+			if err != nil {
+				return err
+			}
+			target := dst
+			if intoDir && !info.IsDir() {
+				target = path.Join(dst, filepath.Base(source))
+			}
+			err = archive.Copy(source, fileSystem, target)
+			if err != nil {
+				return fmt.Errorf("copying %s: %w", source, err)
+			}
+		}
+		return nil
+	})
+}
+
+// Fails for sources whose directory is outside of the context once
+// symlinks are resolved, like matches in symlinked directories.
+// Symlinks themselves are copied as they are.
+func checkInContext(context, source string) error {
+	dir, err := filepath.EvalSymlinks(filepath.Dir(source))
+	if err != nil {
+		return fmt.Errorf("copy: %w", err)
+	}
+	rel, err := filepath.Rel(context, dir)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, "../") {
+		return fmt.Errorf("copy: %s is outside of the build context", source)
+	}
+	return nil
+}
+
+// Merges images built on the from image into the file system by
+// applying their changes to it, see fsdiff.Merge. Conflicting changes
+// fail the build unless the policy is left, which keeps the change of
+// the earlier image, or right, which keeps that of the later one.
+func (self *builder) merge(instruction foxfile.Instruction) error {
+	images, onConflict, err := instruction.MergeArgs()
+	if err != nil {
+		return err
+	}
+	policy := fsdiff.Policy(onConflict)
+	if policy == "" {
+		policy = self.opt.getOnConflict()
+	}
+
+	baseDigest, err := imageDigest(self.client.store, self.image, self.imagePath)
+	if err != nil {
+		return err
+	}
+	base, err := self.client.imageLayer(self.image, self.imagePath, self.imageGzipped, baseDigest)
+	if err != nil {
+		return err
+	}
+	var layers []string
+	inputs := []string{self.key, instruction.String(), string(policy)}
+	for _, image := range images {
+		ref, path, gzipped, err := self.client.resolveImage(&CreateOptions{
+			Image: image,
+			Pull:  self.opt.Pull,
+		})
+		if err != nil {
+			return err
+		}
+		digest, err := imageDigest(self.client.store, ref, path)
+		if err != nil {
+			return err
+		}
+		layer, err := self.client.imageLayer(ref, path, gzipped, digest)
+		if err != nil {
+			return err
+		}
+		layers = append(layers, layer)
+		inputs = append(inputs, digest)
+	}
+
+	return self.change(cacheKey(inputs...), func(fileSystem string) error {
+		trees := make([]fsdiff.Tree, len(layers))
+		for i, layer := range layers {
+			changes, err := fsdiff.Diff(base, layer)
+			if err != nil {
+				return fmt.Errorf("comparing %s with %s: %w", images[i], self.image, err)
+			}
+			trees[i] = fsdiff.Tree{Root: layer, Changes: changes}
+		}
+		merged, err := fsdiff.Merge(trees, policy)
+		if err != nil {
+			return err
+		}
+		for _, conflict := range merged.Conflicts {
+			fmt.Fprintf(self.opt.getStderr(), "conflict resolved (%s): %s\n", policy, conflict)
+		}
+		return merged.Apply(fileSystem, trees)
+	})
+}
+
+// Runs apply on the file system of the temporary box and snapshots
+// the result, unless a snapshot for key is cached already.
+func (self *builder) change(key string, apply func(fileSystem string) error) error {
+	self.key = key
+	snapshot := filepath.Join(self.client.store.BuildCacheBase(), key+".tar.gz")
+	if _, err := os.Stat(snapshot); err == nil && !self.opt.NoCache {
+		fmt.Fprintln(self.opt.getStdout(), "cached")
+		self.snapshot = snapshot
+		return nil
+	}
+
+	fileSystem, err := self.boxFileSystem()
+	if err != nil {
+		return fmt.Errorf("preparing build box: %w", err)
+	}
+	err = apply(fileSystem)
+	if err != nil {
+		return err
+	}
+	err = writeSnapshot(self.box, fileSystem, snapshot)
+	if err != nil {
+		return fmt.Errorf("storing snapshot: %w", err)
+	}
+	self.snapshot, self.boxSnapshot = snapshot, snapshot
+	return nil
+}
+
+// Returns the file system of the temporary box, which
+// is created or restored from the current snapshot.
+func (self *builder) boxFileSystem() (string, error) {
+	if self.box == "" {
+		box, err := self.client.Create(&CreateOptions{
+			Image:         self.image,
+			Pull:          PullNever,
+			StorageDriver: StorageCopy,
+		})
+		if err != nil {
+			return "", err
+		}
+		self.box = box
+		entry, err := self.client.store.GetEntry(box)
+		if err != nil {
+			return "", err
+		}
+		layer, err := self.client.boxLayer(entry)
+		if err != nil {
+			return "", err
+		}
+		// Create replaced resolv.conf
+		files, err := archiveFiles(layer, buildRuntimeFiles)
+		if err != nil {
+			return "", err
+		}
+		err = extractFiles(entry.FileSystem(), files)
+		if err != nil {
+			return "", err
+		}
+	}
+	entry, err := self.client.store.GetEntry(self.box)
+	if err != nil {
+		return "", err
+	}
+	fileSystem := entry.FileSystem()
+	if self.boxSnapshot == self.snapshot {
+		return fileSystem, nil
+	}
+
+	err = store.RemoveAll(fileSystem)
+	if err == nil {
+		err = os.Mkdir(fileSystem, 0755)
+	}
+	if err != nil {
+		return "", err
+	}
+	f, err := os.Open(self.snapshot)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	err = extractImage(f, true, fileSystem)
+	if err != nil {
+		return "", err
+	}
+	self.boxSnapshot = self.snapshot
+	return fileSystem, nil
+}
+
+// Resolves paths relative to the working directory.
+func (self *builder) boxPath(p string) string {
+	if path.IsAbs(p) {
+		return path.Clean(p)
+	}
+	return path.Join("/", self.config.WorkingDir, p)
+}
+
+// Files foxbox writes into the build box for running it. They are
+// restored after run steps, so like with docker, changes to them are
+// only kept from other steps. Ones that didn’t exist are left out of
+// snapshots as runtime files, see boxFSOp.runtimeFile.
+var buildRuntimeFiles = []string{"etc/hostname", "etc/resolv.conf"}
+
+// Archives each of the files that exist within root.
+func archiveFiles(root string, names []string) (map[string][]byte, error) {
+	archives := map[string][]byte{}
+	for _, name := range names {
+		buf := new(bytes.Buffer)
+		err := archive.CreateAt(buf, root, name, path.Base(name))
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("archiving %s: %w", name, err)
+		}
+		archives[name] = buf.Bytes()
+	}
+	return archives, nil
+}
+
+// Extracts archives of archiveFiles to their paths within
+// root, unless their directory has been removed.
+func extractFiles(root string, archives map[string][]byte) error {
+	for name, b := range archives {
+		err := archive.ExtractAt(bytes.NewReader(b), root, name)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("restoring %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+func resolvConfArchive() []byte {
+	buf := new(bytes.Buffer)
+	tw := tar.NewWriter(buf)
+	// Writing to a buffer can’t fail
+	tw.WriteHeader(&tar.Header{Name: "resolv.conf", Typeflag: tar.TypeReg, Mode: 0644, Size: int64(len(resolvConf)), ModTime: time.Now()})
+	tw.Write([]byte(resolvConf))
+	tw.Close()
+	return buf.Bytes()
+}
+
+// Archives the file system of the build box without the
+// files created by running it, see boxFSOp.runtimeFile.
+func writeSnapshot(box, fileSystem, path string) (err error) {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return
+	}
+	defer func() {
+		if err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+	}()
+
+	gz := pgzip.NewWriter(tmp)
+	op := boxFSOp{Archive: true, SkipRuntime: true, Box: box}
+	err = errors.Join(op.run(fileSystem, nil, gz), gz.Close())
+	if err != nil {
+		return
+	}
+	err = tmp.Close()
+	if err != nil {
+		return
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func cacheKey(parts ...string) string {
+	hash := sha256.New()
+	for _, part := range parts {
+		fmt.Fprintf(hash, "%d:%s", len(part), part)
+	}
+	return fmt.Sprintf("%x", hash.Sum(nil))
+}
+
+// Hashes the names, modes and contents of the files,
+// including everything in directories.
+func hashFiles(paths []string) (string, error) {
+	hash := sha256.New()
+	for _, root := range paths {
+		fmt.Fprintf(hash, "%s\x00", filepath.Base(root))
+		err := filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			rel, err := filepath.Rel(root, path)
+			if err != nil {
+				return err
+			}
+			info, err := entry.Info()
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(hash, "%s\x00%o\x00", rel, info.Mode())
+
+			switch {
+			case info.Mode()&fs.ModeSymlink != 0:
+				target, err := os.Readlink(path)
+				if err != nil {
+					return err
+				}
+				fmt.Fprintf(hash, "%s\x00", target)
+			case info.Mode().IsRegular():
+				f, err := os.Open(path)
+				if err != nil {
+					return err
+				}
+				defer f.Close()
+				fmt.Fprintf(hash, "%d\x00", info.Size())
+				_, err = io.Copy(hash, f)
+				return err
+			}
+			return nil
+		})
+		if err != nil {
+			return "", err
+		}
+	}
+	return fmt.Sprintf("%x", hash.Sum(nil)), nil
+}
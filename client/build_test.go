@@ -0,0 +1,262 @@
+package client_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/codingpa-ws/foxbox/client"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuild(t *testing.T) {
+	require := require.New(t)
+	store := newStore(t)
+	foxbox := client.FromStore(store)
+	require.NoError(foxbox.ImportImage("tiny", bytes.NewReader(tinyRootFS(t))))
+
+	context := t.TempDir()
+	require.NoError(os.MkdirAll(filepath.Join(context, "src", "lib"), 0755))
+	require.NoError(os.WriteFile(filepath.Join(context, "src", "lib", "main.sh"), []byte("echo hi\n"), 0755))
+	require.NoError(os.WriteFile(filepath.Join(context, "config.txt"), []byte("v1\n"), 0644))
+	require.NoError(os.WriteFile(filepath.Join(context, "Foxfile"), []byte(`from tiny
+env GREETING="hello fox"
+workdir /app
+copy src .
+copy config.txt ../../etc/
+cmd ["./lib/main.sh"]
+`), 0644))
+
+	build := func() string {
+		stdout := new(strings.Builder)
+		image, err := foxbox.Build(&client.BuildOptions{
+			Context: context,
+			Tag:     "app",
+			Stdout:  stdout,
+		})
+		require.NoError(err)
+		require.Equal("app", image.Name)
+		return stdout.String()
+	}
+
+	stdout := build()
+	require.Contains(stdout, "[4/6] copy src .\n")
+	require.NotContains(stdout, "cached")
+
+	name, err := foxbox.Create(&client.CreateOptions{Image: "app", StorageDriver: client.StorageCopy})
+	require.NoError(err)
+	entry, err := store.GetEntry(name)
+	require.NoError(err)
+	require.FileExists(filepath.Join(entry.FileSystem(), "app", "lib", "main.sh"))
+	content, err := os.ReadFile(filepath.Join(entry.FileSystem(), "etc", "config.txt"))
+	require.NoError(err)
+	require.Equal("v1\n", string(content))
+	content, err = os.ReadFile(filepath.Join(entry.FileSystem(), "etc", "hostname"))
+	require.NoError(err)
+	require.Equal("fox\n", string(content), "files of the image must be kept")
+
+	meta, err := os.ReadFile(store.GetImageMetaPath("app"))
+	require.NoError(err)
+	var image struct{ Config client.ImageConfig }
+	require.NoError(json.Unmarshal(meta, &image))
+	require.Equal(client.ImageConfig{
+		Env:        []string{"GREETING=hello fox"},
+		WorkingDir: "/app",
+		Cmd:        []string{"./lib/main.sh"},
+	}, image.Config)
+
+	stdout = build()
+	require.Equal(2, strings.Count(stdout, "cached\n"))
+
+	// Only steps from the changed file on run again
+	require.NoError(os.WriteFile(filepath.Join(context, "config.txt"), []byte("v2\n"), 0644))
+	stdout = build()
+	require.Equal(1, strings.Count(stdout, "cached\n"))
+}
+
+func TestBuildCopyOutside(t *testing.T) {
+	require := require.New(t)
+	store := newStore(t)
+	foxbox := client.FromStore(store)
+	require.NoError(foxbox.ImportImage("tiny", bytes.NewReader(tinyRootFS(t))))
+
+	outside := t.TempDir()
+	require.NoError(os.WriteFile(filepath.Join(outside, "secret"), []byte("secret"), 0644))
+	context := t.TempDir()
+	require.NoError(os.Symlink(outside, filepath.Join(context, "link")))
+	require.NoError(os.Mkdir(filepath.Join(context, "dir"), 0755))
+	require.NoError(os.Symlink("../link", filepath.Join(context, "dir", "link")))
+
+	for _, source := range []string{"link/*", "link/secret", "dir/link/secret", "*/secret"} {
+		require.NoError(os.WriteFile(filepath.Join(context, "Foxfile"), []byte("from tiny\ncopy "+source+" /dst/\n"), 0644))
+		_, err := foxbox.Build(&client.BuildOptions{Context: context, Tag: "leak"})
+		require.ErrorContains(err, "outside of the build context", source)
+	}
+
+	// Symlinks are copied as they are
+	require.NoError(os.WriteFile(filepath.Join(context, "Foxfile"), []byte("from tiny\ncopy link /dst/\n"), 0644))
+	_, err := foxbox.Build(&client.BuildOptions{Context: context, Tag: "link"})
+	require.NoError(err)
+	name, err := foxbox.Create(&client.CreateOptions{Image: "link", StorageDriver: client.StorageCopy})
+	require.NoError(err)
+	entry, err := store.GetEntry(name)
+	require.NoError(err)
+	target, err := os.Readlink(filepath.Join(entry.FileSystem(), "dst", "link"))
+	require.NoError(err)
+	require.Equal(outside, target)
+}
+
+func TestBuildMerge(t *testing.T) {
+	require := require.New(t)
+	store := newStore(t)
+	foxbox := client.FromStore(store)
+	require.NoError(foxbox.ImportImage("tiny", bytes.NewReader(tinyRootFS(t))))
+	require.NoError(foxbox.ImportImage("go", bytes.NewReader(tarball(t, map[string]string{
+		"etc/hostname":        "fox\n",
+		"usr/local/go/bin/go": "go",
+		"etc/motd":            "go\n",
+	}))))
+	require.NoError(foxbox.ImportImage("valkey", bytes.NewReader(tarball(t, map[string]string{
+		"etc/hostname":   "fox\n",
+		"usr/bin/valkey": "valkey",
+		"etc/motd":       "valkey\n",
+	}))))
+
+	context := t.TempDir()
+	build := func(foxfile string, policy client.ConflictPolicy) error {
+		require.NoError(os.WriteFile(filepath.Join(context, "Foxfile"), []byte(foxfile), 0644))
+		_, err := foxbox.Build(&client.BuildOptions{
+			Context:    context,
+			Tag:        "merged",
+			OnConflict: policy,
+			Stdout:     io.Discard,
+			Stderr:     io.Discard,
+		})
+		return err
+	}
+
+	err := build("from tiny\nmerge go valkey\n", "")
+	require.ErrorContains(err, "/etc/motd: changed differently")
+	require.NoError(build("from tiny\nmerge --on-conflict=right go valkey\n", client.ConflictLeft))
+
+	name, err := foxbox.Create(&client.CreateOptions{Image: "merged", StorageDriver: client.StorageCopy})
+	require.NoError(err)
+	entry, err := store.GetEntry(name)
+	require.NoError(err)
+	require.FileExists(filepath.Join(entry.FileSystem(), "usr", "local", "go", "bin", "go"))
+	require.FileExists(filepath.Join(entry.FileSystem(), "usr", "bin", "valkey"))
+	motd, err := os.ReadFile(filepath.Join(entry.FileSystem(), "etc", "motd"))
+	require.NoError(err)
+	require.Equal("valkey\n", string(motd), "the instruction’s policy must take precedence")
+}
+
+func TestBuildInstall(t *testing.T) {
+	require := require.New(t)
+	store := newStore(t)
+	foxbox := client.FromStore(store)
+	require.NoError(foxbox.ImportImage("tiny", bytes.NewReader(tinyRootFS(t))))
+
+	dir := t.TempDir()
+	toolchain := tarball(t, map[string]string{"foxc-1.2.3/bin/foxc": "foxc"})
+	require.NoError(os.WriteFile(filepath.Join(dir, "foxc.tar"), toolchain, 0644))
+	writeCatalog := func(sha256 string) {
+		writeJSON(t, filepath.Join(dir, "toolchains.json"), map[string]any{
+			"toolchains": []any{map[string]any{
+				"name": "foxc",
+				"versions": []any{map[string]any{
+					"version": "1.2.3",
+					"arch":    runtime.GOARCH,
+					"url":     "foxc.tar",
+					"sha256":  sha256,
+					"prefix":  "/opt/foxc",
+					"strip":   1,
+				}},
+			}},
+		})
+	}
+	require.NoError(os.WriteFile(filepath.Join(dir, "Foxfile"), []byte("from tiny\ninstall foxc@1.2\n"), 0644))
+	build := func() error {
+		_, err := foxbox.Build(&client.BuildOptions{
+			Context:    dir,
+			Tag:        "tools",
+			Toolchains: "file://" + filepath.Join(dir, "toolchains.json"),
+			Stdout:     io.Discard,
+		})
+		return err
+	}
+
+	writeCatalog(strings.Repeat("0", 64))
+	require.ErrorContains(build(), "sha256 mismatch")
+
+	writeCatalog(strings.TrimPrefix(digestOf(toolchain), "sha256:"))
+	require.NoError(build())
+	name, err := foxbox.Create(&client.CreateOptions{Image: "tools", StorageDriver: client.StorageCopy})
+	require.NoError(err)
+	entry, err := store.GetEntry(name)
+	require.NoError(err)
+	require.FileExists(filepath.Join(entry.FileSystem(), "opt", "foxc", "bin", "foxc"))
+
+	meta, err := os.ReadFile(store.GetImageMetaPath("tools"))
+	require.NoError(err)
+	var image struct{ Config client.ImageConfig }
+	require.NoError(json.Unmarshal(meta, &image))
+	require.Equal([]string{"PATH=/opt/foxc/bin:/bin:/sbin:/usr/bin:/usr/sbin"}, image.Config.Env)
+}
+
+func TestBuildRun(t *testing.T) {
+	if testing.Short() {
+		t.Skip("integration test is slow")
+	}
+	require := require.New(t)
+
+	store := newStore(t)
+	downloadImage(t, store)
+	foxbox := client.FromStore(store)
+
+	context := t.TempDir()
+	require.NoError(os.WriteFile(filepath.Join(context, "Foxfile"), []byte(`from `+AlpineImageName+`
+env FOX=built
+workdir /srv
+run echo "$FOX in $PWD" > greeting
+cmd cat greeting
+`), 0644))
+	_, err := foxbox.Build(&client.BuildOptions{Context: context, Tag: "greeter"})
+	require.NoError(err)
+
+	name, err := foxbox.Create(&client.CreateOptions{Image: "greeter"})
+	require.NoError(err)
+	stdout := new(strings.Builder)
+	require.NoError(foxbox.Run(name, &client.RunOptions{Stdout: stdout}))
+	require.Equal("built in /srv\n", stdout.String())
+
+	// Failing steps fail the build
+	require.NoError(os.WriteFile(filepath.Join(context, "Foxfile"), []byte(`from `+AlpineImageName+`
+run false
+`), 0644))
+	_, err = foxbox.Build(&client.BuildOptions{Context: context, Tag: "broken"})
+	require.Error(err)
+	entries, err := os.ReadDir(store.EntryBase())
+	require.NoError(err)
+	require.Len(entries, 1, "the build box must be deleted")
+
+	// Run steps see the files foxbox writes for running boxes,
+	// while images keep those of their base image
+	require.NoError(os.WriteFile(filepath.Join(context, "resolv.conf"), []byte("nameserver 192.0.2.1\n"), 0644))
+	require.NoError(os.WriteFile(filepath.Join(context, "Foxfile"), []byte(`from `+AlpineImageName+`
+copy resolv.conf /etc/
+run cat /etc/resolv.conf > /seen
+`), 0644))
+	_, err = foxbox.Build(&client.BuildOptions{Context: context, Tag: "resolver"})
+	require.NoError(err)
+	base := imageFiles(t, store.GetImagePath(AlpineImageName, true))
+	built := imageFiles(t, store.GetImagePath("resolver", true))
+	require.Equal("nameserver 10.0.2.3\n", built["seen"])
+	require.Equal("nameserver 192.0.2.1\n", built["etc/resolv.conf"])
+	require.Contains(base, "etc/hostname")
+	require.Equal(base["etc/hostname"], built["etc/hostname"])
+}
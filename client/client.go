@@ -1,8 +1,11 @@
 package client
 
 import (
+	"io"
 	"os"
 	"path/filepath"
+	"syscall"
+	"time"
 
 	"github.com/codingpa-ws/foxbox/internal/store"
 )
@@ -14,8 +17,26 @@ type Client interface {
 	Delete(name string, opt *DeleteOptions) (err error)
 	List(opt *ListOptions) (ids []string, err error)
 	Ps(opt *PsOptions) (infos []ProcessInfo, err error)
+	Inspect(name string) (info *BoxInfo, err error)
 	Run(name string, opt *RunOptions) (err error)
+	Start(name string, opt *RunOptions) (err error)
+	Exec(name string, opt *ExecOptions) (err error)
+	Stop(name string, timeout time.Duration) (err error)
+	Kill(name string, signal syscall.Signal) (err error)
+	Logs(name string, opt *LogsOptions) (logs io.ReadCloser, err error)
 	ListImages() ([]Image, error)
+	PullImage(ref string, opt *PullOptions) (image Image, err error)
+	ImportImage(name string, r io.Reader) (err error)
+	ImportOCIImage(name, path string, opt *ImportOCIOptions) (err error)
+	RemoveImage(name string, force bool) (err error)
+	Build(opt *BuildOptions) (image Image, err error)
+	Commit(name, image string, opt *CommitOptions) (err error)
+	CopyTo(name, src, dst string) (err error)
+	CopyFrom(name, src, dst string) (err error)
+	Diff(name string) (changes []Change, err error)
+	DiffLayer(name string, w io.Writer) (err error)
+	ExportBox(name string, w io.Writer) (err error)
+	ImportBox(path string, opt *ImportBoxOptions) (name string, err error)
 }
 
 type client struct {
@@ -142,6 +142,39 @@ func TestRun(t *testing.T) {
 		require.Error(err, "client must prevent running a container twice in parallel")
 		require.NoError(<-firstRunErr)
 	})
+	t.Run("detached returns while running", func(t *testing.T) {
+		require := require.New(t)
+
+		store := newStore(t)
+		downloadImage(t, store)
+
+		foxbox := client.FromStore(store)
+		name, err := foxbox.Create(&client.CreateOptions{
+			Image: AlpineImageName,
+		})
+		require.NoError(err)
+
+		err = foxbox.Start(name, &client.RunOptions{
+			Command: []string{"sleep", "0.2"},
+		})
+		require.NoError(err)
+
+		entry, err := store.GetEntry(name)
+		require.NoError(err)
+		pid, running, err := entry.GetPID()
+		require.NoError(err)
+		require.True(running, "box must still be running after client.Start returns")
+
+		infos, err := foxbox.Ps(nil)
+		require.NoError(err)
+		require.Equal(1, len(infos))
+		require.Equal(pid, infos[0].PID)
+
+		require.Eventually(func() bool {
+			_, running, _ := entry.GetPID()
+			return !running
+		}, time.Second, 10*time.Millisecond)
+	})
 }
 
 func run(
@@ -0,0 +1,62 @@
+package client
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/klauspost/pgzip"
+)
+
+type CommitOptions struct {
+	// Replace the cmd and entrypoint of the box’s image
+	Cmd        []string
+	Entrypoint []string
+	// Variables formatted as KEY=value, added to or
+	// replacing those of the box’s image
+	Env []string
+	// Replaces the working directory of the box’s image
+	WorkDir string
+}
+
+// Stores the file system of a box as gzipped image, replacing an
+// existing image of that name. Files foxbox creates when running boxes,
+// such as device files, the contents of /proc and /tmp and the
+// generated resolv.conf and hostname, are left out. The image keeps the
+// config of the box’s image, with the options applied on top.
+func (client *client) Commit(name, image string, opt *CommitOptions) (err error) {
+	opt = newOr(opt)
+	err = validateImageName(image)
+	if err != nil {
+		return
+	}
+	entry, err := client.store.GetEntry(name)
+	if err != nil {
+		return
+	}
+	name = entry.Name()
+	config, err := boxImageConfig(entry)
+	if err != nil {
+		return fmt.Errorf("reading image config: %w", err)
+	}
+	config = newOr(config)
+	if len(opt.Entrypoint) > 0 {
+		// Like with docker, the cmd belongs to the old entrypoint
+		config.Entrypoint, config.Cmd = opt.Entrypoint, nil
+	}
+	if len(opt.Cmd) > 0 {
+		config.Cmd = opt.Cmd
+	}
+	config.Env = mergeEnv(config.Env, opt.Env)
+	if opt.WorkDir != "" {
+		config.WorkingDir = opt.WorkDir
+	}
+
+	return client.writeImage(image, true, config, func(w io.Writer) error {
+		gz := pgzip.NewWriter(w)
+		err := client.runBoxFS(name, boxFSOp{Archive: true, SkipRuntime: true}, nil, gz)
+		if err != nil {
+			return fmt.Errorf("archiving box %s: %w", name, err)
+		}
+		return gz.Close()
+	})
+}
@@ -0,0 +1,133 @@
+package client_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/codingpa-ws/foxbox/client"
+	"github.com/klauspost/pgzip"
+	"github.com/stretchr/testify/require"
+)
+
+// Returns the names and contents of the regular files in an image.
+func imageFiles(t *testing.T, path string) map[string]string {
+	require := require.New(t)
+	f, err := os.Open(path)
+	require.NoError(err)
+	defer f.Close()
+	gz, err := pgzip.NewReader(f)
+	require.NoError(err)
+	defer gz.Close()
+
+	files := map[string]string{}
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return files
+		}
+		require.NoError(err)
+		content, err := io.ReadAll(tr)
+		require.NoError(err)
+		files[strings.TrimPrefix(header.Name, "./")] = string(content)
+	}
+}
+
+func TestCommit(t *testing.T) {
+	for _, driver := range []client.StorageDriver{client.StorageOverlay, client.StorageCopy} {
+		driver := driver
+		t.Run(string(driver), func(t *testing.T) {
+			require := require.New(t)
+			store := newStore(t)
+			foxbox := client.FromStore(store)
+			require.NoError(foxbox.ImportImage("tiny", bytes.NewReader(tinyRootFS(t))))
+
+			name, err := foxbox.Create(&client.CreateOptions{Image: "tiny", StorageDriver: driver})
+			require.NoError(err)
+			entry, err := store.GetEntry(name)
+			require.NoError(err)
+			changes := entry.FileSystem()
+			if driver == client.StorageOverlay {
+				changes = entry.UpperDir()
+			}
+			// Like after running the box
+			for path, content := range map[string]string{
+				"etc/hostname":  name + "\n",
+				"dev/null":      "",
+				"tmp/scratch":   "temporary",
+				"usr/bin/tool":  "tool",
+				"root/.history": "apk add tool",
+			} {
+				path = filepath.Join(changes, path)
+				require.NoError(os.MkdirAll(filepath.Dir(path), 0755))
+				require.NoError(os.WriteFile(path, []byte(content), 0644))
+			}
+
+			err = foxbox.Commit(name, "tools", &client.CommitOptions{
+				Cmd: []string{"tool"},
+				Env: []string{"TOOL=1"},
+			})
+			if driver == client.StorageOverlay && err != nil {
+				t.Skipf("mounting overlays is not supported: %s", err)
+			}
+			require.NoError(err)
+
+			files := imageFiles(t, store.GetImagePath("tools", true))
+			require.Equal("tool", files["usr/bin/tool"])
+			require.Equal("apk add tool", files["root/.history"])
+			require.Contains(files, "tmp/")
+			for _, runtimeFile := range []string{"etc/hostname", "etc/resolv.conf", "dev/null", "tmp/scratch"} {
+				require.NotContains(files, runtimeFile)
+			}
+
+			meta, err := os.ReadFile(store.GetImageMetaPath("tools"))
+			require.NoError(err)
+			var image struct{ Config client.ImageConfig }
+			require.NoError(json.Unmarshal(meta, &image))
+			require.Equal(client.ImageConfig{Cmd: []string{"tool"}, Env: []string{"TOOL=1"}}, image.Config)
+
+			_, err = foxbox.Create(&client.CreateOptions{Image: "tools"})
+			require.NoError(err)
+		})
+	}
+}
+
+func TestCommitRunning(t *testing.T) {
+	require := require.New(t)
+	if testing.Short() {
+		t.Skip("integration test is slow")
+	}
+
+	store := newStore(t)
+	downloadImage(t, store)
+	foxbox := client.FromStore(store)
+	name, err := foxbox.Create(&client.CreateOptions{Image: AlpineImageName})
+	require.NoError(err)
+	require.NoError(foxbox.Start(name, &client.RunOptions{
+		Command: []string{"sleep", "30"},
+	}))
+	defer foxbox.Kill(name, syscall.SIGKILL)
+	require.NoError(foxbox.Exec(name, &client.ExecOptions{
+		Command: []string{"sh", "-c", "mkdir -p /usr/local/bin && echo tool > /usr/local/bin/tool"},
+	}))
+
+	changes, err := foxbox.Diff(name)
+	require.NoError(err)
+	require.Contains(changes, client.Change{Path: "usr/local/bin/tool", Kind: client.ChangeAdded})
+
+	require.NoError(foxbox.Commit(name, "tools", nil))
+	files := imageFiles(t, store.GetImagePath("tools", true))
+	require.Equal("tool\n", files["usr/local/bin/tool"])
+	require.Contains(files, "etc/")
+	for _, runtimeFile := range []string{"etc/hostname", "etc/resolv.conf", "proc/self/"} {
+		require.NotContains(files, runtimeFile)
+	}
+}
@@ -0,0 +1,124 @@
+package client
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/codingpa-ws/foxbox/internal/store"
+)
+
+// Version of the BoxConfig format written by this version of foxbox.
+const BoxConfigVersion = 1
+
+// Metadata of a box, stored in its store entry.
+type BoxConfig struct {
+	Version int       `json:"version"`
+	Name    string    `json:"name"`
+	Image   ImageRef  `json:"image"`
+	Created time.Time `json:"created"`
+	// Set when creating the box, see CreateOptions
+	Labels map[string]string `json:"labels,omitempty"`
+	// Options of the most recent run, nil if the box has never run.
+	Run *RunConfig `json:"run,omitempty"`
+}
+
+type ImageRef struct {
+	Name string `json:"name"`
+	// Digest of the image tarball the box was created from,
+	// formatted as sha256:<hex>.
+	Digest string `json:"digest,omitempty"`
+	// Config of the image when the box was created
+	Config *ImageConfig `json:"config,omitempty"`
+}
+
+// Defaults for boxes of an image, taken from the config of OCI images.
+type ImageConfig struct {
+	User       string   `json:"user,omitempty"`
+	Env        []string `json:"env,omitempty"`
+	Entrypoint []string `json:"entrypoint,omitempty"`
+	Cmd        []string `json:"cmd,omitempty"`
+	WorkingDir string   `json:"workingDir,omitempty"`
+}
+
+type RunConfig struct {
+	Command    []string       `json:"command"`
+	Entrypoint []string       `json:"entrypoint,omitempty"`
+	Env        []string       `json:"env,omitempty"`
+	WorkDir    string         `json:"workDir,omitempty"`
+	User       string         `json:"user,omitempty"`
+	Volumes    []VolumeConfig `json:"volumes"`
+	// Either NetworkSlirp or NetworkNone
+	Network   string         `json:"network"`
+	Limits    ResourceLimits `json:"limits"`
+	LogDriver LogDriver      `json:"logDriver,omitempty"`
+}
+
+const (
+	NetworkSlirp = "slirp4netns"
+	NetworkNone  = "none"
+)
+
+// Zero values mean unlimited.
+type ResourceLimits struct {
+	CPUs        float32 `json:"cpus,omitempty"`
+	MemoryBytes uint    `json:"memoryBytes,omitempty"`
+	Processes   uint    `json:"processes,omitempty"`
+}
+
+func newRunConfig(opt *RunOptions) *RunConfig {
+	network := NetworkNone
+	if opt.EnableNetworking {
+		network = NetworkSlirp
+	}
+	return &RunConfig{
+		Command:    opt.Command,
+		Entrypoint: opt.Entrypoint,
+		Env:        opt.Env,
+		WorkDir:    opt.WorkDir,
+		User:       opt.User,
+		Volumes:    opt.Volumes,
+		Network:    network,
+		Limits: ResourceLimits{
+			CPUs:        opt.MaxCPUs,
+			MemoryBytes: opt.MaxMemoryBytes,
+			Processes:   opt.MaxProcesses,
+		},
+		LogDriver: opt.getLogDriver(),
+	}
+}
+
+// Returns the box config or an error satisfying os.IsNotExist
+// for boxes created before foxbox stored any metadata.
+func getBoxConfig(entry *store.StoreEntry) (config BoxConfig, err error) {
+	err = entry.GetConfig(&config)
+	if err != nil {
+		return
+	}
+	if config.Version > BoxConfigVersion {
+		err = fmt.Errorf("box config version %d is not supported (latest is %d)", config.Version, BoxConfigVersion)
+	}
+	return
+}
+
+// Returns the config of the image the box was created from,
+// which is nil for images without config.
+func boxImageConfig(entry *store.StoreEntry) (*ImageConfig, error) {
+	config, err := getBoxConfig(entry)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return config.Image.Config, err
+}
+
+func updateRunConfig(name string, entry *store.StoreEntry, opt *RunOptions) error {
+	config, err := getBoxConfig(entry)
+	if os.IsNotExist(err) {
+		config = BoxConfig{Name: name}
+	} else if err != nil {
+		return err
+	}
+	config.Version = BoxConfigVersion
+	config.Run = newRunConfig(opt)
+	return entry.SetConfig(config)
+}
@@ -0,0 +1,78 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"path/filepath"
+
+	"github.com/codingpa-ws/foxbox/internal/archive"
+)
+
+// Copies the file or directory src on the host to dst in a box. Like
+// with cp, src is copied into dst if that is a directory and replaces
+// dst otherwise. Symlinks in dst are resolved within the box’s file
+// system, so the copy can’t leave it.
+func (client *client) CopyTo(name, src, dst string) (err error) {
+	src, err = filepath.Abs(src)
+	if err != nil {
+		return
+	}
+	r, w := io.Pipe()
+	created := make(chan error, 1)
+	go func() {
+		err := archive.CreateAt(w, "/", src, filepath.Base(src))
+		w.CloseWithError(err)
+		created <- err
+	}()
+
+	err = client.runBoxFS(name, boxFSOp{Extract: true, Path: dst}, r, nil)
+	// Unblocks archiving if extracting failed
+	r.Close()
+	// Archiving only fails with io.ErrClosedPipe if extracting failed
+	if createErr := <-created; createErr != nil && !errors.Is(createErr, io.ErrClosedPipe) {
+		err = createErr
+	}
+	if err != nil {
+		return fmt.Errorf("copying %s to %s:%s: %w", src, name, dst, err)
+	}
+	return
+}
+
+// Copies the file or directory src in a box to dst on the host, like
+// CopyTo. Symlinks in src are resolved within the box’s file system.
+func (client *client) CopyFrom(name, src, dst string) (err error) {
+	dst, err = filepath.Abs(dst)
+	if err != nil {
+		return
+	}
+	base := path.Base(path.Clean("/" + src))
+	if base == "/" {
+		entry, err := client.store.GetEntry(name)
+		if err != nil {
+			return err
+		}
+		base = entry.Name()
+	}
+	r, w := io.Pipe()
+	archived := make(chan error, 1)
+	go func() {
+		err := client.runBoxFS(name, boxFSOp{Archive: true, Path: src, Name: base}, nil, w)
+		w.CloseWithError(err)
+		archived <- err
+	}()
+
+	err = archive.ExtractAt(r, "/", dst)
+	// Unblocks archiving if extracting failed
+	r.Close()
+	// Extracting fails with the error of archiving, or archiving
+	// fails because extracting stopped reading
+	if archiveErr := <-archived; err == nil || errors.Is(err, archiveErr) {
+		err = archiveErr
+	}
+	if err != nil {
+		return fmt.Errorf("copying %s:%s to %s: %w", name, src, dst, err)
+	}
+	return
+}
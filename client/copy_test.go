@@ -0,0 +1,106 @@
+package client_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/codingpa-ws/foxbox/client"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCopy(t *testing.T) {
+	for _, driver := range []client.StorageDriver{client.StorageOverlay, client.StorageCopy} {
+		driver := driver
+		t.Run(string(driver), func(t *testing.T) {
+			require := require.New(t)
+			store := newStore(t)
+			foxbox := client.FromStore(store)
+			require.NoError(foxbox.ImportImage("tiny", bytes.NewReader(tinyRootFS(t))))
+
+			name, err := foxbox.Create(&client.CreateOptions{Image: "tiny", StorageDriver: driver})
+			require.NoError(err)
+			entry, err := store.GetEntry(name)
+			require.NoError(err)
+			changes := entry.FileSystem()
+			if driver == client.StorageOverlay {
+				changes = entry.UpperDir()
+			}
+			require.NoError(os.Symlink("/etc", filepath.Join(changes, "config")))
+			require.NoError(os.Symlink("../../../..", filepath.Join(changes, "escape")))
+
+			host := t.TempDir()
+			src := filepath.Join(host, "src")
+			require.NoError(os.MkdirAll(filepath.Join(src, "sub"), 0755))
+			require.NoError(os.WriteFile(filepath.Join(src, "sub", "file"), []byte("file"), 0644))
+
+			err = foxbox.CopyTo(name, src, "/config")
+			if driver == client.StorageOverlay && err != nil {
+				t.Skipf("mounting overlays is not supported: %s", err)
+			}
+			require.NoError(err)
+			require.NoError(foxbox.CopyTo(name, filepath.Join(src, "sub", "file"), "/escape/escaped"))
+			require.NoFileExists(filepath.Join(filepath.Dir(store.Base()), "escaped"))
+
+			dst := filepath.Join(host, "dst")
+			require.NoError(foxbox.CopyFrom(name, "/etc/src", dst))
+			content, err := os.ReadFile(filepath.Join(dst, "sub", "file"))
+			require.NoError(err)
+			require.Equal("file", string(content))
+
+			require.NoError(foxbox.CopyFrom(name, "escape/../escaped", host))
+			content, err = os.ReadFile(filepath.Join(host, "escaped"))
+			require.NoError(err)
+			require.Equal("file", string(content))
+			require.NoError(foxbox.CopyFrom(name, "/config/hostname", filepath.Join(host, "hostname")))
+			content, err = os.ReadFile(filepath.Join(host, "hostname"))
+			require.NoError(err)
+			require.Equal("fox\n", string(content))
+
+			require.Error(foxbox.CopyFrom(name, "/missing", host))
+			require.Error(foxbox.CopyTo(name, src, "/missing/src"))
+		})
+	}
+}
+
+func TestCopyRunning(t *testing.T) {
+	require := require.New(t)
+	if testing.Short() {
+		t.Skip("integration test is slow")
+	}
+
+	store := newStore(t)
+	downloadImage(t, store)
+	foxbox := client.FromStore(store)
+	name, err := foxbox.Create(&client.CreateOptions{Image: AlpineImageName})
+	require.NoError(err)
+	require.NoError(foxbox.Start(name, &client.RunOptions{
+		Command: []string{"sh", "-c", "echo box > /tmp/box; sleep 30"},
+	}))
+	defer foxbox.Kill(name, syscall.SIGKILL)
+
+	host := t.TempDir()
+	src := filepath.Join(host, "src")
+	require.NoError(os.MkdirAll(filepath.Join(src, "sub"), 0755))
+	require.NoError(os.WriteFile(filepath.Join(src, "sub", "file"), []byte("file"), 0644))
+
+	// Mounted in the box only, like volumes
+	require.NoError(foxbox.CopyTo(name, src, "/tmp"))
+	stdout := new(strings.Builder)
+	require.NoError(foxbox.Exec(name, &client.ExecOptions{
+		Command: []string{"cat", "/tmp/src/sub/file"},
+		Stdout:  stdout,
+	}))
+	require.Equal("file", stdout.String())
+
+	require.Eventually(func() bool {
+		return foxbox.CopyFrom(name, "/tmp/box", filepath.Join(host, "box")) == nil
+	}, 5*time.Second, 50*time.Millisecond)
+	content, err := os.ReadFile(filepath.Join(host, "box"))
+	require.NoError(err)
+	require.Equal("box\n", string(content))
+}
@@ -1,117 +1,232 @@
 package client
 
 import (
-	"archive/tar"
+	"errors"
+	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"strings"
+	"time"
 
+	"github.com/codingpa-ws/foxbox/internal/archive"
+	"github.com/codingpa-ws/foxbox/internal/fscopy"
+	"github.com/codingpa-ws/foxbox/internal/registry"
 	"github.com/codingpa-ws/foxbox/internal/store"
 	"github.com/klauspost/pgzip"
 )
 
 type CreateOptions struct {
 	Image string
+	// Name of the box, a random name by default. Names consist of
+	// up to 63 letters, digits and inner hyphens, like hostnames.
+	Name string
+	// Key-value pairs for finding the box later, see ListOptions.
+	// Keys must be non-empty and can’t contain "=".
+	Labels map[string]string
+
+	// When to pull the image from the registry, defaults to PullMissing.
+	Pull PullPolicy
+	// Registry to pull from, see PullOptions.
+	Registry string
+
+	// Defaults to FOXBOX_STORAGE_DRIVER or, if unset,
+	// overlay where supported and copy otherwise.
+	StorageDriver StorageDriver
 }
 
-func (self *CreateOptions) GetImage(store *store.Store) (f io.ReadCloser, gzipped bool, err error) {
-	path := store.GetImagePath(self.Image, false)
+type PullPolicy string
 
-	f, err = os.Open(path)
-	if err != nil {
-		f, err = os.Open(path + ".gz")
-		gzipped = true
+const (
+	// Pulls images that aren’t in the image store.
+	PullMissing PullPolicy = "missing"
+	// Pulls images before every create, even if they exist locally.
+	PullAlways PullPolicy = "always"
+	// Only uses images in the image store.
+	PullNever PullPolicy = "never"
+)
+
+func (self CreateOptions) getPull() PullPolicy {
+	if self.Pull == "" {
+		return PullMissing
 	}
+	return self.Pull
+}
 
+// Opens the image tarball. Images without a tag also match
+// name:latest, as pulled by Client.PullImage. If the image
+// doesn’t exist, the error wraps os.ErrNotExist.
+func (self *CreateOptions) GetImage(store *store.Store) (f io.ReadCloser, gzipped bool, err error) {
+	_, path, gzipped, err := findImage(store, self.Image)
+	if err != nil {
+		return
+	}
+	f, err = os.Open(path)
 	return
 }
 
+// Returns the name the image is stored as and its path.
+func findImage(store *store.Store, image string) (name, path string, gzipped bool, err error) {
+	names := []string{image}
+	// Registries may have a port, e.g. localhost:5000/alpine
+	if !strings.Contains(filepath.Base(image), ":") {
+		names = append(names, image+":"+registry.DefaultTag)
+	}
+
+	for _, candidate := range names {
+		for _, gz := range []bool{false, true} {
+			candidatePath := store.GetImagePath(candidate, gz)
+			_, err = os.Stat(candidatePath)
+			if err == nil {
+				return candidate, candidatePath, gz, nil
+			}
+			if !os.IsNotExist(err) {
+				return "", "", false, err
+			}
+		}
+	}
+
+	return "", "", false, fmt.Errorf("image %s not found in %s: %w", image, store.ImageBase(), os.ErrNotExist)
+}
+
+// Finds the image according to the pull policy and returns
+// the name it is stored as.
+func (client *client) resolveImage(opt *CreateOptions) (ref, path string, gzipped bool, err error) {
+	pull := opt.getPull()
+	switch pull {
+	case PullMissing, PullNever:
+		ref, path, gzipped, err = findImage(client.store, opt.Image)
+		if pull == PullNever || !errors.Is(err, os.ErrNotExist) {
+			return
+		}
+	case PullAlways:
+	default:
+		return "", "", false, fmt.Errorf("unknown pull policy %q", pull)
+	}
+
+	pulled, err := client.PullImage(opt.Image, &PullOptions{Registry: opt.Registry})
+	if err != nil {
+		return
+	}
+	return findImage(client.store, pulled.Name)
+}
+
+// Creates a box based on the image’s layer, which is extracted
+// only once per image and shared by all boxes created from it.
+// Fails with ErrNameConflict if a box named opt.Name exists.
 func (client *client) Create(opt *CreateOptions) (name string, err error) {
 	opt = newOr(opt)
-	name = NewName()
-
-	entry, err := client.store.NewEntry(name)
+	if opt.Name != "" {
+		// Checked before pulling the image
+		err = store.ValidateName(opt.Name)
+		if err != nil {
+			return
+		}
+	}
+	err = validateLabels(opt.Labels)
 	if err != nil {
 		return
 	}
 
-	image, gzipped, err := opt.GetImage(client.store)
+	ref, path, gzipped, err := client.resolveImage(opt)
+	if err != nil {
+		return
+	}
+	digest, err := imageDigest(client.store, ref, path)
+	if err != nil {
+		return
+	}
+	imageConfig, err := imageConfig(client.store, ref)
+	if err != nil {
+		return
+	}
+	driver, err := client.storageDriver(opt)
 	if err != nil {
-		entry.Delete()
 		return
 	}
 
-	err = extractImage(image, gzipped, entry.FileSystem())
+	name, entry, err := client.newEntry(opt.Name)
+	if err != nil {
+		return
+	}
+	defer func() {
+		if err != nil {
+			entry.Delete()
+		}
+	}()
 
+	// Stored first, so the layer counts as used from the start
+	err = entry.SetStorage(store.Storage{Layer: digest, Driver: string(driver)})
+	if err != nil {
+		return
+	}
+	layer, err := client.imageLayer(ref, path, gzipped, digest)
 	if err != nil {
-		entry.Delete()
 		return
 	}
 
-	err = setupResolvConf(entry)
+	switch driver {
+	case StorageOverlay:
+		err = errors.Join(
+			os.Mkdir(entry.UpperDir(), 0755),
+			os.Mkdir(entry.WorkDir(), 0700),
+		)
+	case StorageCopy:
+		err = fscopy.Tree(layer, entry.FileSystem())
+	}
+	if err != nil {
+		return name, fmt.Errorf("setting up box file system: %w", err)
+	}
+
+	err = setupResolvConf(entry, driver, layer)
 	if err != nil {
-		entry.Delete()
 		return
 	}
 
+	err = entry.SetConfig(BoxConfig{
+		Version: BoxConfigVersion,
+		Name:    name,
+		Image: ImageRef{
+			Name:   ref,
+			Digest: digest,
+			Config: imageConfig,
+		},
+		Created: time.Now(),
+		Labels:  opt.Labels,
+	})
 	return
 }
 
-func extractImage(image io.ReadCloser, ungzip bool, path string) error {
+func extractImage(image io.Reader, ungzip bool, path string) error {
 	if ungzip {
-		var err error
-		image, err = pgzip.NewReader(image)
+		gzipReader, err := pgzip.NewReader(image)
 		if err != nil {
 			return err
 		}
+		defer gzipReader.Close()
+		image = gzipReader
 	}
-	defer image.Close()
 
-	tr := tar.NewReader(image)
+	return archive.Extract(image, path)
+}
 
-	for {
-		header, err := tr.Next()
+const resolvConf = "nameserver 10.0.2.3\n"
 
-		switch {
-		case err == io.EOF:
+func setupResolvConf(entry *store.StoreEntry, driver StorageDriver, layer string) error {
+	if driver == StorageOverlay {
+		// Written to the upper directory, so the
+		// layer below isn’t modified.
+		info, err := os.Stat(filepath.Join(layer, "etc"))
+		if err != nil {
 			return nil
-		case err != nil:
-			return err
-		case header == nil:
-			continue
 		}
-
-		fpath := filepath.Join(path, header.Name)
-
-		switch header.Typeflag {
-		case tar.TypeDir:
-			if _, err := os.Stat(fpath); err != nil {
-				if err := os.MkdirAll(fpath, 0755); err != nil {
-					return err
-				}
-			}
-		case tar.TypeReg:
-			f, err := os.OpenFile(fpath, os.O_CREATE|os.O_RDWR, os.FileMode(header.Mode))
-			if err != nil {
-				return err
-			}
-
-			defer f.Close()
-
-			if _, err := io.Copy(f, tr); err != nil {
-				return err
-			}
-		case tar.TypeSymlink:
-			if err := os.Symlink(header.Linkname, fpath); err != nil {
-				return err
-			}
+		err = os.Mkdir(filepath.Join(entry.UpperDir(), "etc"), info.Mode().Perm())
+		if err != nil {
+			return err
 		}
+		return os.WriteFile(filepath.Join(entry.UpperDir(), "etc", "resolv.conf"), []byte(resolvConf), 0644)
 	}
-}
-
-const resolvConf = "nameserver 10.0.2.3\n"
 
-func setupResolvConf(entry *store.StoreEntry) error {
 	path := filepath.Join(entry.FileSystem(), "etc", "resolv.conf")
 	if _, err := os.Stat(filepath.Dir(path)); err != nil {
 		return nil
@@ -0,0 +1,92 @@
+package client_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/codingpa-ws/foxbox/client"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateName(t *testing.T) {
+	require := require.New(t)
+	store := newStore(t)
+	foxbox := client.FromStore(store)
+	require.NoError(foxbox.ImportImage("tiny", bytes.NewReader(tinyRootFS(t))))
+
+	name, err := foxbox.Create(&client.CreateOptions{Image: "tiny", Name: "ci-runner-1"})
+	require.NoError(err)
+	require.Equal("ci-runner-1", name)
+	_, err = foxbox.Create(&client.CreateOptions{Image: "tiny", Name: "ci-runner-1"})
+	require.ErrorIs(err, client.ErrNameConflict)
+
+	for _, name := range []string{"..", "ci runner", "-ci", "ci/../runner"} {
+		_, err = foxbox.Create(&client.CreateOptions{Image: "tiny", Name: name})
+		require.ErrorContains(err, "invalid foxbox name", name)
+	}
+	names, err := foxbox.List(nil)
+	require.NoError(err)
+	require.Equal([]string{"ci-runner-1"}, names)
+
+	// The conflicting box is left as is
+	_, err = store.GetEntry("ci-runner-1")
+	require.NoError(err)
+
+	info, err := foxbox.Inspect("ci-run")
+	require.NoError(err)
+	require.Equal("ci-runner-1", info.Name)
+}
+
+func TestLabels(t *testing.T) {
+	require := require.New(t)
+	store := newStore(t)
+	foxbox := client.FromStore(store)
+	require.NoError(foxbox.ImportImage("tiny", bytes.NewReader(tinyRootFS(t))))
+
+	for name, labels := range map[string]map[string]string{
+		"job-1-a": {"job": "1", "role": "db"},
+		"job-1-b": {"job": "1"},
+		"job-2":   {"job": "2", "role": ""},
+		"other":   nil,
+	} {
+		_, err := foxbox.Create(&client.CreateOptions{Image: "tiny", Name: name, Labels: labels})
+		require.NoError(err)
+	}
+	_, err := foxbox.Create(&client.CreateOptions{Image: "tiny", Labels: map[string]string{"a=b": "c"}})
+	require.ErrorContains(err, "invalid label key")
+
+	info, err := foxbox.Inspect("job-1-a")
+	require.NoError(err)
+	require.Equal(map[string]string{"job": "1", "role": "db"}, info.Labels)
+
+	for selectors, want := range map[string][]string{
+		"job=1":        {"job-1-a", "job-1-b"},
+		"role":         {"job-1-a", "job-2"},
+		"role=":        {"job-2"},
+		"job=1,role":   {"job-1-a"},
+		"job=3":        nil,
+		"missing,job=": nil,
+	} {
+		var opt client.ListOptions
+		for _, s := range strings.Split(selectors, ",") {
+			selector, err := client.ParseLabelSelector(s)
+			require.NoError(err)
+			opt.Labels = append(opt.Labels, selector)
+		}
+		names, err := foxbox.List(&opt)
+		require.NoError(err)
+		require.Equal(want, names, selectors)
+
+		infos, err := foxbox.Ps(&client.PsOptions{Labels: opt.Labels})
+		require.NoError(err)
+		names = nil
+		for _, info := range infos {
+			names = append(names, info.ID)
+		}
+		require.Equal(want, names, selectors)
+	}
+
+	_, err = client.ParseLabelSelector("=1")
+	require.Error(err)
+}
@@ -1,8 +1,18 @@
 package client
 
+import (
+	"errors"
+	"fmt"
+	"os"
+)
+
+var ErrBoxRunning = errors.New("box is running")
+
 type DeleteOptions struct {
 }
 
+// Removes a box. Running boxes are kept and ErrBoxRunning is
+// returned, as their processes couldn’t be reached anymore.
 func (client *client) Delete(name string, opt *DeleteOptions) (err error) {
 	entry, err := client.store.GetEntry(name)
 
@@ -10,5 +20,18 @@ func (client *client) Delete(name string, opt *DeleteOptions) (err error) {
 		return
 	}
 
-	return entry.Delete()
+	pid, running, err := entry.GetPID()
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("getting box pid: %w", err)
+	}
+	if running {
+		return fmt.Errorf("%w with pid %d, stop it first", ErrBoxRunning, pid)
+	}
+
+	err = entry.Delete()
+	if err != nil {
+		return
+	}
+
+	return client.removeUnusedLayers()
 }
@@ -0,0 +1,39 @@
+package client_test
+
+import (
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/codingpa-ws/foxbox/client"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeleteRunning(t *testing.T) {
+	require := require.New(t)
+	if testing.Short() {
+		t.Skip("integration test is slow")
+	}
+
+	store := newStore(t)
+	downloadImage(t, store)
+	foxbox := client.FromStore(store)
+	name, err := foxbox.Create(&client.CreateOptions{Image: AlpineImageName})
+	require.NoError(err)
+	require.NoError(foxbox.Run(name, &client.RunOptions{
+		Command: []string{"sleep", "30"},
+		Detach:  true,
+	}))
+
+	require.ErrorIs(foxbox.Delete(name, nil), client.ErrBoxRunning)
+	names, err := foxbox.List(nil)
+	require.NoError(err)
+	require.Equal([]string{name}, names)
+
+	require.NoError(foxbox.Kill(name, syscall.SIGKILL))
+	require.Eventually(func() bool {
+		info, err := foxbox.Inspect(name)
+		return err == nil && info.State.Status == client.StateExited
+	}, 5*time.Second, 10*time.Millisecond)
+	require.NoError(foxbox.Delete(name, nil))
+}
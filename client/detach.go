@@ -0,0 +1,156 @@
+package client
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"syscall"
+
+	"github.com/codingpa-ws/foxbox/internal/store"
+)
+
+// The supervisor reports back on this file descriptor
+// (the first of cmd.ExtraFiles) once the box has started.
+const supervisorReadyFd = 3
+
+const supervisorReady = "ready"
+
+// Starts a supervisor process that owns the box process, its slirp
+// process and its cgroup. The supervisor is placed in a new session,
+// so it outlives the calling process.
+func detach(name string, store *store.Store, entry *store.StoreEntry, opt *RunOptions) error {
+	_, running, err := entry.GetPID()
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("getting pid of potentially conflicting process: %w", err)
+	}
+	if running {
+		return fmt.Errorf("already running, use client.Exec")
+	}
+	executable, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("finding foxbox executable: %w", err)
+	}
+
+	options, err := encodeRunOptions(opt)
+	if err != nil {
+		return fmt.Errorf("encoding run options: %w", err)
+	}
+
+	null, err := os.OpenFile(os.DevNull, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	defer null.Close()
+
+	ready, readyWriter, err := os.Pipe()
+	if err != nil {
+		return fmt.Errorf("creating supervisor pipe: %w", err)
+	}
+	defer ready.Close()
+
+	cmd := exec.Command(executable)
+	cmd.Stdin = null
+	cmd.Stdout = null
+	cmd.Stderr = null
+	cmd.Env = append(
+		os.Environ(),
+		"FOXBOX_SUPERVISE="+name,
+		"FOXBOX_STORE="+store.Base(),
+		"FOXBOX_RUN_OPTIONS="+options,
+	)
+	cmd.ExtraFiles = []*os.File{readyWriter}
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+
+	err = cmd.Start()
+	readyWriter.Close()
+	if err != nil {
+		return fmt.Errorf("starting supervisor: %w", err)
+	}
+
+	status, _ := io.ReadAll(ready)
+	if string(status) != supervisorReady {
+		cmd.Wait()
+		if len(status) == 0 {
+			return fmt.Errorf("supervisor exited with status %d before the box started", cmd.ProcessState.ExitCode())
+		}
+		return fmt.Errorf("starting detached box: %s", status)
+	}
+
+	// Reap the supervisor if we happen to outlive it.
+	go cmd.Wait()
+
+	return nil
+}
+
+// Entrypoint of the supervisor process started by detach. The box
+// inherits the supervisor’s standard streams, which point to /dev/null.
+func supervise() error {
+	// Keep the box and slirp from inheriting the pipe, which
+	// would block detach until the box exits.
+	syscall.CloseOnExec(supervisorReadyFd)
+	ready := os.NewFile(supervisorReadyFd, "ready")
+	defer ready.Close()
+
+	box, err := startSupervised()
+	if err != nil {
+		fmt.Fprint(ready, err)
+		return err
+	}
+
+	_, err = fmt.Fprint(ready, supervisorReady)
+	if err != nil {
+		return errors.Join(err, box.release())
+	}
+	ready.Close()
+
+	return box.wait()
+}
+
+func startSupervised() (*box, error) {
+	name := os.Getenv("FOXBOX_SUPERVISE")
+
+	store, err := store.New(os.Getenv("FOXBOX_STORE"))
+	if err != nil {
+		return nil, fmt.Errorf("opening store: %w", err)
+	}
+	entry, err := store.GetEntry(name)
+	if err != nil {
+		return nil, fmt.Errorf("opening box %s: %w", name, err)
+	}
+	opt, err := decodeRunOptions(os.Getenv("FOXBOX_RUN_OPTIONS"))
+	if err != nil {
+		return nil, fmt.Errorf("decoding run options: %w", err)
+	}
+
+	return start(name, entry, opt)
+}
+
+func encodeRunOptions(opt *RunOptions) (string, error) {
+	encoded := *opt
+	encoded.Stdin = nil
+	encoded.Stdout = nil
+	encoded.Stderr = nil
+
+	buf := new(bytes.Buffer)
+	err := gob.NewEncoder(buf).Encode(encoded)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%x", buf.String()), nil
+}
+
+func decodeRunOptions(data string) (*RunOptions, error) {
+	var b []byte
+	_, err := fmt.Sscanf(data, "%x", &b)
+	if err != nil {
+		return nil, err
+	}
+	opt := new(RunOptions)
+	err = gob.NewDecoder(bytes.NewReader(b)).Decode(opt)
+	return opt, err
+}
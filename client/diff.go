@@ -0,0 +1,99 @@
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/codingpa-ws/foxbox/internal/fsdiff"
+	"github.com/codingpa-ws/foxbox/internal/store"
+)
+
+type ChangeKind string
+
+const (
+	ChangeAdded   ChangeKind = ChangeKind(fsdiff.Added)
+	ChangeChanged ChangeKind = ChangeKind(fsdiff.Changed)
+	ChangeDeleted ChangeKind = ChangeKind(fsdiff.Deleted)
+)
+
+type Change struct {
+	// Relative to the box root and separated by slashes
+	Path string     `json:"path"`
+	Kind ChangeKind `json:"kind"`
+}
+
+// Returns the changes of a box to its image, sorted by path. Files are
+// compared by type, permissions, link target and content hash. Files
+// foxbox creates when running boxes are left out like with Commit.
+func (client *client) Diff(name string) (changes []Change, err error) {
+	buf := new(bytes.Buffer)
+	err = client.diff(name, false, buf)
+	if err != nil {
+		return
+	}
+	err = json.Unmarshal(buf.Bytes(), &changes)
+	if err != nil {
+		return nil, fmt.Errorf("decoding changes: %w", err)
+	}
+	return
+}
+
+// Writes the changes of a box to its image as OCI image layer,
+// where deleted paths become whiteouts.
+func (client *client) DiffLayer(name string, w io.Writer) (err error) {
+	return client.diff(name, true, w)
+}
+
+func (client *client) diff(name string, layer bool, w io.Writer) error {
+	entry, err := client.store.GetEntry(name)
+	if err != nil {
+		return err
+	}
+	name = entry.Name()
+	base, err := client.boxLayer(entry)
+	if err != nil {
+		return err
+	}
+	err = client.runBoxFS(name, boxFSOp{Diff: true, Base: base, Layer: layer, SkipRuntime: true}, nil, w)
+	if err != nil {
+		return fmt.Errorf("comparing box %s: %w", name, err)
+	}
+	return nil
+}
+
+// Returns the layer of the image the box was created from.
+func (client *client) boxLayer(entry *store.StoreEntry) (string, error) {
+	storage, err := entry.GetStorage()
+	if err == nil {
+		layer, err := client.store.LayerPath(storage.Layer)
+		if err != nil {
+			return "", err
+		}
+		_, err = os.Stat(layer)
+		return layer, err
+	}
+	if !os.IsNotExist(err) {
+		return "", fmt.Errorf("reading box storage: %w", err)
+	}
+
+	// Boxes created before layers were shared
+	config, err := getBoxConfig(entry)
+	if err != nil {
+		return "", fmt.Errorf("reading box config: %w", err)
+	}
+	ref, path, gzipped, err := findImage(client.store, config.Image.Name)
+	if err != nil {
+		return "", err
+	}
+	digest, err := imageDigest(client.store, ref, path)
+	if err != nil {
+		return "", err
+	}
+	if config.Image.Digest != "" && digest != config.Image.Digest {
+		return "", fmt.Errorf("image %s changed since the box was created", ref)
+	}
+	return client.imageLayer(ref, path, gzipped, digest)
+}
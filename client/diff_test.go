@@ -0,0 +1,70 @@
+package client_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/codingpa-ws/foxbox/client"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiff(t *testing.T) {
+	for _, driver := range []client.StorageDriver{client.StorageOverlay, client.StorageCopy} {
+		driver := driver
+		t.Run(string(driver), func(t *testing.T) {
+			require := require.New(t)
+			store := newStore(t)
+			foxbox := client.FromStore(store)
+			require.NoError(foxbox.ImportImage("tiny", bytes.NewReader(tinyRootFS(t))))
+
+			name, err := foxbox.Create(&client.CreateOptions{Image: "tiny", StorageDriver: driver})
+			require.NoError(err)
+			entry, err := store.GetEntry(name)
+			require.NoError(err)
+			changes := entry.FileSystem()
+			if driver == client.StorageOverlay {
+				changes = entry.UpperDir()
+			}
+			require.NoError(os.MkdirAll(filepath.Join(changes, "usr", "bin"), 0755))
+			require.NoError(os.WriteFile(filepath.Join(changes, "usr", "bin", "tool"), []byte("tool"), 0644))
+			require.NoError(os.MkdirAll(filepath.Join(changes, "tmp"), 0755))
+			require.NoError(os.WriteFile(filepath.Join(changes, "tmp", "scratch"), nil, 0644))
+			want := []client.Change{
+				{Path: "etc/hostname", Kind: client.ChangeChanged},
+				{Path: "usr", Kind: client.ChangeAdded},
+				{Path: "usr/bin", Kind: client.ChangeAdded},
+				{Path: "usr/bin/tool", Kind: client.ChangeAdded},
+			}
+			if driver == client.StorageCopy {
+				// Deleting from overlays takes a whiteout device
+				require.NoError(os.RemoveAll(filepath.Join(changes, "etc")))
+				want[0] = client.Change{Path: "etc", Kind: client.ChangeDeleted}
+			} else {
+				require.NoError(os.WriteFile(filepath.Join(changes, "etc", "hostname"), []byte("changed\n"), 0644))
+			}
+
+			diff, err := foxbox.Diff(name)
+			if driver == client.StorageOverlay && err != nil {
+				t.Skipf("mounting overlays is not supported: %s", err)
+			}
+			require.NoError(err)
+			require.Equal(want, diff)
+
+			buf := new(bytes.Buffer)
+			require.NoError(foxbox.DiffLayer(name, buf))
+			var names []string
+			tr := tar.NewReader(buf)
+			for header, err := tr.Next(); err == nil; header, err = tr.Next() {
+				names = append(names, header.Name)
+			}
+			wantNames := []string{"etc/hostname", "usr/", "usr/bin/", "usr/bin/tool"}
+			if driver == client.StorageCopy {
+				wantNames[0] = ".wh.etc"
+			}
+			require.ElementsMatch(wantNames, names)
+		})
+	}
+}
@@ -0,0 +1,147 @@
+package client
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"syscall"
+
+	"github.com/codingpa-ws/foxbox/internal/cgroup2"
+	"github.com/codingpa-ws/foxbox/internal/nsenter"
+	"github.com/codingpa-ws/foxbox/internal/security"
+)
+
+type ExecOptions struct {
+	Command []string
+
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+}
+
+func (self ExecOptions) getStdin() io.Reader {
+	if self.Stdin == nil {
+		return os.Stdin
+	}
+	return self.Stdin
+}
+
+func (self ExecOptions) getStdout() io.Writer {
+	if self.Stdout == nil {
+		return os.Stdout
+	}
+	return self.Stdout
+}
+
+func (self ExecOptions) getStderr() io.Writer {
+	if self.Stderr == nil {
+		return os.Stderr
+	}
+	return self.Stderr
+}
+
+func init() {
+	if _, ok := os.LookupEnv(nsenter.EnvPID); ok {
+		err := execChild()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+}
+
+// Runs an additional process in the namespaces of a running box.
+// A non-zero exit code is returned as *exec.ExitError.
+func (client *client) Exec(name string, opt *ExecOptions) (err error) {
+	opt = newOr(opt)
+
+	entry, err := client.store.GetEntry(name)
+	if err != nil {
+		return
+	}
+	name = entry.Name()
+	pid, running, err := entry.GetPID()
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("getting box pid: %w", err)
+	}
+	if !running {
+		return fmt.Errorf("box %s is not running", name)
+	}
+	executable, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("finding foxbox executable: %w", err)
+	}
+
+	image, err := boxImageConfig(entry)
+	if err != nil {
+		return fmt.Errorf("reading image config: %w", err)
+	}
+	process, err := encodeProcess(newExecProcess(image, opt))
+	if err != nil {
+		return
+	}
+
+	cmd := exec.Command(executable)
+	cmd.Stdin = opt.getStdin()
+	cmd.Stdout = opt.getStdout()
+	cmd.Stderr = opt.getStderr()
+	cmd.Env = []string{nsenter.EnvPID + "=" + strconv.Itoa(pid), "FOXBOX_PROCESS=" + process}
+
+	// Join the box’s cgroup so its limits apply to us as well
+	if cgroup, ok := boxCGroup(name, pid); ok {
+		cgroupDir, err := os.Open(cgroup.Path())
+		if err != nil {
+			return fmt.Errorf("opening cgroup dir: %w", err)
+		}
+		defer cgroupDir.Close()
+		cmd.SysProcAttr = &syscall.SysProcAttr{
+			CgroupFD:    int(cgroupDir.Fd()),
+			UseCgroupFD: true,
+		}
+	}
+
+	return cmd.Run()
+}
+
+// Returns the cgroup of a running box if the box has its own.
+func boxCGroup(name string, pid int) (*cgroup2.CGroup, bool) {
+	if os.Getenv("CI_NO_CGROUP") != "" {
+		return nil, false
+	}
+	cgroup, err := cgroup2.OfProcess(pid)
+	if err != nil || cgroup.Name() != "foxbox-"+name {
+		return nil, false
+	}
+	return cgroup, true
+}
+
+// Runs inside the box after the nsenter constructor
+// has joined its namespaces and changed the root.
+func execChild() (err error) {
+	err = security.DropCapabilities()
+	if err != nil {
+		return fmt.Errorf("dropping capabilities: %w", err)
+	}
+	err = security.RestrictSyscalls()
+	if err != nil {
+		return fmt.Errorf("restricting syscalls: %w", err)
+	}
+	return execProcess()
+}
+
+// Additional processes get the environment and working
+// directory of the image, but not its entrypoint.
+func newExecProcess(image *ImageConfig, opt *ExecOptions) process {
+	image = newOr(image)
+	args := opt.Command
+	if len(args) == 0 {
+		args = []string{"/bin/sh"}
+	}
+	return process{
+		Args:    args,
+		Env:     mergeEnv(defaultEnv, image.Env),
+		WorkDir: image.WorkingDir,
+	}
+}
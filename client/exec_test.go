@@ -0,0 +1,52 @@
+package client_test
+
+import (
+	"errors"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/codingpa-ws/foxbox/client"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExec(t *testing.T) {
+	require := require.New(t)
+	if testing.Short() {
+		t.Skip("integration test is slow")
+	}
+
+	store := newStore(t)
+	downloadImage(t, store)
+
+	foxbox := client.FromStore(store)
+	name, err := foxbox.Create(&client.CreateOptions{
+		Image: AlpineImageName,
+	})
+	require.NoError(err)
+
+	err = foxbox.Exec(name, &client.ExecOptions{
+		Command: []string{"true"},
+	})
+	require.Error(err, "exec must fail for boxes that aren’t running")
+
+	err = foxbox.Start(name, &client.RunOptions{
+		Command: []string{"sh", "-c", "echo started > /tmp/marker; sleep 1"},
+	})
+	require.NoError(err)
+
+	stdout := new(strings.Builder)
+	err = foxbox.Exec(name, &client.ExecOptions{
+		Command: []string{"sh", "-c", "hostname; cat /tmp/marker"},
+		Stdout:  stdout,
+	})
+	require.NoError(err)
+	require.Equal(name+"\nstarted\n", stdout.String())
+
+	err = foxbox.Exec(name, &client.ExecOptions{
+		Command: []string{"sh", "-c", "exit 4"},
+	})
+	var exitError *exec.ExitError
+	require.True(errors.As(err, &exitError), "expected *exec.ExitError, got %v", err)
+	require.Equal(4, exitError.ExitCode())
+}
@@ -0,0 +1,118 @@
+package client
+
+import (
+	"archive/tar"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// Version of the box archive format written by ExportBox.
+const BoxArchiveVersion = 1
+
+const (
+	boxArchiveManifest   = "box.json"
+	boxArchiveFileSystem = "boxfs"
+)
+
+// Written as box.json at the start of box archives, followed
+// by the file system of the box with names below boxfs/.
+type boxManifest struct {
+	Version int       `json:"version"`
+	Config  BoxConfig `json:"config"`
+}
+
+// Writes a box as tar archive, containing its config and file system,
+// which ImportBox restores. Files foxbox creates when running boxes
+// are left out like with Commit.
+func (client *client) ExportBox(name string, w io.Writer) (err error) {
+	entry, err := client.store.GetEntry(name)
+	if err != nil {
+		return
+	}
+	name = entry.Name()
+	config, err := getBoxConfig(entry)
+	if os.IsNotExist(err) {
+		config = BoxConfig{Version: BoxConfigVersion, Name: name}
+	} else if err != nil {
+		return fmt.Errorf("reading box config: %w", err)
+	}
+	manifest, err := json.MarshalIndent(boxManifest{BoxArchiveVersion, config}, "", "  ")
+	if err != nil {
+		return
+	}
+
+	tw := tar.NewWriter(w)
+	now := time.Now()
+	err = tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     boxArchiveManifest,
+		Mode:     0644,
+		Size:     int64(len(manifest)),
+		ModTime:  now,
+	})
+	if err != nil {
+		return
+	}
+	_, err = tw.Write(manifest)
+	if err != nil {
+		return
+	}
+	err = tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeDir,
+		Name:     boxArchiveFileSystem + "/",
+		Mode:     0755,
+		ModTime:  now,
+	})
+	if err != nil {
+		return
+	}
+
+	r, pw := io.Pipe()
+	archived := make(chan error, 1)
+	go func() {
+		err := client.runBoxFS(name, boxFSOp{Archive: true, SkipRuntime: true}, nil, pw)
+		pw.CloseWithError(err)
+		archived <- err
+	}()
+	err = copyBelow(tar.NewReader(r), tw, boxArchiveFileSystem)
+	// Unblocks archiving if writing failed
+	r.Close()
+	// Reading fails with the error of archiving, or archiving
+	// fails because writing stopped reading
+	if archiveErr := <-archived; err == nil || errors.Is(err, archiveErr) {
+		err = archiveErr
+	}
+	if err != nil {
+		return fmt.Errorf("exporting box %s: %w", name, err)
+	}
+	return tw.Close()
+}
+
+// Copies the entries of tr to tw, moving them below dir.
+func copyBelow(tr *tar.Reader, tw *tar.Writer, dir string) error {
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		header.Name = dir + "/" + header.Name
+		if header.Typeflag == tar.TypeLink {
+			header.Linkname = dir + "/" + header.Linkname
+		}
+		err = tw.WriteHeader(header)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(tw, tr)
+		if err != nil {
+			return err
+		}
+	}
+}
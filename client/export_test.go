@@ -0,0 +1,159 @@
+package client_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/codingpa-ws/foxbox/client"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExportImport(t *testing.T) {
+	for _, driver := range []client.StorageDriver{client.StorageOverlay, client.StorageCopy} {
+		driver := driver
+		t.Run(string(driver), func(t *testing.T) {
+			require := require.New(t)
+			store := newStore(t)
+			foxbox := client.FromStore(store)
+			require.NoError(foxbox.ImportImage("tiny", bytes.NewReader(tinyRootFS(t))))
+
+			name, err := foxbox.Create(&client.CreateOptions{Image: "tiny", StorageDriver: driver})
+			require.NoError(err)
+			entry, err := store.GetEntry(name)
+			require.NoError(err)
+			changes := entry.FileSystem()
+			if driver == client.StorageOverlay {
+				changes = entry.UpperDir()
+			}
+			require.NoError(os.MkdirAll(filepath.Join(changes, "data"), 0755))
+			require.NoError(os.WriteFile(filepath.Join(changes, "data", "state"), []byte("state"), 0644))
+
+			archive := filepath.Join(t.TempDir(), "box.tar")
+			f, err := os.Create(archive)
+			require.NoError(err)
+			err = foxbox.ExportBox(name, f)
+			require.NoError(f.Close())
+			if driver == client.StorageOverlay && err != nil {
+				t.Skipf("mounting overlays is not supported: %s", err)
+			}
+			require.NoError(err)
+
+			// The exported name is taken by the original box
+			imported, err := foxbox.ImportBox(archive, nil)
+			require.NoError(err)
+			require.NotEqual(name, imported)
+			_, err = foxbox.ImportBox(archive, &client.ImportBoxOptions{Name: imported})
+			require.ErrorIs(err, client.ErrNameConflict)
+			moved, err := foxbox.ImportBox(archive, &client.ImportBoxOptions{Name: "moved"})
+			require.NoError(err)
+			require.Equal("moved", moved)
+
+			info, err := foxbox.Inspect(moved)
+			require.NoError(err)
+			require.Equal("moved", info.Name)
+			require.Equal("tiny", info.Image.Name)
+			entry, err = store.GetEntry(moved)
+			require.NoError(err)
+			content, err := os.ReadFile(filepath.Join(entry.FileSystem(), "data", "state"))
+			require.NoError(err)
+			require.Equal("state", string(content))
+			content, err = os.ReadFile(filepath.Join(entry.FileSystem(), "etc", "hostname"))
+			require.NoError(err)
+			require.Equal("fox\n", string(content))
+
+			diff, err := foxbox.Diff(moved)
+			require.NoError(err)
+			require.Equal([]client.Change{
+				{Path: "data", Kind: client.ChangeAdded},
+				{Path: "data/state", Kind: client.ChangeAdded},
+			}, diff)
+		})
+	}
+}
+
+// Writes a box archive with the manifest and entries, filling in
+// the contents of box.json.
+func writeBoxArchive(t *testing.T, manifest string, entries []tar.Header) string {
+	require := require.New(t)
+	buf := new(bytes.Buffer)
+	tw := tar.NewWriter(buf)
+	for _, header := range entries {
+		header := header
+		if header.Name == "box.json" {
+			header.Size = int64(len(manifest))
+		}
+		require.NoError(tw.WriteHeader(&header))
+		if header.Name == "box.json" {
+			_, err := tw.Write([]byte(manifest))
+			require.NoError(err)
+		}
+	}
+	require.NoError(tw.Close())
+	archive := filepath.Join(t.TempDir(), "box.tar")
+	require.NoError(os.WriteFile(archive, buf.Bytes(), 0644))
+	return archive
+}
+
+func TestImportInvalid(t *testing.T) {
+	require := require.New(t)
+	store := newStore(t)
+	foxbox := client.FromStore(store)
+	manifest := `{"version": 1, "config": {"version": 1, "name": "box"}}`
+
+	for reason, entries := range map[string][]tar.Header{
+		"box.json is missing": {{Name: "boxfs/", Typeflag: tar.TypeDir}},
+		"unexpected entry":    {{Name: "box.json"}, {Name: "boxfs/../escape"}},
+		"outside of boxfs":    {{Name: "box.json"}, {Name: "boxfs/link", Typeflag: tar.TypeLink, Linkname: "/etc/passwd"}},
+		"unsupported type":    {{Name: "box.json"}, {Name: "boxfs/x", Typeflag: 'Z'}},
+		// Would write to the box metadata, like its pid
+		"boxfs must be a directory": {
+			{Name: "box.json"},
+			{Name: "boxfs", Typeflag: tar.TypeSymlink, Linkname: "/"},
+			{Name: "boxfs/container.pid"},
+		},
+		"below symlink": {
+			{Name: "box.json"},
+			{Name: "boxfs/etc/passwd"},
+			{Name: "boxfs/etc", Typeflag: tar.TypeSymlink, Linkname: "/etc"},
+		},
+	} {
+		_, err := foxbox.ImportBox(writeBoxArchive(t, manifest, entries), nil)
+		require.ErrorContains(err, reason)
+		names, err := foxbox.List(nil)
+		require.NoError(err)
+		require.Empty(names)
+	}
+
+	// Labels that selectors couldn’t match
+	for _, labels := range []string{`{"": "x"}`, `{"a=b": "c"}`} {
+		manifest := `{"version": 1, "config": {"version": 1, "name": "box", "labels": ` + labels + `}}`
+		_, err := foxbox.ImportBox(writeBoxArchive(t, manifest, []tar.Header{{Name: "box.json"}}), nil)
+		require.ErrorContains(err, "invalid label key", labels)
+		names, err := foxbox.List(nil)
+		require.NoError(err)
+		require.Empty(names)
+	}
+}
+
+func TestImportConfig(t *testing.T) {
+	require := require.New(t)
+	store := newStore(t)
+	foxbox := client.FromStore(store)
+	manifest := `{"version": 1, "config": {"version": 1, "name": "box", "labels": {"job": "42"},
+		"run": {"command": ["sh"], "volumes": [{"hostPath": "/home/other", "boxPath": "/data"}]}}}`
+
+	name, err := foxbox.ImportBox(writeBoxArchive(t, manifest, []tar.Header{
+		{Name: "box.json"},
+		{Name: "boxfs/", Typeflag: tar.TypeDir},
+	}), nil)
+	require.NoError(err)
+	entry, err := store.GetEntry(name)
+	require.NoError(err)
+	var config client.BoxConfig
+	require.NoError(entry.GetConfig(&config))
+	require.Equal(map[string]string{"job": "42"}, config.Labels)
+	require.Nil(config.Run, "imported boxes have never run on this host")
+}
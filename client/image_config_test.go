@@ -0,0 +1,73 @@
+package client_test
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/codingpa-ws/foxbox/client"
+	"github.com/stretchr/testify/require"
+)
+
+func TestImageConfig(t *testing.T) {
+	if testing.Short() {
+		t.Skip("integration test is slow")
+	}
+	require := require.New(t)
+
+	store := newStore(t)
+	downloadImage(t, store)
+	// Written by hand like a sidecar next to the image
+	meta, err := json.Marshal(map[string]any{"config": client.ImageConfig{
+		Entrypoint: []string{"/bin/sh", "-c"},
+		Cmd:        []string{"echo $FOX $PWD"},
+		Env:        []string{"FOX=image", "PATH=/usr/bin:/bin"},
+		WorkingDir: "/srv/app",
+	}})
+	require.NoError(err)
+	require.NoError(os.WriteFile(store.GetImageMetaPath(AlpineImageName), meta, 0644))
+
+	foxbox := client.FromStore(store)
+	name, err := foxbox.Create(&client.CreateOptions{Image: AlpineImageName})
+	require.NoError(err)
+
+	runBox := func(opt client.RunOptions) (string, error) {
+		stdout := new(strings.Builder)
+		opt.Stdout = stdout
+		err := foxbox.Run(name, &opt)
+		return stdout.String(), err
+	}
+
+	stdout, err := runBox(client.RunOptions{})
+	require.NoError(err)
+	require.Equal("image /srv/app\n", stdout)
+
+	stdout, err = runBox(client.RunOptions{
+		Command: []string{"echo $FOX $PWD $LANG"},
+		Env:     []string{"FOX=override"},
+		WorkDir: "/tmp",
+	})
+	require.NoError(err)
+	require.Equal("override /tmp C.UTF-8\n", stdout)
+
+	// Found in the image’s PATH without a shell
+	stdout, err = runBox(client.RunOptions{
+		Entrypoint: []string{"env"},
+	})
+	require.NoError(err)
+	require.Contains(stdout, "FOX=image\n")
+	require.Contains(stdout, "PATH=/usr/bin:/bin\n")
+
+	stdout, err = runBox(client.RunOptions{
+		Entrypoint: []string{""},
+		Command:    []string{"pwd"},
+	})
+	require.NoError(err)
+	require.Equal("/srv/app\n", stdout)
+
+	_, err = runBox(client.RunOptions{User: "root:root"})
+	require.NoError(err)
+	_, err = runBox(client.RunOptions{User: "nobody"})
+	require.Error(err)
+}
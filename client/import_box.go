@@ -0,0 +1,199 @@
+package client
+
+import (
+	"archive/tar"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/codingpa-ws/foxbox/internal/archive"
+)
+
+type ImportBoxOptions struct {
+	// Name of the imported box, defaults to the name in the archive
+	// or a new name if a box of that name exists
+	Name string
+}
+
+// Creates a box from an archive written by ExportBox. The archive is
+// validated before anything is written. Imported boxes have a copy of
+// their file system rather than sharing the layer of their image.
+func (client *client) ImportBox(path string, opt *ImportBoxOptions) (name string, err error) {
+	opt = newOr(opt)
+	f, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	manifest, err := readBoxArchive(f)
+	if err != nil {
+		return "", fmt.Errorf("invalid box archive: %w", err)
+	}
+	_, err = f.Seek(0, io.SeekStart)
+	if err != nil {
+		return
+	}
+
+	name = opt.Name
+	if name == "" {
+		name = manifest.Config.Name
+	}
+	name, entry, err := client.newEntry(name)
+	if errors.Is(err, ErrNameConflict) && opt.Name == "" {
+		name, entry, err = client.newEntry("")
+	}
+	if err != nil {
+		return
+	}
+	defer func() {
+		if err != nil {
+			entry.Delete()
+		}
+	}()
+
+	r, w := io.Pipe()
+	filtered := make(chan error, 1)
+	go func() {
+		err := filterBoxArchive(f, w)
+		w.CloseWithError(err)
+		filtered <- err
+	}()
+	err = archive.Extract(r, entry.FileSystem())
+	// Unblocks filtering if extracting failed
+	r.Close()
+	// Filtering only fails with io.ErrClosedPipe if extracting failed
+	if filterErr := <-filtered; filterErr != nil && !errors.Is(filterErr, io.ErrClosedPipe) {
+		err = filterErr
+	}
+	if err != nil {
+		return name, fmt.Errorf("extracting box file system: %w", err)
+	}
+
+	err = setupResolvConf(entry, StorageCopy, "")
+	if err != nil {
+		return
+	}
+	config := manifest.Config
+	config.Version = BoxConfigVersion
+	config.Name = name
+	// Volumes and other options refer to the host it ran on
+	config.Run = nil
+	err = entry.SetConfig(config)
+	return
+}
+
+// Reads the manifest of a box archive and checks that all other
+// entries are below the boxfs/ directory and of types that can be
+// extracted, and that no entries are below symlinks.
+func readBoxArchive(r io.Reader) (manifest *boxManifest, err error) {
+	var names []string
+	symlinks := map[string]bool{}
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if header.Name == boxArchiveManifest {
+			if manifest != nil {
+				return nil, fmt.Errorf("more than one %s", boxArchiveManifest)
+			}
+			manifest = new(boxManifest)
+			err = json.NewDecoder(io.LimitReader(tr, 1<<20)).Decode(manifest)
+			if err != nil {
+				return nil, fmt.Errorf("decoding %s: %w", boxArchiveManifest, err)
+			}
+			continue
+		}
+
+		if !inBoxArchiveFileSystem(header.Name) {
+			return nil, fmt.Errorf("unexpected entry %s", header.Name)
+		}
+		name := path.Clean(header.Name)
+		if name == boxArchiveFileSystem && header.Typeflag != tar.TypeDir {
+			return nil, fmt.Errorf("%s must be a directory", boxArchiveFileSystem)
+		}
+		names = append(names, name)
+		switch header.Typeflag {
+		case tar.TypeLink:
+			if !inBoxArchiveFileSystem(header.Linkname) {
+				return nil, fmt.Errorf("hardlink %s to %s outside of %s", header.Name, header.Linkname, boxArchiveFileSystem)
+			}
+		case tar.TypeSymlink:
+			symlinks[name] = true
+		case tar.TypeDir, tar.TypeReg, tar.TypeGNUSparse, tar.TypeFifo, tar.TypeChar, tar.TypeBlock:
+		default:
+			return nil, fmt.Errorf("unsupported type %q of %s", header.Typeflag, header.Name)
+		}
+	}
+	// Exports never contain them, while extracting would
+	// resolve them, in whichever order entries come
+	for _, name := range names {
+		for dir := path.Dir(name); dir != "."; dir = path.Dir(dir) {
+			if symlinks[dir] {
+				return nil, fmt.Errorf("entry %s below symlink %s", name, dir)
+			}
+		}
+	}
+
+	switch {
+	case manifest == nil:
+		return nil, fmt.Errorf("%s is missing", boxArchiveManifest)
+	case manifest.Version > BoxArchiveVersion:
+		return nil, fmt.Errorf("box archive version %d is not supported (latest is %d)", manifest.Version, BoxArchiveVersion)
+	case manifest.Config.Version > BoxConfigVersion:
+		return nil, fmt.Errorf("box config version %d is not supported (latest is %d)", manifest.Config.Version, BoxConfigVersion)
+	}
+	err = validateLabels(manifest.Config.Labels)
+	if err != nil {
+		return nil, err
+	}
+	return
+}
+
+func inBoxArchiveFileSystem(name string) bool {
+	name = path.Clean(name)
+	return name == boxArchiveFileSystem || strings.HasPrefix(name, boxArchiveFileSystem+"/")
+}
+
+// Copies the entries below boxfs/ of a box archive, named
+// relative to it.
+func filterBoxArchive(r io.Reader, w io.Writer) error {
+	tr := tar.NewReader(r)
+	tw := tar.NewWriter(w)
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return tw.Close()
+		}
+		if err != nil {
+			return err
+		}
+		name, ok := strings.CutPrefix(path.Clean(header.Name), boxArchiveFileSystem+"/")
+		if !ok {
+			// The manifest and the box file system directory
+			continue
+		}
+		header.Name = name
+		if header.Typeflag == tar.TypeLink {
+			header.Linkname = strings.TrimPrefix(path.Clean(header.Linkname), boxArchiveFileSystem+"/")
+		}
+		err = tw.WriteHeader(header)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(tw, tr)
+		if err != nil {
+			return err
+		}
+	}
+}
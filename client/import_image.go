@@ -0,0 +1,144 @@
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+	xzMagic   = []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}
+)
+
+// Stores a rootfs tarball as image with the given name, replacing
+// an existing image of that name. The tarball may be uncompressed
+// or compressed with gzip, zstd or xz (requires the xz binary).
+func (client *client) ImportImage(name string, r io.Reader) error {
+	err := validateImageName(name)
+	if err != nil {
+		return err
+	}
+
+	buffered := bufio.NewReader(r)
+	magic, err := buffered.Peek(len(xzMagic))
+	if err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("reading image: %w", err)
+	}
+
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		// Stored as is, extraction handles gzip
+		return client.writeImage(name, true, nil, func(w io.Writer) error {
+			_, err := io.Copy(w, buffered)
+			return err
+		})
+	case bytes.HasPrefix(magic, zstdMagic):
+		return client.writeImage(name, false, nil, func(w io.Writer) error {
+			decoder, err := zstd.NewReader(buffered)
+			if err != nil {
+				return err
+			}
+			defer decoder.Close()
+			_, err = io.Copy(w, decoder)
+			if err != nil {
+				return fmt.Errorf("decompressing zstd: %w", err)
+			}
+			return nil
+		})
+	case bytes.HasPrefix(magic, xzMagic):
+		return client.writeImage(name, false, nil, func(w io.Writer) error {
+			return unxz(buffered, w)
+		})
+	default:
+		return client.writeImage(name, false, nil, func(w io.Writer) error {
+			_, err := io.Copy(w, buffered)
+			return err
+		})
+	}
+}
+
+// Names starting with a dot, such as "..", are rejected
+// like hidden files.
+func validateImageName(name string) error {
+	if strings.TrimSpace(name) == "" || strings.Contains(name, "/") || strings.HasPrefix(name, ".") {
+		return fmt.Errorf("invalid image name %q", name)
+	}
+	return nil
+}
+
+func unxz(r io.Reader, w io.Writer) error {
+	stderr := new(strings.Builder)
+	cmd := exec.Command("xz", "--decompress", "--stdout")
+	cmd.Stdin = r
+	cmd.Stdout = w
+	cmd.Stderr = stderr
+	err := cmd.Run()
+	if errors.Is(err, exec.ErrNotFound) {
+		return fmt.Errorf("decompressing xz: install xz or decompress the image first: %w", err)
+	}
+	if err != nil {
+		return fmt.Errorf("decompressing xz: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+// Stores an image by writing it to a temporary file first,
+// so the image is only replaced once write succeeded.
+// config is stored as image metadata unless it is nil.
+func (client *client) writeImage(name string, gzipped bool, config *ImageConfig, write func(io.Writer) error) (err error) {
+	tmp, err := os.CreateTemp(client.store.ImageBase(), ".tmp-*")
+	if err != nil {
+		return fmt.Errorf("creating temporary file: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+	}()
+
+	digest := sha256.New()
+	err = write(io.MultiWriter(tmp, digest))
+	if err != nil {
+		return
+	}
+	err = errors.Join(tmp.Sync(), tmp.Chmod(0644), tmp.Close())
+	if err != nil {
+		return fmt.Errorf("writing image: %w", err)
+	}
+
+	path := client.store.GetImagePath(name, gzipped)
+	err = os.Rename(tmp.Name(), path)
+	if err != nil {
+		return fmt.Errorf("storing image: %w", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return
+	}
+	err = writeImageMeta(client.store, name, imageMeta{
+		Digest:  fmt.Sprintf("sha256:%x", digest.Sum(nil)),
+		Size:    info.Size(),
+		ModTime: info.ModTime(),
+		Config:  config,
+	})
+	if err != nil {
+		return
+	}
+	// A stale image in the other format would take precedence
+	err = os.Remove(client.store.GetImagePath(name, !gzipped))
+	if os.IsNotExist(err) {
+		err = nil
+	}
+	return
+}
@@ -0,0 +1,108 @@
+package client_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/codingpa-ws/foxbox/client"
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/require"
+)
+
+func TestImportImage(t *testing.T) {
+	rootfs := tinyRootFS(t)
+
+	compressions := map[string]func(t *testing.T) []byte{
+		"plain": func(t *testing.T) []byte {
+			return rootfs
+		},
+		"gzip": func(t *testing.T) []byte {
+			buf := new(bytes.Buffer)
+			gz := gzip.NewWriter(buf)
+			_, err := gz.Write(rootfs)
+			require.NoError(t, err)
+			require.NoError(t, gz.Close())
+			return buf.Bytes()
+		},
+		"zstd": func(t *testing.T) []byte {
+			encoder, err := zstd.NewWriter(nil)
+			require.NoError(t, err)
+			return encoder.EncodeAll(rootfs, nil)
+		},
+		"xz": func(t *testing.T) []byte {
+			if _, err := exec.LookPath("xz"); err != nil {
+				t.Skip("xz is not installed")
+			}
+			cmd := exec.Command("xz", "--compress", "--stdout")
+			cmd.Stdin = bytes.NewReader(rootfs)
+			out, err := cmd.Output()
+			require.NoError(t, err)
+			return out
+		},
+	}
+
+	for compression, compress := range compressions {
+		compress := compress
+		t.Run(compression, func(t *testing.T) {
+			require := require.New(t)
+			image := compress(t)
+
+			foxbox := client.FromStore(newStore(t))
+			require.NoError(foxbox.ImportImage("tiny", bytes.NewReader(image)))
+
+			images, err := foxbox.ListImages()
+			require.NoError(err)
+			require.Equal([]client.Image{{Name: "tiny"}}, images)
+
+			name, err := foxbox.Create(&client.CreateOptions{
+				Image: "tiny",
+				Pull:  client.PullNever,
+				// Overlay boxes are only mounted while running
+				StorageDriver: client.StorageCopy,
+			})
+			require.NoError(err)
+			info, err := foxbox.Inspect(name)
+			require.NoError(err)
+			content, err := os.ReadFile(filepath.Join(info.Path, "boxfs", "etc", "hostname"))
+			require.NoError(err)
+			require.Equal("fox\n", string(content))
+		})
+	}
+
+	t.Run("replaces images in other formats", func(t *testing.T) {
+		require := require.New(t)
+		store := newStore(t)
+		foxbox := client.FromStore(store)
+
+		require.NoError(foxbox.ImportImage("tiny", bytes.NewReader(compressions["gzip"](t))))
+		require.NoError(foxbox.ImportImage("tiny", bytes.NewReader(rootfs)))
+
+		images, err := foxbox.ListImages()
+		require.NoError(err)
+		require.Equal([]client.Image{{Name: "tiny"}}, images)
+		require.FileExists(store.GetImagePath("tiny", false))
+	})
+
+	t.Run("rejects invalid names", func(t *testing.T) {
+		require := require.New(t)
+		store := newStore(t)
+		foxbox := client.FromStore(store)
+		for _, name := range []string{"../tiny", " ", "..", ".", ".tiny"} {
+			require.Error(foxbox.ImportImage(name, bytes.NewReader(rootfs)), name)
+		}
+		images, err := os.ReadDir(store.ImageBase())
+		require.NoError(err)
+		require.Empty(images)
+
+		// Where ".." used to be stored, outside of the image directory
+		outside := filepath.Join(store.ImageBase(), "..") + ".tar"
+		require.NoError(os.WriteFile(outside, rootfs, 0644))
+		t.Cleanup(func() { os.Remove(outside) })
+		require.ErrorIs(foxbox.RemoveImage("..", true), os.ErrNotExist)
+		require.FileExists(outside)
+	})
+}
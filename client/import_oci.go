@@ -0,0 +1,110 @@
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/codingpa-ws/foxbox/internal/archive"
+	"github.com/codingpa-ws/foxbox/internal/oci"
+	"github.com/codingpa-ws/foxbox/internal/store"
+	"github.com/klauspost/pgzip"
+)
+
+type ImportOCIOptions struct {
+	// Tag of the image to import, e.g. alpine:3.18 or 3.18.
+	// Only needed if there is more than one image.
+	Ref string
+}
+
+// Imports an image from an OCI image layout directory or from a
+// tarball of one, such as written by `docker save`, and stores it as
+// image with the given name. The layers are verified against their
+// digests and flattened into a single rootfs. Env, Cmd, Entrypoint,
+// WorkingDir and User of the image config are kept as image metadata.
+func (client *client) ImportOCIImage(name, path string, opt *ImportOCIOptions) (err error) {
+	opt = newOr(opt)
+	err = validateImageName(name)
+	if err != nil {
+		return
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return
+	}
+	dir := path
+	if !info.IsDir() {
+		dir, err = os.MkdirTemp(client.store.Base(), ".oci-*")
+		if err != nil {
+			return
+		}
+		defer store.RemoveAll(dir)
+		err = extractOCIArchive(path, dir)
+		if err != nil {
+			return fmt.Errorf("extracting %s: %w", path, err)
+		}
+	}
+
+	source, err := oci.Load(dir, opt.Ref)
+	if err != nil {
+		return
+	}
+	defer source.Close()
+	return client.storeOCIImage(name, source)
+}
+
+// Flattens the layers of source into a rootfs and stores it
+// as image with the image config as metadata.
+func (client *client) storeOCIImage(name string, source *oci.Source) error {
+	rootfs, err := os.MkdirTemp(client.store.Base(), ".rootfs-*")
+	if err != nil {
+		return err
+	}
+	defer store.RemoveAll(rootfs)
+	err = source.Unpack(rootfs)
+	if err != nil {
+		return err
+	}
+
+	config := &ImageConfig{
+		User:       source.Config.User,
+		Env:        source.Config.Env,
+		Entrypoint: source.Config.Entrypoint,
+		Cmd:        source.Config.Cmd,
+		WorkingDir: source.Config.WorkingDir,
+	}
+	return client.writeImage(name, true, config, func(w io.Writer) error {
+		gz := pgzip.NewWriter(w)
+		err := archive.Create(gz, rootfs)
+		return errors.Join(err, gz.Close())
+	})
+}
+
+// Extracts a possibly gzipped tarball of an image layout.
+func extractOCIArchive(path, dir string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	buffered := bufio.NewReader(f)
+	magic, err := buffered.Peek(len(gzipMagic))
+	if err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+	var r io.Reader = buffered
+	if bytes.HasPrefix(magic, gzipMagic) {
+		gz, err := pgzip.NewReader(buffered)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		r = gz
+	}
+	return archive.Extract(r, dir)
+}
@@ -0,0 +1,221 @@
+package client_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/codingpa-ws/foxbox/client"
+	"github.com/codingpa-ws/foxbox/internal/archive"
+	"github.com/stretchr/testify/require"
+)
+
+func digestOf(b []byte) string {
+	return fmt.Sprintf("sha256:%x", sha256.Sum256(b))
+}
+
+func tarball(t *testing.T, files map[string]string) []byte {
+	buf := new(bytes.Buffer)
+	tw := tar.NewWriter(buf)
+	// Sorted, so layers have stable digests
+	var names []string
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		content := files[name]
+		require.NoError(t, tw.WriteHeader(&tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0644, Size: int64(len(content))}))
+		_, err := tw.Write([]byte(content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+	return buf.Bytes()
+}
+
+// Returns the layers of a test image: a tiny rootfs with
+// an extra file, and a gzipped layer removing it again.
+func ociLayers(t *testing.T) (layers [][]byte, diffIDs []string) {
+	lower := tarball(t, map[string]string{"etc/hostname": "fox\n", "etc/removed": ""})
+	upper := tarball(t, map[string]string{"etc/.wh.removed": "", "etc/motd": "hi\n"})
+
+	buf := new(bytes.Buffer)
+	gz := gzip.NewWriter(buf)
+	_, err := gz.Write(upper)
+	require.NoError(t, err)
+	require.NoError(t, gz.Close())
+
+	return [][]byte{lower, buf.Bytes()}, []string{digestOf(lower), digestOf(upper)}
+}
+
+func ociConfig(t *testing.T, diffIDs []string) []byte {
+	config, err := json.Marshal(map[string]any{
+		"architecture": "amd64",
+		"os":           "linux",
+		"config": map[string]any{
+			"Env":        []string{"PATH=/bin", "FOX=1"},
+			"Cmd":        []string{"/bin/sh"},
+			"WorkingDir": "/etc",
+		},
+		"rootfs": map[string]any{"type": "layers", "diff_ids": diffIDs},
+	})
+	require.NoError(t, err)
+	return config
+}
+
+func writeBlob(t *testing.T, dir string, content []byte) map[string]any {
+	digest := digestOf(content)
+	path := filepath.Join(dir, "blobs", "sha256", digest[len("sha256:"):])
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+	require.NoError(t, os.WriteFile(path, content, 0644))
+	return map[string]any{"digest": digest, "size": len(content)}
+}
+
+func writeJSON(t *testing.T, path string, v any) {
+	b, err := json.Marshal(v)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(path, b, 0644))
+}
+
+// Writes an OCI image layout tagged 1.0 to dir.
+func writeOCILayout(t *testing.T, dir string) {
+	layers, diffIDs := ociLayers(t)
+
+	config := writeBlob(t, dir, ociConfig(t, diffIDs))
+	config["mediaType"] = "application/vnd.oci.image.config.v1+json"
+	var layerDescs []any
+	for _, layer := range layers {
+		desc := writeBlob(t, dir, layer)
+		desc["mediaType"] = "application/vnd.oci.image.layer.v1.tar+gzip"
+		layerDescs = append(layerDescs, desc)
+	}
+	manifest, err := json.Marshal(map[string]any{
+		"schemaVersion": 2,
+		"mediaType":     "application/vnd.oci.image.manifest.v1+json",
+		"config":        config,
+		"layers":        layerDescs,
+	})
+	require.NoError(t, err)
+
+	desc := writeBlob(t, dir, manifest)
+	desc["mediaType"] = "application/vnd.oci.image.manifest.v1+json"
+	desc["annotations"] = map[string]string{"org.opencontainers.image.ref.name": "1.0"}
+	writeJSON(t, filepath.Join(dir, "index.json"), map[string]any{
+		"schemaVersion": 2,
+		"manifests":     []any{desc},
+	})
+	writeJSON(t, filepath.Join(dir, "oci-layout"), map[string]string{"imageLayoutVersion": "1.0.0"})
+}
+
+// Writes the legacy layout of docker save archives to dir.
+func writeDockerSave(t *testing.T, dir string) {
+	layers, diffIDs := ociLayers(t)
+
+	config := ociConfig(t, diffIDs)
+	configName := digestOf(config)[len("sha256:"):] + ".json"
+	require.NoError(t, os.WriteFile(filepath.Join(dir, configName), config, 0644))
+	var layerNames []string
+	for i, layer := range layers {
+		name := fmt.Sprintf("layer%d/layer.tar", i)
+		require.NoError(t, os.MkdirAll(filepath.Join(dir, filepath.Dir(name)), 0755))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), layer, 0644))
+		layerNames = append(layerNames, name)
+	}
+	writeJSON(t, filepath.Join(dir, "manifest.json"), []any{map[string]any{
+		"Config":   configName,
+		"RepoTags": []string{"tiny:1.0"},
+		"Layers":   layerNames,
+	}})
+}
+
+func TestImportOCIImage(t *testing.T) {
+	layouts := map[string]func(t *testing.T, dir string){
+		"oci layout":  writeOCILayout,
+		"docker save": writeDockerSave,
+	}
+
+	for layout, write := range layouts {
+		write := write
+		t.Run(layout, func(t *testing.T) {
+			require := require.New(t)
+			dir := t.TempDir()
+			write(t, dir)
+
+			buf := new(bytes.Buffer)
+			require.NoError(archive.Create(buf, dir))
+			tarPath := filepath.Join(t.TempDir(), "image.tar")
+			require.NoError(os.WriteFile(tarPath, buf.Bytes(), 0644))
+
+			for _, path := range []string{dir, tarPath} {
+				store := newStore(t)
+				foxbox := client.FromStore(store)
+				require.NoError(foxbox.ImportOCIImage("tiny", path, &client.ImportOCIOptions{Ref: "1.0"}))
+
+				name, err := foxbox.Create(&client.CreateOptions{
+					Image:         "tiny",
+					Pull:          client.PullNever,
+					StorageDriver: client.StorageCopy,
+				})
+				require.NoError(err)
+				info, err := foxbox.Inspect(name)
+				require.NoError(err)
+				etc := filepath.Join(info.Path, "boxfs", "etc")
+				content, err := os.ReadFile(filepath.Join(etc, "hostname"))
+				require.NoError(err)
+				require.Equal("fox\n", string(content))
+				content, err = os.ReadFile(filepath.Join(etc, "motd"))
+				require.NoError(err)
+				require.Equal("hi\n", string(content))
+				require.NoFileExists(filepath.Join(etc, "removed"))
+				require.NoFileExists(filepath.Join(etc, ".wh.removed"))
+
+				var meta struct {
+					Config client.ImageConfig `json:"config"`
+				}
+				b, err := os.ReadFile(store.GetImageMetaPath("tiny"))
+				require.NoError(err)
+				require.NoError(json.Unmarshal(b, &meta))
+				require.Equal(client.ImageConfig{
+					Env:        []string{"PATH=/bin", "FOX=1"},
+					Cmd:        []string{"/bin/sh"},
+					WorkingDir: "/etc",
+				}, meta.Config)
+			}
+		})
+	}
+
+	t.Run("unknown tag", func(t *testing.T) {
+		dir := t.TempDir()
+		writeOCILayout(t, dir)
+		foxbox := client.FromStore(newStore(t))
+		require.Error(t, foxbox.ImportOCIImage("tiny", dir, &client.ImportOCIOptions{Ref: "2.0"}))
+	})
+
+	t.Run("digest mismatch", func(t *testing.T) {
+		require := require.New(t)
+		layers, _ := ociLayers(t)
+
+		dir := t.TempDir()
+		writeOCILayout(t, dir)
+		blob := filepath.Join(dir, "blobs", "sha256", digestOf(layers[0])[len("sha256:"):])
+		require.NoError(os.WriteFile(blob, tarball(t, map[string]string{"etc/hostname": "evil\n"}), 0644))
+		foxbox := client.FromStore(newStore(t))
+		err := foxbox.ImportOCIImage("tiny", dir, nil)
+		require.ErrorContains(err, "digest mismatch")
+		images, err := foxbox.ListImages()
+		require.NoError(err)
+		require.Empty(images)
+
+		dir = t.TempDir()
+		writeDockerSave(t, dir)
+		require.NoError(os.WriteFile(filepath.Join(dir, "layer0", "layer.tar"), tarball(t, map[string]string{"etc/hostname": "evil\n"}), 0644))
+		require.ErrorContains(foxbox.ImportOCIImage("tiny", dir, nil), "digest mismatch")
+	})
+}
@@ -0,0 +1,60 @@
+package client
+
+import (
+	"os"
+	"time"
+)
+
+type BoxInfo struct {
+	BoxConfig
+	// Location of the box in the store
+	Path  string   `json:"path"`
+	State BoxState `json:"state"`
+}
+
+type BoxState struct {
+	Status State `json:"status"`
+	// Host pid of the box process, only set while running
+	PID        int       `json:"pid,omitempty"`
+	ExitCode   int       `json:"exitCode"`
+	Signal     string    `json:"signal,omitempty"`
+	StartedAt  time.Time `json:"startedAt"`
+	FinishedAt time.Time `json:"finishedAt"`
+}
+
+func (client *client) Inspect(name string) (info *BoxInfo, err error) {
+	entry, err := client.store.GetEntry(name)
+	if err != nil {
+		return
+	}
+	name = entry.Name()
+
+	config, err := getBoxConfig(entry)
+	if os.IsNotExist(err) {
+		config = BoxConfig{Name: name}
+	} else if err != nil {
+		return
+	}
+
+	process, err := getProcessInfo(name, entry)
+	if err != nil {
+		return
+	}
+
+	info = &BoxInfo{
+		BoxConfig: config,
+		Path:      entry.Base(),
+		State: BoxState{
+			Status:     process.State,
+			ExitCode:   process.ExitCode,
+			Signal:     process.Signal,
+			StartedAt:  process.StartedAt,
+			FinishedAt: process.FinishedAt,
+		},
+	}
+	if process.State == StateRunning {
+		info.State.PID = process.PID
+	}
+
+	return
+}
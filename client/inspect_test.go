@@ -0,0 +1,45 @@
+package client_test
+
+import (
+	"testing"
+
+	"github.com/codingpa-ws/foxbox/client"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInspect(t *testing.T) {
+	require := require.New(t)
+	store := newStore(t)
+	downloadImage(t, store)
+
+	foxbox := client.FromStore(store)
+	name, err := foxbox.Create(&client.CreateOptions{
+		Image: AlpineImageName,
+	})
+	require.NoError(err)
+
+	info, err := foxbox.Inspect(name)
+	require.NoError(err)
+	require.Equal(client.BoxConfigVersion, info.Version)
+	require.Equal(name, info.Name)
+	require.Equal(AlpineImageName, info.Image.Name)
+	require.Equal("sha256:c59d5203bc6b8b6ef81f3f6b63e32c28d6e47be806ba8528f8766a4ca506c7ba", info.Image.Digest)
+	require.False(info.Created.IsZero())
+	require.Nil(info.Run)
+	require.Equal(client.StateStopped, info.State.Status)
+
+	err = foxbox.Run(name, &client.RunOptions{
+		Command:      []string{"true"},
+		MaxProcesses: 42,
+	})
+	require.NoError(err)
+
+	info, err = foxbox.Inspect(name)
+	require.NoError(err)
+	require.NotNil(info.Run)
+	require.Equal([]string{"true"}, info.Run.Command)
+	require.Equal(client.NetworkNone, info.Run.Network)
+	require.Equal(uint(42), info.Run.Limits.Processes)
+	require.Equal(client.StateExited, info.State.Status)
+	require.Equal(0, info.State.ExitCode)
+}
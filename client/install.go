@@ -0,0 +1,132 @@
+package client
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/codingpa-ws/foxbox/internal/foxfile"
+	"github.com/codingpa-ws/foxbox/internal/registry"
+	"github.com/codingpa-ws/foxbox/internal/toolchain"
+)
+
+// Unpacks prebuilt toolchains like node@20.1 from the toolchain
+// catalog into the file system and adds them to PATH.
+func (self *builder) install(instruction foxfile.Instruction) error {
+	refs, err := foxfile.Words(instruction.Args)
+	if err != nil {
+		return err
+	}
+	if self.catalog == nil {
+		self.catalog, err = toolchain.Fetch(self.opt.getToolchains())
+		if err != nil {
+			return err
+		}
+	}
+
+	var versions []*toolchain.Version
+	inputs := []string{self.key, instruction.String()}
+	for _, ref := range refs {
+		name, version, err := toolchain.ParseRef(ref)
+		if err != nil {
+			return err
+		}
+		resolved, err := self.catalog.Resolve(name, version, runtime.GOARCH)
+		if err != nil {
+			return err
+		}
+		versions = append(versions, resolved)
+		inputs = append(inputs, resolved.SHA256, resolved.Prefix, strconv.Itoa(resolved.Strip))
+	}
+
+	err = self.change(cacheKey(inputs...), func(fileSystem string) error {
+		for _, version := range versions {
+			err := self.unpackToolchain(version, fileSystem)
+			if err != nil {
+				return fmt.Errorf("installing %s: %w", version.Version, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, version := range versions {
+		path := strings.Join(version.PathDirs(), ":")
+		for _, variable := range mergeEnv(defaultEnv, self.config.Env) {
+			if current, ok := strings.CutPrefix(variable, "PATH="); ok && current != "" {
+				path += ":" + current
+			}
+		}
+		self.config.Env = mergeEnv(self.config.Env, []string{"PATH=" + path})
+	}
+	return nil
+}
+
+func (self *builder) unpackToolchain(version *toolchain.Version, fileSystem string) error {
+	tarball, err := self.downloadToolchain(version)
+	if err != nil {
+		return err
+	}
+	f, err := os.Open(tarball)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return version.Unpack(f, fileSystem)
+}
+
+// Returns the path of the toolchain’s tarball, which is
+// downloaded and verified unless it is cached already.
+func (self *builder) downloadToolchain(version *toolchain.Version) (path string, err error) {
+	dir := filepath.Join(self.client.store.BuildCacheBase(), "toolchains")
+	path = filepath.Join(dir, version.SHA256)
+	if _, err = os.Stat(path); err == nil {
+		return
+	}
+	err = os.MkdirAll(dir, 0755)
+	if err != nil {
+		return
+	}
+
+	url, err := self.catalog.TarballURL(version)
+	if err != nil {
+		return
+	}
+	body, err := registry.Open(url)
+	if err != nil {
+		return
+	}
+	defer body.Close()
+
+	tmp, err := os.CreateTemp(dir, ".tmp-*")
+	if err != nil {
+		return
+	}
+	defer func() {
+		if err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+	}()
+	digest := sha256.New()
+	_, err = io.Copy(io.MultiWriter(tmp, digest), body)
+	if err != nil {
+		return "", fmt.Errorf("downloading %s: %w", url, err)
+	}
+	if sum := fmt.Sprintf("%x", digest.Sum(nil)); sum != version.SHA256 {
+		return "", fmt.Errorf("sha256 mismatch for %s: expected %s, got %s", url, version.SHA256, sum)
+	}
+	err = errors.Join(tmp.Sync(), tmp.Close())
+	if err != nil {
+		return
+	}
+	return path, os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,51 @@
+package client
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Selects boxes by label, see ListOptions and PsOptions.
+type LabelSelector struct {
+	Key string
+	// The label must have this value, unless Exists is
+	// set, which only requires the box to have the label.
+	Value  string
+	Exists bool
+}
+
+// Parses selectors formatted key=value, matching labels with that
+// value, or key, matching boxes that have the label.
+func ParseLabelSelector(s string) (LabelSelector, error) {
+	key, value, hasValue := strings.Cut(s, "=")
+	if key == "" {
+		return LabelSelector{}, fmt.Errorf("invalid label selector %q: must be formatted key=value or key", s)
+	}
+	return LabelSelector{Key: key, Value: value, Exists: !hasValue}, nil
+}
+
+func (self LabelSelector) Matches(labels map[string]string) bool {
+	value, ok := labels[self.Key]
+	return ok && (self.Exists || value == self.Value)
+}
+
+// Reports whether labels match all selectors.
+func matchLabels(selectors []LabelSelector, labels map[string]string) bool {
+	for _, selector := range selectors {
+		if !selector.Matches(labels) {
+			return false
+		}
+	}
+	return true
+}
+
+// Keys must be non-empty and can’t contain "=",
+// so they can be written as selectors.
+func validateLabels(labels map[string]string) error {
+	for key := range labels {
+		if key == "" || strings.Contains(key, "=") {
+			return fmt.Errorf("invalid label key %q: must be non-empty and not contain \"=\"", key)
+		}
+	}
+	return nil
+}
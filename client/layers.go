@@ -0,0 +1,182 @@
+package client
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/codingpa-ws/foxbox/internal/store"
+)
+
+// Stored next to an image as <name>.json.
+type imageMeta struct {
+	Digest string `json:"digest"`
+	// Size and mtime of the image file the digest was computed
+	// for, so images replaced by hand are hashed again.
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"modTime"`
+	// Only set for images imported from OCI images
+	Config *ImageConfig `json:"config,omitempty"`
+}
+
+func (self imageMeta) matches(info os.FileInfo) bool {
+	return self.Size == info.Size() && self.ModTime.Equal(info.ModTime())
+}
+
+// Returns the digest (sha256:<hex>) of the image file at path,
+// which is only hashed if the cached digest is outdated.
+func imageDigest(store *store.Store, name, path string) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+
+	var meta imageMeta
+	b, err := os.ReadFile(store.GetImageMetaPath(name))
+	if err == nil && json.Unmarshal(b, &meta) == nil && meta.matches(info) {
+		return meta.Digest, nil
+	}
+	config := meta.Config
+
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	hash := sha256.New()
+	_, err = io.Copy(hash, f)
+	if err != nil {
+		return "", fmt.Errorf("hashing image: %w", err)
+	}
+	digest := fmt.Sprintf("sha256:%x", hash.Sum(nil))
+
+	return digest, writeImageMeta(store, name, imageMeta{
+		Digest:  digest,
+		Size:    info.Size(),
+		ModTime: info.ModTime(),
+		Config:  config,
+	})
+}
+
+// Returns the config stored with an image,
+// which is nil for images without config.
+func imageConfig(store *store.Store, name string) (*ImageConfig, error) {
+	var meta imageMeta
+	b, err := os.ReadFile(store.GetImageMetaPath(name))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(b, &meta)
+	if err != nil {
+		return nil, fmt.Errorf("parsing image metadata: %w", err)
+	}
+	return meta.Config, nil
+}
+
+// Returns the layer of the image, which is extracted
+// unless another box or build extracted it before.
+func (client *client) imageLayer(ref, path string, gzipped bool, digest string) (string, error) {
+	layer, err := client.store.AddLayer(digest, func(dir string) error {
+		image, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer image.Close()
+		return extractImage(image, gzipped, dir)
+	})
+	if err != nil {
+		return "", fmt.Errorf("extracting image %s: %w", ref, err)
+	}
+	return layer, nil
+}
+
+func writeImageMeta(store *store.Store, name string, meta imageMeta) error {
+	b, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+	path := store.GetImageMetaPath(name)
+	err = os.WriteFile(path+".tmp", b, 0644)
+	if err != nil {
+		return fmt.Errorf("writing image metadata: %w", err)
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// Removes layers that neither a box nor an image refers to.
+// Layers of existing images are kept, so new boxes from
+// them don’t need to extract the image again.
+func (client *client) removeUnusedLayers() error {
+	layers, err := client.store.Layers()
+	if err != nil || len(layers) == 0 {
+		return err
+	}
+
+	used := map[string]bool{}
+	names, err := client.List(nil)
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		entry, err := client.store.GetEntry(name)
+		if err != nil {
+			return err
+		}
+		storage, err := entry.GetStorage()
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("reading storage of %s: %w", name, err)
+		}
+		used[storage.Layer] = true
+	}
+
+	images, err := client.ListImages()
+	if err != nil {
+		return err
+	}
+	for _, image := range images {
+		var meta imageMeta
+		b, err := os.ReadFile(client.store.GetImageMetaPath(image.Name))
+		if err == nil && json.Unmarshal(b, &meta) == nil {
+			used[meta.Digest] = true
+		}
+	}
+
+	var errs []error
+	for _, layer := range layers {
+		if !used[layer] {
+			errs = append(errs, client.store.RemoveLayer(layer))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Returns the overlayfs mount options for an overlay box with paths
+// relative to its file system, which is the working directory of
+// the box process. This avoids escaping special characters in the
+// store path.
+func overlayOptions(fileSystem, layer, upper, work string) (string, error) {
+	var dirs []string
+	for _, dir := range []string{layer, upper, work} {
+		rel, err := filepath.Rel(fileSystem, dir)
+		if err != nil {
+			return "", err
+		}
+		if strings.ContainsAny(rel, ",:") {
+			return "", fmt.Errorf("unsupported character in overlay path %s", rel)
+		}
+		dirs = append(dirs, rel)
+	}
+	return fmt.Sprintf("lowerdir=%s,upperdir=%s,workdir=%s,userxattr", dirs[0], dirs[1], dirs[2]), nil
+}
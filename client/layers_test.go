@@ -0,0 +1,85 @@
+package client_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/codingpa-ws/foxbox/client"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLayers(t *testing.T) {
+	for _, driver := range []client.StorageDriver{client.StorageOverlay, client.StorageCopy} {
+		driver := driver
+		t.Run(string(driver), func(t *testing.T) {
+			require := require.New(t)
+			store := newStore(t)
+			foxbox := client.FromStore(store)
+			require.NoError(foxbox.ImportImage("tiny", bytes.NewReader(tinyRootFS(t))))
+
+			create := func() string {
+				name, err := foxbox.Create(&client.CreateOptions{
+					Image:         "tiny",
+					StorageDriver: driver,
+				})
+				require.NoError(err)
+				return name
+			}
+			first, second := create(), create()
+
+			layers, err := store.Layers()
+			require.NoError(err)
+			require.Len(layers, 1, "boxes from the same image must share a layer")
+			layer, err := store.LayerPath(layers[0])
+			require.NoError(err)
+
+			entry, err := store.GetEntry(first)
+			require.NoError(err)
+			storage, err := entry.GetStorage()
+			require.NoError(err)
+			require.Equal(string(driver), storage.Driver)
+			require.Equal(layers[0], storage.Layer)
+
+			if driver == client.StorageCopy {
+				hostname := filepath.Join(entry.FileSystem(), "etc", "hostname")
+				require.NoError(os.WriteFile(hostname, []byte("changed\n"), 0644))
+				content, err := os.ReadFile(filepath.Join(layer, "etc", "hostname"))
+				require.NoError(err)
+				require.Equal("fox\n", string(content), "box changes must not modify the layer")
+			} else {
+				require.DirExists(entry.UpperDir())
+				require.FileExists(filepath.Join(entry.UpperDir(), "etc", "resolv.conf"))
+				require.NoFileExists(filepath.Join(layer, "etc", "resolv.conf"))
+			}
+
+			require.NoError(foxbox.Delete(first, nil))
+			require.NoError(foxbox.RemoveImage("tiny", true))
+			require.DirExists(layer, "layers must be kept while boxes use them")
+
+			require.NoError(foxbox.Delete(second, nil))
+			require.NoDirExists(layer, "unused layers must be removed")
+		})
+	}
+
+	t.Run("layers of existing images are kept", func(t *testing.T) {
+		require := require.New(t)
+		store := newStore(t)
+		foxbox := client.FromStore(store)
+		require.NoError(foxbox.ImportImage("tiny", bytes.NewReader(tinyRootFS(t))))
+
+		name, err := foxbox.Create(&client.CreateOptions{Image: "tiny"})
+		require.NoError(err)
+		require.NoError(foxbox.Delete(name, nil))
+
+		layers, err := store.Layers()
+		require.NoError(err)
+		require.Len(layers, 1)
+
+		require.NoError(foxbox.RemoveImage("tiny", false))
+		layers, err = store.Layers()
+		require.NoError(err)
+		require.Empty(layers)
+	})
+}
@@ -1,13 +1,17 @@
 package client
 
 import (
+	"fmt"
 	"os"
 )
 
 type ListOptions struct {
+	// Only lists boxes with labels matching all selectors
+	Labels []LabelSelector
 }
 
 func (client *client) List(opt *ListOptions) (ids []string, err error) {
+	opt = newOr(opt)
 	path := client.store.EntryBase()
 
 	entries, err := os.ReadDir(path)
@@ -16,10 +20,35 @@ func (client *client) List(opt *ListOptions) (ids []string, err error) {
 	}
 
 	for _, entry := range entries {
-		if entry.IsDir() {
-			ids = append(ids, entry.Name())
+		if !entry.IsDir() {
+			continue
 		}
+		if len(opt.Labels) > 0 {
+			labels, err := client.boxLabels(entry.Name())
+			if err != nil {
+				return nil, err
+			}
+			if !matchLabels(opt.Labels, labels) {
+				continue
+			}
+		}
+		ids = append(ids, entry.Name())
 	}
 
 	return
 }
+
+func (client *client) boxLabels(name string) (map[string]string, error) {
+	entry, err := client.store.GetEntry(name)
+	if err != nil {
+		return nil, err
+	}
+	config, err := getBoxConfig(entry)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading config of %s: %w", name, err)
+	}
+	return config.Labels, nil
+}
@@ -2,7 +2,8 @@ package client
 
 import (
 	"os"
-	"strings"
+
+	"github.com/codingpa-ws/foxbox/internal/store"
 )
 
 type Image struct {
@@ -17,11 +18,8 @@ func (client *client) ListImages() (images []Image, err error) {
 	}
 
 	for _, entry := range entries {
-		name := entry.Name()
-		if !entry.IsDir() && (strings.HasSuffix(name, ".tar") || strings.HasSuffix(name, ".tar.gz")) {
-			name = strings.TrimSuffix(name, ".gz")
-			name = strings.TrimSuffix(name, ".tar")
-
+		name, ok := store.ImageName(entry.Name())
+		if !entry.IsDir() && ok {
 			images = append(images, Image{
 				Name: name,
 			})
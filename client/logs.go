@@ -0,0 +1,113 @@
+package client
+
+import (
+	"fmt"
+	"io"
+	"sync/atomic"
+	"time"
+
+	"github.com/codingpa-ws/foxbox/internal/logfile"
+)
+
+type LogsOptions struct {
+	// Keeps streaming new output until the box exits
+	// or the returned reader is closed.
+	Follow bool
+	// Only output logged at or after Since
+	Since time.Time
+	// Only the last n lines, 0 means all
+	Tail int
+
+	// Selects the streams to read. If neither is set,
+	// both are read.
+	Stdout bool
+	Stderr bool
+
+	// Prefixes every line with its RFC 3339 timestamp
+	Timestamps bool
+}
+
+func (self LogsOptions) streams() (streams []string) {
+	if self.Stdout {
+		streams = append(streams, logfile.Stdout)
+	}
+	if self.Stderr {
+		streams = append(streams, logfile.Stderr)
+	}
+	return
+}
+
+// How long following the log waits for the exit of
+// a box to be recorded after its process has exited.
+const exitRecordTimeout = 5 * time.Second
+
+// Returns the stored output of a box, one line per record. Only
+// output of runs with LogDriverFile is stored, which is the default
+// for detached boxes.
+func (client *client) Logs(name string, opt *LogsOptions) (io.ReadCloser, error) {
+	opt = newOr(opt)
+
+	entry, err := client.store.GetEntry(name)
+	if err != nil {
+		return nil, err
+	}
+
+	reader, writer := io.Pipe()
+	logs := &logReader{PipeReader: reader}
+	// When the box process was last seen exited
+	// while its exit wasn’t recorded yet
+	var exited time.Time
+
+	go func() {
+		err := logfile.Read(entry.LogPath(), logfile.ReadOptions{
+			Since:   opt.Since,
+			Tail:    opt.Tail,
+			Streams: opt.streams(),
+			Follow:  opt.Follow,
+			Done: func() bool {
+				if logs.closed.Load() {
+					return true
+				}
+				// Recorded after the remaining output is logged
+				state, err := entry.GetRunState()
+				if err != nil || state.Finished() {
+					return true
+				}
+				// Unless the supervisor died with the box
+				_, running, _ := entry.GetPID()
+				if running {
+					exited = time.Time{}
+					return false
+				}
+				if exited.IsZero() {
+					exited = time.Now()
+				}
+				return time.Since(exited) > exitRecordTimeout
+			},
+		}, func(record logfile.Record) error {
+			line := record.Line + "\n"
+			if opt.Timestamps {
+				line = record.Time.Format(time.RFC3339Nano) + " " + line
+			}
+			_, err := io.WriteString(writer, line)
+			return err
+		})
+		if err != nil {
+			err = fmt.Errorf("reading logs of %s: %w", name, err)
+		}
+		writer.CloseWithError(err)
+	}()
+
+	return logs, nil
+}
+
+type logReader struct {
+	*io.PipeReader
+	closed atomic.Bool
+}
+
+// Also stops following the log.
+func (self *logReader) Close() error {
+	self.closed.Store(true)
+	return self.PipeReader.Close()
+}
@@ -0,0 +1,60 @@
+package client_test
+
+import (
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/codingpa-ws/foxbox/client"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLogs(t *testing.T) {
+	if testing.Short() {
+		t.Skip("integration test is slow")
+	}
+
+	require := require.New(t)
+	store := newStore(t)
+	downloadImage(t, store)
+
+	foxbox := client.FromStore(store)
+	name, err := foxbox.Create(&client.CreateOptions{
+		Image: AlpineImageName,
+	})
+	require.NoError(err)
+
+	err = foxbox.Start(name, &client.RunOptions{
+		Command: []string{"sh", "-c", "echo hello; sleep 0.5; echo oops >&2; echo bye"},
+	})
+	require.NoError(err)
+
+	logs, err := foxbox.Logs(name, &client.LogsOptions{Follow: true})
+	require.NoError(err)
+	b, err := io.ReadAll(logs)
+	require.NoError(err)
+	require.NoError(logs.Close())
+	require.Equal("hello\noops\nbye\n", string(b))
+
+	logs, err = foxbox.Logs(name, &client.LogsOptions{Stdout: true, Tail: 1})
+	require.NoError(err)
+	b, err = io.ReadAll(logs)
+	require.NoError(err)
+	require.Equal("bye\n", string(b))
+	require.NoError(logs.Close())
+
+	// Output right before exiting may still be logged after the
+	// box process has exited
+	err = foxbox.Start(name, &client.RunOptions{
+		Command: []string{"sh", "-c", "sleep 0.2; seq 5000"},
+	})
+	require.NoError(err)
+	logs, err = foxbox.Logs(name, &client.LogsOptions{Follow: true, Since: time.Now()})
+	require.NoError(err)
+	b, err = io.ReadAll(logs)
+	require.NoError(err)
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	require.Len(lines, 5000)
+	require.Equal("5000", lines[len(lines)-1])
+}
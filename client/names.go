@@ -2,9 +2,12 @@ package client
 
 import (
 	cryptorand "crypto/rand"
+	"errors"
 	"fmt"
 	"math/rand"
 	"time"
+
+	"github.com/codingpa-ws/foxbox/internal/store"
 )
 
 var adjectives = []string{
@@ -49,3 +52,23 @@ func NewName() string {
 	}
 	return fmt.Sprintf("%s-%s-%x", adj, subj, b)
 }
+
+// Returned when creating a box with the name of an existing box.
+var ErrNameConflict = store.ErrNameConflict
+
+// Creates the store entry of a new box with the given name,
+// or a random name if name is empty.
+func (client *client) newEntry(name string) (string, *store.StoreEntry, error) {
+	if name != "" {
+		entry, err := client.store.NewEntry(name)
+		return name, entry, err
+	}
+	for attempt := 1; ; attempt++ {
+		name = NewName()
+		entry, err := client.store.NewEntry(name)
+		// Random names rarely collide
+		if !errors.Is(err, ErrNameConflict) || attempt == 10 {
+			return name, entry, err
+		}
+	}
+}
@@ -0,0 +1,187 @@
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// The environment of box processes unless the image or
+// the run options override it.
+var defaultEnv = []string{"PATH=/bin:/sbin:/usr/bin:/usr/sbin", "LANG=C.UTF-8", "CHARSET=UTF-8"}
+
+// The process executed in a box, passed to the
+// box child in FOXBOX_PROCESS.
+type process struct {
+	Args    []string
+	Env     []string
+	WorkDir string
+	User    string
+}
+
+// Combines the image config with the run options. Like docker, a
+// command replaces the image’s cmd and an entrypoint replaces both
+// the image’s entrypoint and cmd. Without either, a shell is run.
+func newProcess(image *ImageConfig, opt *RunOptions) process {
+	image = newOr(image)
+	entrypoint, cmd := image.Entrypoint, image.Cmd
+	if len(opt.Entrypoint) > 0 {
+		entrypoint, cmd = opt.Entrypoint, nil
+		if len(entrypoint) == 1 && entrypoint[0] == "" {
+			entrypoint = nil
+		}
+	}
+	if len(opt.Command) > 0 {
+		cmd = opt.Command
+	}
+	args := append(append([]string{}, entrypoint...), cmd...)
+	if len(args) == 0 {
+		args = []string{"/bin/sh"}
+	}
+
+	workDir := image.WorkingDir
+	if opt.WorkDir != "" {
+		workDir = opt.WorkDir
+	}
+	user := image.User
+	if opt.User != "" {
+		user = opt.User
+	}
+	return process{
+		Args:    args,
+		Env:     mergeEnv(defaultEnv, image.Env, opt.Env),
+		WorkDir: workDir,
+		User:    user,
+	}
+}
+
+// Merges KEY=value lists, later values replacing earlier ones.
+func mergeEnv(envs ...[]string) []string {
+	var merged []string
+	index := map[string]int{}
+	for _, env := range envs {
+		for _, variable := range env {
+			key, _, _ := strings.Cut(variable, "=")
+			if i, ok := index[key]; ok {
+				merged[i] = variable
+				continue
+			}
+			index[key] = len(merged)
+			merged = append(merged, variable)
+		}
+	}
+	return merged
+}
+
+func encodeProcess(process process) (string, error) {
+	buf := new(bytes.Buffer)
+	err := gob.NewEncoder(buf).Encode(process)
+	if err != nil {
+		return "", fmt.Errorf("serializing process: %w", err)
+	}
+	return fmt.Sprintf("%x", buf.String()), nil
+}
+
+func decodeProcess() (process process, err error) {
+	var b []byte
+	_, err = fmt.Sscanf(os.Getenv("FOXBOX_PROCESS"), "%x", &b)
+	if err != nil {
+		return process, fmt.Errorf("reading FOXBOX_PROCESS: %w", err)
+	}
+	err = gob.NewDecoder(bytes.NewReader(b)).Decode(&process)
+	if err != nil {
+		return process, fmt.Errorf("decoding process: %w", err)
+	}
+	return
+}
+
+// Replaces the current process, which has to be in the box’s
+// root already, with the process in FOXBOX_PROCESS.
+func execProcess() error {
+	process, err := decodeProcess()
+	if err != nil {
+		return err
+	}
+
+	err = checkUser(process.User)
+	if err != nil {
+		return err
+	}
+	if process.WorkDir != "" {
+		err = os.MkdirAll(process.WorkDir, 0755)
+		if err == nil {
+			err = os.Chdir(process.WorkDir)
+		}
+		if err != nil {
+			return fmt.Errorf("changing to working directory: %w", err)
+		}
+	}
+
+	// Looked up with the box’s PATH
+	for _, variable := range process.Env {
+		if path, ok := strings.CutPrefix(variable, "PATH="); ok {
+			os.Setenv("PATH", path)
+		}
+	}
+	path, err := exec.LookPath(process.Args[0])
+	if err != nil {
+		return err
+	}
+	return syscall.Exec(path, process.Args, process.Env)
+}
+
+// Boxes only map the user running foxbox to root, so other
+// users can’t be switched to. User names are looked up in the
+// box’s /etc/passwd and /etc/group.
+func checkUser(user string) error {
+	if user == "" {
+		return nil
+	}
+	name, group, _ := strings.Cut(user, ":")
+	uid, err := lookupID("/etc/passwd", name)
+	if err != nil {
+		return fmt.Errorf("looking up user %s: %w", name, err)
+	}
+	gid := 0
+	if group != "" {
+		gid, err = lookupID("/etc/group", group)
+		if err != nil {
+			return fmt.Errorf("looking up group %s: %w", group, err)
+		}
+	}
+	if uid != 0 || gid != 0 {
+		return fmt.Errorf("user %s is not mapped: boxes only support root (uid 0)", user)
+	}
+	return nil
+}
+
+// Returns the numeric id of name, which can also be numeric,
+// from a file in /etc/passwd format.
+func lookupID(file, name string) (int, error) {
+	if id, err := strconv.Atoi(name); err == nil {
+		return id, nil
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), ":")
+		if len(fields) > 2 && fields[0] == name {
+			return strconv.Atoi(fields[2])
+		}
+	}
+	if scanner.Err() != nil {
+		return 0, scanner.Err()
+	}
+	return 0, errors.New("not found")
+}
@@ -3,10 +3,15 @@ package client
 import (
 	"os"
 	"slices"
+	"time"
+
+	"github.com/codingpa-ws/foxbox/internal/store"
 )
 
 type PsOptions struct {
 	States []State
+	// Only lists boxes with labels matching all selectors
+	Labels []LabelSelector
 }
 
 type ProcessInfo struct {
@@ -14,6 +19,13 @@ type ProcessInfo struct {
 	PID      int
 	State    State
 	ExitCode int
+	// Name of the signal that terminated the box, if any.
+	Signal string
+	Image  string
+	Labels map[string]string
+
+	StartedAt  time.Time
+	FinishedAt time.Time
 }
 
 func (client *client) Ps(opt *PsOptions) (infos []ProcessInfo, err error) {
@@ -32,30 +44,62 @@ func (client *client) Ps(opt *PsOptions) (infos []ProcessInfo, err error) {
 		if err != nil {
 			return nil, err
 		}
-		pid, running, err := entry.GetPID()
+		info, err := getProcessInfo(dir.Name(), entry)
 		if err != nil {
 			return nil, err
 		}
 
-		var state State
-
-		if running {
-			state = StateRunning
-		} else {
-			state = StateStopped
+		if len(opt.States) > 0 && !slices.Contains(opt.States, info.State) {
+			continue
 		}
-
-		if len(opt.States) > 0 && !slices.Contains(opt.States, state) {
+		if !matchLabels(opt.Labels, info.Labels) {
 			continue
 		}
 
-		infos = append(infos, ProcessInfo{
-			ID:       dir.Name(),
-			PID:      pid,
-			State:    state,
-			ExitCode: 0, // TODO: last exit code must be stored
-		})
+		infos = append(infos, info)
 	}
 
 	return
 }
+
+func getProcessInfo(name string, entry *store.StoreEntry) (info ProcessInfo, err error) {
+	pid, running, err := entry.GetPID()
+	if err != nil && !os.IsNotExist(err) {
+		return
+	}
+	runState, err := entry.GetRunState()
+	if err != nil && !os.IsNotExist(err) {
+		return
+	}
+	var config BoxConfig
+	err = entry.GetConfig(&config)
+	if err != nil && !os.IsNotExist(err) {
+		return
+	}
+
+	var state State
+
+	switch {
+	case running:
+		state = StateRunning
+	case runState.Finished():
+		state = StateExited
+	default:
+		state = StateStopped
+	}
+
+	info = ProcessInfo{
+		ID:        name,
+		PID:       pid,
+		State:     state,
+		Image:     config.Image.Name,
+		Labels:    config.Labels,
+		StartedAt: runState.StartedAt,
+	}
+	if state == StateExited {
+		info.ExitCode = runState.ExitCode
+		info.Signal = runState.Signal
+		info.FinishedAt = runState.FinishedAt
+	}
+	return info, nil
+}
@@ -19,6 +19,11 @@ func TestPs(t *testing.T) {
 	})
 	require.NoError(err)
 
+	infos, err := foxbox.Ps(nil)
+	require.NoError(err)
+	require.Equal(1, len(infos))
+	require.Equal(client.StateStopped, infos[0].State, "box that has never run must be stopped")
+
 	runError := make(chan error)
 	go func() {
 		err = foxbox.Run(name, &client.RunOptions{
@@ -30,13 +35,30 @@ func TestPs(t *testing.T) {
 
 	time.Sleep(time.Millisecond * 20)
 
-	infos, err := foxbox.Ps(nil)
+	infos, err = foxbox.Ps(nil)
 	require.NoError(err)
 	require.Equal(1, len(infos))
 	info := infos[0]
 	require.Equal(name, info.ID)
 	require.Equal(client.StateRunning, info.State)
 	require.Greater(info.PID, 0)
+	require.False(info.StartedAt.IsZero())
 
 	require.NoError(<-runError)
+
+	err = foxbox.Run(name, &client.RunOptions{
+		Command: []string{"sh", "-c", "exit 3"},
+	})
+	require.Error(err)
+
+	infos, err = foxbox.Ps(&client.PsOptions{
+		States: []client.State{client.StateExited},
+	})
+	require.NoError(err)
+	require.Equal(1, len(infos))
+	info = infos[0]
+	require.Equal(client.StateExited, info.State)
+	require.Equal(3, info.ExitCode)
+	require.Empty(info.Signal)
+	require.False(info.FinishedAt.Before(info.StartedAt))
 }
@@ -0,0 +1,81 @@
+package client
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"runtime"
+
+	"github.com/codingpa-ws/foxbox/internal/oci"
+	"github.com/codingpa-ws/foxbox/internal/registry"
+)
+
+type PullOptions struct {
+	// URL of the registry.json, defaults to
+	// FOXBOX_REGISTRY or registry.DefaultURL.
+	Registry string
+}
+
+func (self PullOptions) getRegistry() string {
+	if self.Registry == "" {
+		return registry.URL()
+	}
+	return self.Registry
+}
+
+// Downloads an image like alpine:3.18 for the current architecture
+// from the registry and stores it as name:tag. References naming a
+// registry like docker.io/library/alpine:3.18 are pulled from that
+// OCI distribution registry instead and stored as written, with the
+// default tag if they have none. Pulling an image that already
+// exists replaces it.
+func (client *client) PullImage(ref string, opt *PullOptions) (image Image, err error) {
+	opt = newOr(opt)
+	if oci.IsReference(ref) {
+		return client.pullOCIImage(ref)
+	}
+
+	name, tag, err := registry.ParseRef(ref)
+	if err != nil {
+		return
+	}
+	reg, err := registry.Fetch(opt.getRegistry())
+	if err != nil {
+		return
+	}
+	version, err := reg.Resolve(name, tag, runtime.GOARCH)
+	if err != nil {
+		return
+	}
+	url, err := reg.RootFSURL(version)
+	if err != nil {
+		return
+	}
+
+	image = Image{Name: name + ":" + tag}
+	err = client.downloadImage(image.Name, url, version.RootFS)
+	if err != nil {
+		return Image{}, fmt.Errorf("pulling %s: %w", image.Name, err)
+	}
+	return
+}
+
+func (client *client) downloadImage(name, url string, rootfs registry.RootFS) error {
+	body, err := registry.Open(url)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	return client.writeImage(name, rootfs.Gzipped(), nil, func(w io.Writer) error {
+		digest := sha256.New()
+		_, err := io.Copy(io.MultiWriter(w, digest), body)
+		if err != nil {
+			return fmt.Errorf("downloading %s: %w", url, err)
+		}
+		if sum := fmt.Sprintf("%x", digest.Sum(nil)); sum != rootfs.SHA256 {
+			return fmt.Errorf("sha256 mismatch for %s: expected %s, got %s", url, rootfs.SHA256, sum)
+		}
+		return nil
+	})
+}
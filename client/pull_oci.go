@@ -0,0 +1,36 @@
+package client
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/codingpa-ws/foxbox/internal/oci"
+	"github.com/codingpa-ws/foxbox/internal/store"
+)
+
+func (client *client) pullOCIImage(ref string) (image Image, err error) {
+	parsed, err := oci.ParseReference(ref)
+	if err != nil {
+		return
+	}
+	image = Image{Name: parsed.String()}
+
+	// Layers are kept per reference until the pull succeeds,
+	// so pulling again resumes interrupted downloads.
+	dir := filepath.Join(client.store.DownloadBase(), fmt.Sprintf("%x", sha256.Sum256([]byte(image.Name))))
+	err = os.MkdirAll(dir, 0755)
+	if err != nil {
+		return
+	}
+
+	source, err := oci.NewRemote(parsed).Pull(dir)
+	if err == nil {
+		err = client.storeOCIImage(image.Name, source)
+	}
+	if err != nil {
+		return Image{}, fmt.Errorf("pulling %s: %w", image.Name, err)
+	}
+	return image, store.RemoveAll(dir)
+}
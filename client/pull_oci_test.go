@@ -0,0 +1,231 @@
+package client_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/codingpa-ws/foxbox/client"
+	"github.com/stretchr/testify/require"
+)
+
+// An OCI distribution registry serving fox/tiny, which requires
+// token authentication like Docker Hub.
+type fakeRegistry struct {
+	*httptest.Server
+	manifests map[string][]byte
+	blobs     map[string][]byte
+	// Blob whose first download is interrupted halfway
+	interrupt string
+
+	mu     sync.Mutex
+	ranges []string
+}
+
+func newFakeRegistry(t *testing.T) *fakeRegistry {
+	layers, diffIDs := ociLayers(t)
+	registry := &fakeRegistry{
+		manifests: map[string][]byte{},
+		blobs:     map[string][]byte{},
+	}
+	blob := func(mediaType string, content []byte) map[string]any {
+		registry.blobs[digestOf(content)] = content
+		return map[string]any{"mediaType": mediaType, "digest": digestOf(content), "size": len(content)}
+	}
+
+	var layerDescs []any
+	for _, layer := range layers {
+		layerDescs = append(layerDescs, blob("application/vnd.oci.image.layer.v1.tar+gzip", layer))
+	}
+	manifest, err := json.Marshal(map[string]any{
+		"schemaVersion": 2,
+		"mediaType":     "application/vnd.oci.image.manifest.v1+json",
+		"config":        blob("application/vnd.oci.image.config.v1+json", ociConfig(t, diffIDs)),
+		"layers":        layerDescs,
+	})
+	require.NoError(t, err)
+	registry.manifests[digestOf(manifest)] = manifest
+
+	otherArch := "s390x"
+	if runtime.GOARCH == otherArch {
+		otherArch = "amd64"
+	}
+	index, err := json.Marshal(map[string]any{
+		"schemaVersion": 2,
+		"mediaType":     "application/vnd.oci.image.index.v1+json",
+		"manifests": []any{
+			map[string]any{
+				"mediaType": "application/vnd.oci.image.manifest.v1+json",
+				"digest":    digestOf([]byte("other")),
+				"size":      5,
+				"platform":  map[string]string{"os": "linux", "architecture": otherArch},
+			},
+			map[string]any{
+				"mediaType": "application/vnd.oci.image.manifest.v1+json",
+				"digest":    digestOf(manifest),
+				"size":      len(manifest),
+				"platform":  map[string]string{"os": "linux", "architecture": runtime.GOARCH},
+			},
+		},
+	})
+	require.NoError(t, err)
+	registry.manifests["1.0"] = index
+	registry.manifests["latest"] = index
+
+	registry.Server = httptest.NewServer(http.HandlerFunc(registry.serve))
+	t.Cleanup(registry.Close)
+	return registry
+}
+
+// Reference to the image in this registry, e.g. 127.0.0.1:1234/fox/tiny:1.0
+func (self *fakeRegistry) ref(tag string) string {
+	return strings.TrimPrefix(self.URL, "http://") + "/fox/tiny" + tag
+}
+
+func (self *fakeRegistry) serve(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/token" {
+		if r.URL.Query().Get("scope") != "repository:fox/tiny:pull" {
+			http.Error(w, "invalid scope", http.StatusBadRequest)
+			return
+		}
+		fmt.Fprint(w, `{"token": "secret"}`)
+		return
+	}
+	if r.Header.Get("Authorization") != "Bearer secret" {
+		w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="fake",scope="repository:fox/tiny:pull"`, self.URL))
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	if reference, ok := strings.CutPrefix(r.URL.Path, "/v2/fox/tiny/manifests/"); ok {
+		manifest, ok := self.manifests[reference]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Docker-Content-Digest", digestOf(manifest))
+		w.Write(manifest)
+		return
+	}
+	digest, ok := strings.CutPrefix(r.URL.Path, "/v2/fox/tiny/blobs/")
+	blob, found := self.blobs[digest]
+	if !ok || !found {
+		http.NotFound(w, r)
+		return
+	}
+
+	self.mu.Lock()
+	self.ranges = append(self.ranges, r.Header.Get("Range"))
+	interrupt := digest == self.interrupt
+	if interrupt {
+		self.interrupt = ""
+	}
+	self.mu.Unlock()
+	if interrupt {
+		w.Header().Set("Content-Length", fmt.Sprint(len(blob)))
+		w.Write(blob[:len(blob)/2])
+		w.(http.Flusher).Flush()
+		panic(http.ErrAbortHandler)
+	}
+	http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(blob))
+}
+
+func TestPullOCIImage(t *testing.T) {
+	t.Run("pulls the image for the current platform", func(t *testing.T) {
+		require := require.New(t)
+		registry := newFakeRegistry(t)
+		store := newStore(t)
+		foxbox := client.FromStore(store)
+
+		image, err := foxbox.PullImage(registry.ref(":1.0"), nil)
+		require.NoError(err)
+		require.Equal(registry.ref(":1.0"), image.Name)
+		images, err := foxbox.ListImages()
+		require.NoError(err)
+		require.Equal([]client.Image{image}, images)
+
+		name, err := foxbox.Create(&client.CreateOptions{
+			Image:         image.Name,
+			Pull:          client.PullNever,
+			StorageDriver: client.StorageCopy,
+		})
+		require.NoError(err)
+		info, err := foxbox.Inspect(name)
+		require.NoError(err)
+		content, err := os.ReadFile(filepath.Join(info.Path, "boxfs", "etc", "motd"))
+		require.NoError(err)
+		require.Equal("hi\n", string(content))
+		require.NoFileExists(filepath.Join(info.Path, "boxfs", "etc", "removed"))
+
+		downloads, err := os.ReadDir(store.DownloadBase())
+		require.NoError(err)
+		require.Empty(downloads)
+	})
+
+	t.Run("pulls missing images on create", func(t *testing.T) {
+		require := require.New(t)
+		registry := newFakeRegistry(t)
+		foxbox := client.FromStore(newStore(t))
+
+		_, err := foxbox.Create(&client.CreateOptions{
+			Image:         registry.ref(""),
+			StorageDriver: client.StorageCopy,
+		})
+		require.NoError(err)
+		images, err := foxbox.ListImages()
+		require.NoError(err)
+		require.Equal([]client.Image{{Name: registry.ref(":latest")}}, images)
+
+		// Found without pulling again
+		registry.Close()
+		_, err = foxbox.Create(&client.CreateOptions{
+			Image:         registry.ref(""),
+			StorageDriver: client.StorageCopy,
+		})
+		require.NoError(err)
+	})
+
+	t.Run("resumes interrupted downloads", func(t *testing.T) {
+		require := require.New(t)
+		registry := newFakeRegistry(t)
+		layers, _ := ociLayers(t)
+		registry.interrupt = digestOf(layers[1])
+		foxbox := client.FromStore(newStore(t))
+
+		_, err := foxbox.PullImage(registry.ref(":1.0"), nil)
+		require.Error(err)
+		_, err = foxbox.PullImage(registry.ref(":1.0"), nil)
+		require.NoError(err)
+		require.Contains(registry.ranges, fmt.Sprintf("bytes=%d-", len(layers[1])/2))
+	})
+
+	t.Run("verifies digests", func(t *testing.T) {
+		require := require.New(t)
+		registry := newFakeRegistry(t)
+		layers, _ := ociLayers(t)
+		registry.blobs[digestOf(layers[0])] = tarball(t, map[string]string{"etc/hostname": "evil\n"})
+		foxbox := client.FromStore(newStore(t))
+
+		_, err := foxbox.PullImage(registry.ref(":1.0"), nil)
+		require.ErrorContains(err, "digest mismatch")
+		images, err := foxbox.ListImages()
+		require.NoError(err)
+		require.Empty(images)
+	})
+
+	t.Run("unknown tag", func(t *testing.T) {
+		registry := newFakeRegistry(t)
+		foxbox := client.FromStore(newStore(t))
+		_, err := foxbox.PullImage(registry.ref(":2.0"), nil)
+		require.ErrorContains(t, err, "404")
+	})
+}
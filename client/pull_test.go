@@ -0,0 +1,185 @@
+package client_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/codingpa-ws/foxbox/client"
+	"github.com/stretchr/testify/require"
+)
+
+// Returns an uncompressed rootfs tarball containing only /etc/hostname.
+func tinyRootFS(t *testing.T) []byte {
+	require := require.New(t)
+
+	buf := new(bytes.Buffer)
+	tw := tar.NewWriter(buf)
+	content := []byte("fox\n")
+	require.NoError(tw.WriteHeader(&tar.Header{Name: "etc/", Typeflag: tar.TypeDir, Mode: 0755}))
+	require.NoError(tw.WriteHeader(&tar.Header{Name: "etc/hostname", Typeflag: tar.TypeReg, Mode: 0644, Size: int64(len(content))}))
+	_, err := tw.Write(content)
+	require.NoError(err)
+	require.NoError(tw.Close())
+	return buf.Bytes()
+}
+
+// Creates a registry with a tiny rootfs in dir and returns its sha256.
+func writeRegistry(t *testing.T, dir, rootfsURL string) string {
+	require := require.New(t)
+
+	buf := new(bytes.Buffer)
+	gz := gzip.NewWriter(buf)
+	_, err := gz.Write(tinyRootFS(t))
+	require.NoError(err)
+	require.NoError(gz.Close())
+	require.NoError(os.WriteFile(filepath.Join(dir, "rootfs.tar.gz"), buf.Bytes(), 0644))
+	sum := fmt.Sprintf("%x", sha256.Sum256(buf.Bytes()))
+
+	registry, err := json.Marshal(map[string]any{
+		"images": []any{map[string]any{
+			"name": "tiny",
+			"versions": []any{map[string]any{
+				"tags": []string{"latest", "1.0"},
+				"arch": runtime.GOARCH,
+				"rootfs": map[string]string{
+					"url":    rootfsURL,
+					"sha256": sum,
+				},
+			}},
+		}},
+	})
+	require.NoError(err)
+	require.NoError(os.WriteFile(filepath.Join(dir, "registry.json"), registry, 0644))
+	return sum
+}
+
+func TestPullImage(t *testing.T) {
+	t.Run("pulls from http registries", func(t *testing.T) {
+		require := require.New(t)
+		dir := t.TempDir()
+		writeRegistry(t, dir, "rootfs.tar.gz")
+		server := httptest.NewServer(http.FileServer(http.Dir(dir)))
+		defer server.Close()
+
+		foxbox := client.FromStore(newStore(t))
+		image, err := foxbox.PullImage("tiny:1.0", &client.PullOptions{
+			Registry: server.URL + "/registry.json",
+		})
+		require.NoError(err)
+		require.Equal("tiny:1.0", image.Name)
+
+		images, err := foxbox.ListImages()
+		require.NoError(err)
+		require.Equal([]client.Image{{Name: "tiny:1.0"}}, images)
+
+		name, err := foxbox.Create(&client.CreateOptions{
+			Image:         "tiny:1.0",
+			StorageDriver: client.StorageCopy,
+		})
+		require.NoError(err)
+		info, err := foxbox.Inspect(name)
+		require.NoError(err)
+		content, err := os.ReadFile(filepath.Join(info.Path, "boxfs", "etc", "hostname"))
+		require.NoError(err)
+		require.Equal("fox\n", string(content))
+	})
+
+	t.Run("pulls from file registries", func(t *testing.T) {
+		require := require.New(t)
+		dir := t.TempDir()
+		writeRegistry(t, dir, "file://"+filepath.Join(dir, "rootfs.tar.gz"))
+
+		foxbox := client.FromStore(newStore(t))
+		image, err := foxbox.PullImage("tiny", &client.PullOptions{
+			Registry: "file://" + filepath.Join(dir, "registry.json"),
+		})
+		require.NoError(err)
+		require.Equal("tiny:latest", image.Name)
+	})
+
+	t.Run("rejects unknown images and tags", func(t *testing.T) {
+		require := require.New(t)
+		dir := t.TempDir()
+		writeRegistry(t, dir, "rootfs.tar.gz")
+		opt := &client.PullOptions{Registry: "file://" + filepath.Join(dir, "registry.json")}
+
+		foxbox := client.FromStore(newStore(t))
+		_, err := foxbox.PullImage("wolf", opt)
+		require.ErrorContains(err, "not found")
+		_, err = foxbox.PullImage("tiny:2.0", opt)
+		require.ErrorContains(err, "no tag 2.0")
+		_, err = foxbox.PullImage("tiny:", opt)
+		require.ErrorContains(err, "invalid image reference")
+	})
+
+	t.Run("verifies the sha256", func(t *testing.T) {
+		require := require.New(t)
+		dir := t.TempDir()
+		writeRegistry(t, dir, "rootfs.tar.gz")
+		require.NoError(os.WriteFile(filepath.Join(dir, "rootfs.tar.gz"), []byte("tampered"), 0644))
+
+		store := newStore(t)
+		foxbox := client.FromStore(store)
+		_, err := foxbox.PullImage("tiny", &client.PullOptions{
+			Registry: "file://" + filepath.Join(dir, "registry.json"),
+		})
+		require.ErrorContains(err, "sha256 mismatch")
+
+		files, err := os.ReadDir(store.ImageBase())
+		require.NoError(err)
+		require.Empty(files, "failed pulls must not leave files behind")
+	})
+}
+
+func TestCreatePullPolicy(t *testing.T) {
+	require := require.New(t)
+	dir := t.TempDir()
+	writeRegistry(t, dir, "rootfs.tar.gz")
+	registry := "file://" + filepath.Join(dir, "registry.json")
+
+	foxbox := client.FromStore(newStore(t))
+
+	_, err := foxbox.Create(&client.CreateOptions{
+		Image:    "tiny",
+		Registry: registry,
+		Pull:     client.PullNever,
+	})
+	require.ErrorIs(err, os.ErrNotExist)
+	names, err := foxbox.List(nil)
+	require.NoError(err)
+	require.Empty(names, "failed creates must not leave boxes behind")
+
+	name, err := foxbox.Create(&client.CreateOptions{
+		Image:    "tiny",
+		Registry: registry,
+	})
+	require.NoError(err)
+	info, err := foxbox.Inspect(name)
+	require.NoError(err)
+	require.Equal("tiny:latest", info.Image.Name)
+
+	// Pulled images are found without a registry
+	_, err = foxbox.Create(&client.CreateOptions{
+		Image: "tiny",
+		Pull:  client.PullNever,
+	})
+	require.NoError(err)
+
+	require.NoError(os.Remove(filepath.Join(dir, "rootfs.tar.gz")))
+	_, err = foxbox.Create(&client.CreateOptions{
+		Image:    "tiny",
+		Registry: registry,
+		Pull:     client.PullAlways,
+	})
+	require.Error(err, "always must pull even if the image exists")
+}
@@ -0,0 +1,68 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+var ErrImageInUse = errors.New("image is in use")
+
+// Removes an image. Unless force is set, images that existing
+// boxes were created from are kept and ErrImageInUse is returned.
+func (client *client) RemoveImage(name string, force bool) error {
+	stored, _, _, err := findImage(client.store, name)
+	if err != nil {
+		return err
+	}
+
+	if !force {
+		boxes, err := client.boxesUsingImage(stored)
+		if err != nil {
+			return err
+		}
+		if len(boxes) > 0 {
+			return fmt.Errorf("%w by %s (use force to remove it anyway)", ErrImageInUse, strings.Join(boxes, ", "))
+		}
+	}
+
+	var errs []error
+	paths := []string{
+		client.store.GetImagePath(stored, false),
+		client.store.GetImagePath(stored, true),
+		client.store.GetImageMetaPath(stored),
+	}
+	for _, path := range paths {
+		err = os.Remove(path)
+		if err != nil && !os.IsNotExist(err) {
+			errs = append(errs, err)
+		}
+	}
+	errs = append(errs, client.removeUnusedLayers())
+	return errors.Join(errs...)
+}
+
+func (client *client) boxesUsingImage(image string) (boxes []string, err error) {
+	names, err := client.List(nil)
+	if err != nil {
+		return
+	}
+	for _, name := range names {
+		entry, err := client.store.GetEntry(name)
+		if err != nil {
+			return nil, err
+		}
+		config, err := getBoxConfig(entry)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("reading config of %s: %w", name, err)
+		}
+		if config.Image.Name == image {
+			boxes = append(boxes, name)
+		}
+	}
+	return
+}
@@ -0,0 +1,42 @@
+package client_test
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/codingpa-ws/foxbox/client"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRemoveImage(t *testing.T) {
+	require := require.New(t)
+	foxbox := client.FromStore(newStore(t))
+
+	require.ErrorIs(foxbox.RemoveImage("tiny", false), os.ErrNotExist)
+
+	require.NoError(foxbox.ImportImage("tiny", bytes.NewReader(tinyRootFS(t))))
+	name, err := foxbox.Create(&client.CreateOptions{
+		Image: "tiny",
+		Pull:  client.PullNever,
+	})
+	require.NoError(err)
+
+	err = foxbox.RemoveImage("tiny", false)
+	require.ErrorIs(err, client.ErrImageInUse)
+	require.ErrorContains(err, name)
+
+	require.NoError(foxbox.Delete(name, nil))
+	require.NoError(foxbox.RemoveImage("tiny", false))
+	images, err := foxbox.ListImages()
+	require.NoError(err)
+	require.Empty(images)
+
+	require.NoError(foxbox.ImportImage("tiny", bytes.NewReader(tinyRootFS(t))))
+	_, err = foxbox.Create(&client.CreateOptions{
+		Image: "tiny",
+		Pull:  client.PullNever,
+	})
+	require.NoError(err)
+	require.NoError(foxbox.RemoveImage("tiny", true))
+}
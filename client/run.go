@@ -10,8 +10,10 @@ import (
 	"os/exec"
 	"path/filepath"
 	"syscall"
+	"time"
 
 	"github.com/codingpa-ws/foxbox/internal/cgroup2"
+	"github.com/codingpa-ws/foxbox/internal/logfile"
 	"github.com/codingpa-ws/foxbox/internal/security"
 	"github.com/codingpa-ws/foxbox/internal/slirp"
 	"github.com/codingpa-ws/foxbox/internal/store"
@@ -20,11 +22,24 @@ import (
 )
 
 type VolumeConfig struct {
-	HostPath, BoxPath string
+	HostPath string `json:"hostPath"`
+	BoxPath  string `json:"boxPath"`
 }
 
 type RunOptions struct {
+	// Replaces the cmd of the image
 	Command []string
+	// Replaces the entrypoint and cmd of the image. A single
+	// empty string removes the entrypoint of the image.
+	Entrypoint []string
+	// Variables formatted as KEY=value, added to or
+	// replacing those of the image
+	Env []string
+	// Defaults to the working directory of the image or /
+	WorkDir string
+	// User to run as, formatted as user[:group] with names or
+	// ids. Only root is supported because boxes map no other ids.
+	User string
 
 	Stdin  io.Reader
 	Stdout io.Writer
@@ -37,8 +52,35 @@ type RunOptions struct {
 	MaxCPUs        float32
 	MaxMemoryBytes uint
 	MaxProcesses   uint
+
+	// Runs the box in the background under a supervisor process
+	// and returns as soon as the box has started. Standard streams
+	// are not attached to detached boxes.
+	Detach bool
+
+	// Where stdout and stderr are stored for Client.Logs in addition
+	// to Stdout and Stderr. Defaults to LogDriverFile for detached
+	// boxes and LogDriverNone otherwise.
+	LogDriver LogDriver
+	// Size in bytes after which the log file is rotated
+	// (default 10 MB) and the number of rotated files
+	// to keep (default 3).
+	LogMaxSize  int64
+	LogMaxFiles int
 }
 
+type LogDriver string
+
+const (
+	LogDriverNone LogDriver = "none"
+	LogDriverFile LogDriver = "file"
+)
+
+const (
+	defaultLogMaxSize  = 10 * 1000 * 1000
+	defaultLogMaxFiles = 3
+)
+
 func (self RunOptions) getStdin() io.Reader {
 	if self.Stdin == nil {
 		return os.Stdin
@@ -58,6 +100,30 @@ func (self RunOptions) getStderr() io.Writer {
 	}
 	return self.Stderr
 }
+func (self RunOptions) getLogDriver() LogDriver {
+	if self.LogDriver == "" {
+		if self.Detach {
+			return LogDriverFile
+		}
+		return LogDriverNone
+	}
+	return self.LogDriver
+}
+
+func (self RunOptions) getLogMaxSize() int64 {
+	if self.LogMaxSize <= 0 {
+		return defaultLogMaxSize
+	}
+	return self.LogMaxSize
+}
+
+func (self RunOptions) getLogMaxFiles() int {
+	if self.LogMaxFiles <= 0 {
+		return defaultLogMaxFiles
+	}
+	return self.LogMaxFiles
+}
+
 func (self RunOptions) NeedsCGroup() bool {
 	return self.MaxCPUs > 0 || self.MaxMemoryBytes > 0 || self.MaxProcesses > 0
 }
@@ -71,6 +137,13 @@ func init() {
 		}
 		return
 	}
+	if _, ok := os.LookupEnv("FOXBOX_SUPERVISE"); ok {
+		err := supervise()
+		if err != nil {
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
 }
 
 func (client *client) Run(name string, opt *RunOptions) (err error) {
@@ -80,31 +153,66 @@ func (client *client) Run(name string, opt *RunOptions) (err error) {
 	if err != nil {
 		return
 	}
+	name = entry.Name()
+
+	if opt.Detach {
+		return detach(name, client.store, entry, opt)
+	}
 
 	err = run(name, entry, opt)
 
 	return
 }
 
+func (client *client) Start(name string, opt *RunOptions) (err error) {
+	detached := *newOr(opt)
+	detached.Detach = true
+	return client.Run(name, &detached)
+}
+
 func run(name string, entry *store.StoreEntry, opt *RunOptions) error {
+	box, err := start(name, entry, opt)
+	if err != nil {
+		return err
+	}
+	return box.wait()
+}
+
+// A started box process together with the resources
+// that need to be released once it has exited.
+type box struct {
+	entry  *store.StoreEntry
+	state  store.RunState
+	cmd    *exec.Cmd
+	slirp  *exec.Cmd
+	cgroup *cgroup2.CGroup
+	log    *logfile.Writer
+	// Log streams that are flushed once the box has exited
+	logStreams []io.Closer
+}
+
+func start(name string, entry *store.StoreEntry, opt *RunOptions) (b *box, err error) {
 	conflictingPID, running, err := entry.GetPID()
 	if err != nil && !os.IsNotExist(err) {
-		return fmt.Errorf("getting pid of potentially conflicting process: %w", err)
+		return nil, fmt.Errorf("getting pid of potentially conflicting process: %w", err)
 	}
 	if running {
-		return fmt.Errorf("already running with pid %d, use client.Exec", conflictingPID)
+		return nil, fmt.Errorf("already running with pid %d, use client.Exec", conflictingPID)
 	}
 	executable, err := os.Executable()
 	if err != nil {
-		return fmt.Errorf("finding foxbox executable: %w", err)
+		return nil, fmt.Errorf("finding foxbox executable: %w", err)
 	}
 
 	cgroup, err := cgroup2.Open("foxbox-" + name)
 	if err != nil {
-		return fmt.Errorf("creating cgroup foxbox-%s: %w", name, err)
+		return nil, fmt.Errorf("creating cgroup foxbox-%s: %w", name, err)
 	}
+	b = &box{entry: entry, cgroup: cgroup}
 	defer func() {
-		err = errors.Join(err, cgroup.Delete())
+		if err != nil {
+			err = errors.Join(err, b.release())
+		}
 	}()
 
 	var useCGroup = opt.NeedsCGroup() && os.Getenv("CI_NO_CGROUP") == ""
@@ -113,23 +221,32 @@ func run(name string, entry *store.StoreEntry, opt *RunOptions) error {
 	if useCGroup {
 		cgroupDir, err := os.Open(cgroup.Path())
 		if err != nil {
-			return fmt.Errorf("opening cgroup dir: %w", err)
+			return b, fmt.Errorf("opening cgroup dir: %w", err)
 		}
 		defer cgroupDir.Close()
 		err = setupCgroup(cgroup, opt)
 		if err != nil {
-			return fmt.Errorf("setting up cgroup: %w", err)
+			return b, fmt.Errorf("setting up cgroup: %w", err)
 		}
 		cgroupFd = int(cgroupDir.Fd())
 	}
 	sysProcAttr, err := security.GetSysProcAttr(cgroupFd, useCGroup)
 	if err != nil {
-		return fmt.Errorf("getting proc attributes: %w", err)
+		return b, fmt.Errorf("getting proc attributes: %w", err)
 	}
 
 	volumes, err := encodeVolumes(opt.Volumes)
 	if err != nil {
-		return fmt.Errorf("encoding volume data (%v): %w", opt.Volumes, err)
+		return b, fmt.Errorf("encoding volume data (%v): %w", opt.Volumes, err)
+	}
+
+	image, err := boxImageConfig(entry)
+	if err != nil {
+		return b, fmt.Errorf("reading image config: %w", err)
+	}
+	err = updateRunConfig(name, entry, opt)
+	if err != nil {
+		return b, fmt.Errorf("storing run config: %w", err)
 	}
 
 	noTmpfs := "0"
@@ -137,36 +254,126 @@ func run(name string, entry *store.StoreEntry, opt *RunOptions) error {
 		noTmpfs = "1"
 	}
 
-	cmd := exec.Command(executable, opt.Command...)
+	stdout, stderr := opt.getStdout(), opt.getStderr()
+	switch driver := opt.getLogDriver(); driver {
+	case LogDriverFile:
+		b.log, err = logfile.NewWriter(entry.LogPath(), opt.getLogMaxSize(), opt.getLogMaxFiles())
+		if err != nil {
+			return b, fmt.Errorf("opening log file: %w", err)
+		}
+		stdoutLog := b.log.Stream(logfile.Stdout)
+		stderrLog := b.log.Stream(logfile.Stderr)
+		b.logStreams = []io.Closer{stdoutLog, stderrLog}
+		stdout = io.MultiWriter(stdout, stdoutLog)
+		stderr = io.MultiWriter(stderr, stderrLog)
+	case LogDriverNone:
+	default:
+		return b, fmt.Errorf("unknown log driver %q", driver)
+	}
+
+	overlay, err := boxOverlayOptions(entry)
+	if err != nil {
+		return b, fmt.Errorf("preparing box file system: %w", err)
+	}
+	process, err := encodeProcess(newProcess(image, opt))
+	if err != nil {
+		return b, err
+	}
+
+	ready, readyWriter, err := os.Pipe()
+	if err != nil {
+		return b, fmt.Errorf("creating box pipe: %w", err)
+	}
+	defer ready.Close()
+
+	cmd := exec.Command(executable)
 	cmd.Stdin = opt.getStdin()
-	cmd.Stdout = opt.getStdout()
-	cmd.Stderr = opt.getStderr()
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
 	cmd.Dir = entry.FileSystem()
-	cmd.Env = []string{"FOXBOX_EXEC=" + name, "FOXBOX_MOUNTS=" + volumes, "FOXBOX_NO_TMPFS=" + noTmpfs}
+	cmd.Env = []string{"FOXBOX_EXEC=" + name, "FOXBOX_MOUNTS=" + volumes, "FOXBOX_NO_TMPFS=" + noTmpfs, "FOXBOX_OVERLAY=" + overlay, "FOXBOX_PROCESS=" + process}
+	cmd.ExtraFiles = []*os.File{readyWriter}
 	cmd.SysProcAttr = sysProcAttr
 
 	err = cmd.Start()
+	readyWriter.Close()
 	if err != nil {
-		return fmt.Errorf("starting process: %w", err)
+		return b, fmt.Errorf("starting process: %w", err)
 	}
+	b.cmd = cmd
 	err = entry.SetPID(cmd.Process.Pid)
 	if err != nil {
-		cmd.Process.Kill()
-		return fmt.Errorf("setting box pid: %w", err)
+		return b, fmt.Errorf("setting box pid: %w", err)
+	}
+	// Until then, the process is still outside of the box file system,
+	// so Exec and file system operations after Start mustn’t enter it.
+	// Boxes that fail to set up exit, which wait reports.
+	io.Copy(io.Discard, ready)
+	b.state = store.RunState{StartedAt: time.Now()}
+	err = entry.SetRunState(b.state)
+	if err != nil {
+		return b, fmt.Errorf("recording box start: %w", err)
 	}
 	if opt.EnableNetworking {
-		slirp, err := slirp.Start(cmd.Process.Pid)
+		b.slirp, err = slirp.Start(cmd.Process.Pid)
+		if err != nil {
+			return b, fmt.Errorf("starting slirp (networking): %w", err)
+		}
+		err = entry.SetSlirpPID(b.slirp.Process.Pid)
 		if err != nil {
-			cmd.Process.Kill()
-			return fmt.Errorf("starting slirp (networking): %w", err)
+			return b, fmt.Errorf("setting slirp pid: %w", err)
 		}
-		defer slirp.Process.Kill()
 	}
-	err = cmd.Wait()
-	if cmd.ProcessState == nil {
-		return fmt.Errorf("starting process (no process state): %w", err)
+	return b, nil
+}
+
+// Waits for the box process to exit and releases its resources.
+// The exit is recorded last, once the remaining output is logged,
+// as following the log ends with it.
+func (self *box) wait() (err error) {
+	err = self.cmd.Wait()
+	releaseErr := self.release()
+	if self.cmd.ProcessState == nil {
+		return errors.Join(fmt.Errorf("starting process (no process state): %w", err), releaseErr)
+	}
+	if recordErr := self.recordExit(); recordErr != nil {
+		err = errors.Join(err, fmt.Errorf("recording exit status: %w", recordErr))
+	}
+	return errors.Join(err, releaseErr)
+}
+
+func (self *box) recordExit() error {
+	state := self.state
+	state.FinishedAt = time.Now()
+
+	status := self.cmd.ProcessState.Sys().(syscall.WaitStatus)
+	state.ExitCode = status.ExitStatus()
+	if status.Signaled() {
+		// Same convention as shells use for $?
+		state.ExitCode = 128 + int(status.Signal())
+		state.Signal = unix.SignalName(status.Signal())
 	}
-	return err
+
+	return self.entry.SetRunState(state)
+}
+
+func (self *box) release() error {
+	if self.cmd != nil && self.cmd.ProcessState == nil {
+		self.cmd.Process.Kill()
+		self.cmd.Wait()
+	}
+	if self.slirp != nil {
+		self.slirp.Process.Kill()
+		self.slirp.Wait()
+	}
+	var errs []error
+	for _, stream := range self.logStreams {
+		errs = append(errs, stream.Close())
+	}
+	if self.log != nil {
+		errs = append(errs, self.log.Close())
+	}
+	return errors.Join(append(errs, self.cgroup.Delete())...)
 }
 
 func setupCgroup(cgroup *cgroup2.CGroup, opt *RunOptions) (err error) {
@@ -219,8 +426,35 @@ func encodeVolumes(volumes []VolumeConfig) (string, error) {
 	return fmt.Sprintf("%x", mountBuf.String()), nil
 }
 
+// Returns the overlayfs mount options for overlay boxes
+// and an empty string for all other boxes.
+func boxOverlayOptions(entry *store.StoreEntry) (string, error) {
+	storage, err := entry.GetStorage()
+	if os.IsNotExist(err) || (err == nil && storage.Driver != store.DriverOverlay) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	layer, err := entry.Store().LayerPath(storage.Layer)
+	if err != nil {
+		return "", err
+	}
+	return overlayOptions(entry.FileSystem(), layer, entry.UpperDir(), entry.WorkDir())
+}
+
+// The box process closes this file descriptor (the first of
+// cmd.ExtraFiles) once it has set up the box and runs its command.
+const boxReadyFd = 3
+
 func child() (err error) {
+	// Closed by executing the command, or by exiting
+	syscall.CloseOnExec(boxReadyFd)
 	name := os.Getenv("FOXBOX_EXEC")
+	err = mountOverlay()
+	if err != nil {
+		return
+	}
 	err = prepareFs()
 	if err != nil {
 		return err
@@ -229,10 +463,8 @@ func child() (err error) {
 	if err != nil {
 		return fmt.Errorf("setting hostname to %s: %w", name, err)
 	}
-	_, err = os.ReadFile("/etc/hostname")
-	if !os.IsNotExist(err) {
-		_ = os.WriteFile("/etc/hostname", []byte(name+"\n"), 0644)
-	}
+	// Also created when missing, as commits leave it out
+	_ = os.WriteFile("/etc/hostname", []byte(name+"\n"), 0644)
 	err = linkStandardStreams()
 	if err != nil {
 		return
@@ -245,17 +477,27 @@ func child() (err error) {
 	if err != nil {
 		return fmt.Errorf("restricting syscalls: %w", err)
 	}
-	args := []string{"sh"}
-	if len(os.Args) > 1 {
-		args = os.Args[1:]
-	}
-
 	defer syscall.Unmount("proc", 0)
-	err = syscall.Exec("/bin/sh", args, []string{"PATH=/bin:/sbin:/usr/bin:/usr/sbin", "LANG=C.UTF-8", "CHARSET=UTF-8"})
+	return execProcess()
+}
+
+// Mounts the overlay on the working directory (the box file
+// system) and enters it.
+func mountOverlay() error {
+	options := os.Getenv("FOXBOX_OVERLAY")
+	if options == "" {
+		return nil
+	}
+	wd, err := os.Getwd()
 	if err != nil {
 		return err
 	}
-	return nil
+	err = unix.Mount("overlay", ".", "overlay", 0, options)
+	if err != nil {
+		return fmt.Errorf("mounting overlay: %w", err)
+	}
+	// The working directory still refers to the directory below
+	return os.Chdir(wd)
 }
 
 func prepareFs() (err error) {
@@ -0,0 +1,125 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/codingpa-ws/foxbox/internal/store"
+)
+
+// How long Stop waits for the box to exit after killing it.
+const killTimeout = 5 * time.Second
+
+// Sends a signal to the box process (pid 1 in the box). Note that
+// pid 1 only receives signals it has installed a handler for, with
+// the exception of SIGKILL and SIGSTOP.
+func (client *client) Kill(name string, signal syscall.Signal) (err error) {
+	entry, err := client.store.GetEntry(name)
+	if err != nil {
+		return
+	}
+	name = entry.Name()
+	pid, running, err := entry.GetPID()
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("getting box pid: %w", err)
+	}
+	if !running {
+		return fmt.Errorf("box %s is not running", name)
+	}
+
+	return syscall.Kill(pid, signal)
+}
+
+// Sends SIGTERM to the box process and kills all processes in the
+// box if it hasn’t exited after the timeout. Stopping a box that
+// isn’t running only cleans up leftovers of previous runs.
+func (client *client) Stop(name string, timeout time.Duration) (err error) {
+	entry, err := client.store.GetEntry(name)
+	if err != nil {
+		return
+	}
+	name = entry.Name()
+	pid, running, err := entry.GetPID()
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("getting box pid: %w", err)
+	}
+
+	if running {
+		err = stopProcess(name, entry, pid, timeout)
+		if err != nil {
+			return
+		}
+	}
+
+	return cleanUpStopped(entry)
+}
+
+func stopProcess(name string, entry *store.StoreEntry, pid int, timeout time.Duration) error {
+	// Look up the cgroup while the process still exists
+	cgroup, hasCGroup := boxCGroup(name, pid)
+
+	err := syscall.Kill(pid, syscall.SIGTERM)
+	if err != nil && !errors.Is(err, syscall.ESRCH) {
+		return fmt.Errorf("sending SIGTERM: %w", err)
+	}
+	if waitForExit(entry, timeout) {
+		return nil
+	}
+
+	if hasCGroup {
+		err = cgroup.Kill()
+		if err != nil {
+			return fmt.Errorf("killing cgroup %s: %w", cgroup.Name(), err)
+		}
+	}
+	// Killing pid 1 takes down the whole pid namespace,
+	// so this also covers boxes without a cgroup.
+	err = syscall.Kill(pid, syscall.SIGKILL)
+	if err != nil && !errors.Is(err, syscall.ESRCH) {
+		return fmt.Errorf("sending SIGKILL: %w", err)
+	}
+	if !waitForExit(entry, killTimeout) {
+		return fmt.Errorf("box %s is still running after SIGKILL", name)
+	}
+	return nil
+}
+
+func waitForExit(entry *store.StoreEntry, timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for {
+		_, running, err := entry.GetPID()
+		if err != nil || !running {
+			return true
+		}
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// Kills a slirp4netns process left behind by a crashed
+// supervisor and removes the stale pid files.
+func cleanUpStopped(entry *store.StoreEntry) error {
+	pid, running, err := entry.GetSlirpPID()
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("getting slirp pid: %w", err)
+	}
+	if running && isSlirp(pid) {
+		err = syscall.Kill(pid, syscall.SIGTERM)
+		if err != nil && !errors.Is(err, syscall.ESRCH) {
+			return fmt.Errorf("stopping slirp: %w", err)
+		}
+	}
+	return entry.ClearPIDs()
+}
+
+// Guards against killing an unrelated process that reused the pid.
+func isSlirp(pid int) bool {
+	comm, err := os.ReadFile(fmt.Sprintf("/proc/%d/comm", pid))
+	return err == nil && strings.TrimSpace(string(comm)) == "slirp4netns"
+}
@@ -0,0 +1,83 @@
+package client_test
+
+import (
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/codingpa-ws/foxbox/client"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStop(t *testing.T) {
+	if testing.Short() {
+		t.Skip("integration test is slow")
+	}
+
+	t.Run("stop kills boxes after timeout", func(t *testing.T) {
+		require := require.New(t)
+		store := newStore(t)
+		downloadImage(t, store)
+
+		foxbox := client.FromStore(store)
+		name, err := foxbox.Create(&client.CreateOptions{
+			Image: AlpineImageName,
+		})
+		require.NoError(err)
+
+		err = foxbox.Start(name, &client.RunOptions{
+			Command: []string{"sh", "-c", "trap '' TERM; sleep 10"},
+		})
+		require.NoError(err)
+
+		started := time.Now()
+		err = foxbox.Stop(name, 100*time.Millisecond)
+		require.NoError(err)
+		require.Less(time.Since(started), 5*time.Second)
+
+		entry, err := store.GetEntry(name)
+		require.NoError(err)
+		_, _, err = entry.GetPID()
+		require.ErrorIs(err, os.ErrNotExist, "stop must remove the stale pid file")
+
+		require.Eventually(func() bool {
+			info, err := foxbox.Inspect(name)
+			return err == nil && info.State.Status == client.StateExited
+		}, time.Second, 10*time.Millisecond)
+
+		require.NoError(foxbox.Stop(name, time.Second), "stopping a stopped box must succeed")
+	})
+
+	t.Run("kill sends signals", func(t *testing.T) {
+		require := require.New(t)
+		store := newStore(t)
+		downloadImage(t, store)
+
+		foxbox := client.FromStore(store)
+		name, err := foxbox.Create(&client.CreateOptions{
+			Image: AlpineImageName,
+		})
+		require.NoError(err)
+
+		require.Error(foxbox.Kill(name, syscall.SIGKILL), "killing a stopped box must fail")
+
+		err = foxbox.Start(name, &client.RunOptions{
+			Command: []string{"sleep", "10"},
+		})
+		require.NoError(err)
+
+		err = foxbox.Kill(name, syscall.SIGKILL)
+		require.NoError(err)
+
+		require.Eventually(func() bool {
+			info, err := foxbox.Inspect(name)
+			return err == nil && info.State.Status == client.StateExited
+		}, time.Second, 10*time.Millisecond)
+
+		info, err := foxbox.Inspect(name)
+		require.NoError(err)
+		require.Equal(137, info.State.ExitCode)
+		require.Equal("SIGKILL", info.State.Signal)
+	})
+}
@@ -0,0 +1,122 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"syscall"
+
+	"github.com/codingpa-ws/foxbox/internal/security"
+	"github.com/codingpa-ws/foxbox/internal/store"
+	"golang.org/x/sys/unix"
+)
+
+// How a box stores its file system on top of the image layer.
+type StorageDriver string
+
+const (
+	// Kernel overlayfs, only the box’s changes are stored
+	StorageOverlay StorageDriver = store.DriverOverlay
+	// A copy of the layer, reflinked where the file system supports it
+	StorageCopy StorageDriver = store.DriverCopy
+)
+
+const overlayProbeEnv = "FOXBOX_OVERLAY_PROBE"
+
+func init() {
+	if dir, ok := os.LookupEnv(overlayProbeEnv); ok {
+		err := probeOverlay(dir)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+}
+
+// Returns CreateOptions.StorageDriver, FOXBOX_STORAGE_DRIVER or,
+// if neither is set, overlay where supported and copy otherwise.
+func (client *client) storageDriver(opt *CreateOptions) (StorageDriver, error) {
+	driver := opt.StorageDriver
+	if driver == "" {
+		driver = StorageDriver(os.Getenv("FOXBOX_STORAGE_DRIVER"))
+	}
+	switch driver {
+	case StorageOverlay, StorageCopy:
+		return driver, nil
+	case "":
+		if overlaySupported(client.store) {
+			return StorageOverlay, nil
+		}
+		return StorageCopy, nil
+	default:
+		return "", fmt.Errorf("unknown storage driver %q: use %s or %s", driver, StorageOverlay, StorageCopy)
+	}
+}
+
+var overlaySupport struct {
+	once      sync.Once
+	supported bool
+}
+
+// Tries to mount an overlay in a user namespace once per process.
+// Needs Linux 5.11 or later for rootless overlayfs.
+func overlaySupported(store *store.Store) bool {
+	overlaySupport.once.Do(func() {
+		overlaySupport.supported = runOverlayProbe(store) == nil
+	})
+	return overlaySupport.supported
+}
+
+func runOverlayProbe(store *store.Store) error {
+	executable, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	uid, gid, err := security.GetUserIdentifiers()
+	if err != nil {
+		return err
+	}
+
+	// In the store, so the probe uses the same file system as boxes
+	dir, err := os.MkdirTemp(store.Base(), ".overlay-probe-")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		// overlayfs creates work/work without any permissions
+		os.Chmod(filepath.Join(dir, "work", "work"), 0700)
+		os.RemoveAll(dir)
+	}()
+
+	cmd := exec.Command(executable)
+	cmd.Env = []string{overlayProbeEnv + "=" + dir}
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Cloneflags:  syscall.CLONE_NEWUSER | syscall.CLONE_NEWNS,
+		UidMappings: []syscall.SysProcIDMap{{ContainerID: 0, HostID: int(uid), Size: 1}},
+		GidMappings: []syscall.SysProcIDMap{{ContainerID: 0, HostID: int(gid), Size: 1}},
+	}
+	return cmd.Run()
+}
+
+func probeOverlay(dir string) error {
+	err := os.Chdir(dir)
+	if err != nil {
+		return err
+	}
+	for _, dir := range []string{"lower", "upper", "work", "merged"} {
+		err = os.Mkdir(dir, 0755)
+		if err != nil {
+			return err
+		}
+	}
+	err = unix.Mount("overlay", "merged", "overlay", 0, "lowerdir=lower,upperdir=upper,workdir=work,userxattr")
+	if err != nil {
+		return fmt.Errorf("mounting overlay: %w", err)
+	}
+	err = os.WriteFile(filepath.Join("merged", "probe"), nil, 0644)
+	return errors.Join(err, unix.Unmount("merged", 0))
+}
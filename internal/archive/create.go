@@ -0,0 +1,355 @@
+package archive
+
+import (
+	"archive/tar"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// Writes the contents of root to w as tar archive. Files owned by
+// the current user are stored as owned by root, which is what the
+// user is mapped to in boxes. Sockets are skipped.
+func Create(w io.Writer, root string) error {
+	return create(w, root, "", nil)
+}
+
+// Like Create, but leaves out files for which skip returns true and
+// the contents of skipped directories. skip is called with a path to
+// open each file with and its name relative to root, e.g. etc/hostname.
+func CreateFiltered(w io.Writer, root string, skip func(path, name string) bool) error {
+	return create(w, root, "", skip)
+}
+
+// Copies the file or directory src into root as dst, or the contents
+// of src into dst if src is a directory. dst is resolved within root
+// like archive entries, so symlinks in root can’t lead outside of it.
+func Copy(src, root, dst string) error {
+	r, w := io.Pipe()
+	created := make(chan error, 1)
+	go func() {
+		err := create(w, src, clean(dst), nil)
+		w.CloseWithError(err)
+		created <- err
+	}()
+
+	err := Extract(r, root)
+	// Unblocks create if extracting failed
+	r.Close()
+	return errors.Join(err, <-created)
+}
+
+// Writes the file or directory name within root to w as tar archive,
+// named prefix. name is resolved like entries by Extract, so symlinks in
+// root can’t lead outside of it. The contents of mounted proc and sysfs
+// file systems are left out.
+func CreateAt(w io.Writer, root, name, prefix string) error {
+	prefix = clean(prefix)
+	if prefix == "" {
+		return fmt.Errorf("invalid archive name %q", prefix)
+	}
+	rootFd, err := unix.Open(root, unix.O_PATH|unix.O_DIRECTORY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return fmt.Errorf("opening %s: %w", root, err)
+	}
+	defer unix.Close(rootFd)
+	fd, err := unix.Openat2(rootFd, path.Join(".", clean(name)), &unix.OpenHow{
+		Flags:   unix.O_PATH | unix.O_CLOEXEC,
+		Resolve: unix.RESOLVE_IN_ROOT | unix.RESOLVE_NO_MAGICLINKS,
+	})
+	if err != nil {
+		return fmt.Errorf("opening %s: %w", name, err)
+	}
+	defer unix.Close(fd)
+
+	tw := newWriter(w)
+	err = tw.addFd(fd, prefix)
+	if err != nil {
+		return err
+	}
+	return tw.Close()
+}
+
+// Archives root with entry names below prefix. Like with CreateAt,
+// files are opened relative to their directory, so root can be the
+// file system of a running box.
+func create(w io.Writer, root, prefix string, skip func(path, name string) bool) error {
+	rootFd, err := unix.Open(root, unix.O_PATH|unix.O_NOFOLLOW|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return fmt.Errorf("opening %s: %w", root, err)
+	}
+	defer unix.Close(rootFd)
+
+	tw := newWriter(w)
+	tw.skip = skip
+	info, err := os.Stat(procPath(rootFd))
+	if err != nil {
+		return fmt.Errorf("opening %s: %w", root, err)
+	}
+	if info.IsDir() {
+		err = tw.addChildren(rootFd, prefix)
+	} else {
+		err = tw.addFd(rootFd, prefix)
+	}
+	if err != nil {
+		return err
+	}
+	return tw.Close()
+}
+
+// Writes an OCI image layer with the given paths of root, which are
+// relative and separated by slashes, and whiteouts for deleted paths.
+// Directories are added without their contents. Paths are resolved
+// like entries by Extract, so symlinks in root can’t lead outside of it.
+func CreateLayer(w io.Writer, root string, paths, deleted []string) error {
+	rootFd, err := unix.Open(root, unix.O_PATH|unix.O_DIRECTORY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return fmt.Errorf("opening %s: %w", root, err)
+	}
+	defer unix.Close(rootFd)
+
+	tw := newWriter(w)
+	for _, name := range paths {
+		fd, err := unix.Openat2(rootFd, path.Join(".", clean(name)), &unix.OpenHow{
+			Flags:   unix.O_PATH | unix.O_NOFOLLOW | unix.O_CLOEXEC,
+			Resolve: unix.RESOLVE_IN_ROOT | unix.RESOLVE_NO_MAGICLINKS,
+		})
+		if err != nil {
+			return fmt.Errorf("opening %s: %w", name, err)
+		}
+		_, err = tw.addFile(fd, clean(name))
+		unix.Close(fd)
+		if err != nil {
+			return err
+		}
+	}
+	for _, name := range deleted {
+		dir, base := path.Split(clean(name))
+		err := tw.WriteHeader(&tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     dir + whiteoutPrefix + base,
+			Mode:     0644,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return tw.Close()
+}
+
+type writer struct {
+	*tar.Writer
+	// First name of files with multiple hard links by inode
+	links    map[uint64]string
+	uid, gid int
+	// Leaves out files and the contents of directories, if set
+	skip func(path, name string) bool
+}
+
+func newWriter(w io.Writer) *writer {
+	return &writer{Writer: tar.NewWriter(w), links: map[uint64]string{}, uid: os.Getuid(), gid: os.Getgid()}
+}
+
+// Adds the file opened as fd with O_PATH as name, and the contents of
+// directories. Children are opened relative to their directory without
+// following symlinks, so replacing directories while archiving can’t
+// lead elsewhere.
+func (self *writer) addFd(fd int, name string) error {
+	info, err := self.addFile(fd, name)
+	if err != nil || !info.IsDir() {
+		return err
+	}
+	return self.addChildren(fd, name)
+}
+
+// Adds the file opened as fd with O_PATH as name, without the contents
+// of directories. Sockets are skipped.
+func (self *writer) addFile(fd int, name string) (fs.FileInfo, error) {
+	file := procPath(fd)
+	info, err := os.Stat(file)
+	if err != nil {
+		return nil, fmt.Errorf("archiving %s: %w", name, err)
+	}
+	if info.Mode().Type() == fs.ModeSocket {
+		return info, nil
+	}
+	var link string
+	if info.Mode().Type() == fs.ModeSymlink {
+		link, err = readlinkFd(fd)
+		if err != nil {
+			return nil, fmt.Errorf("archiving %s: %w", name, err)
+		}
+	}
+	// Follows the magic link in /proc to the file itself
+	xattrs, err := readXattrs(file)
+	if err != nil {
+		return nil, fmt.Errorf("archiving %s: %w", name, err)
+	}
+	return info, self.write(file, name, info, link, xattrs)
+}
+
+// Adds the contents of the directory opened as fd with names below name.
+func (self *writer) addChildren(fd int, name string) error {
+	var stat unix.Statfs_t
+	err := unix.Fstatfs(fd, &stat)
+	if err != nil {
+		return fmt.Errorf("archiving %s: %w", name, err)
+	}
+	if stat.Type == unix.PROC_SUPER_MAGIC || stat.Type == unix.SYSFS_MAGIC {
+		// Mounted in running boxes, with nothing to copy
+		return nil
+	}
+
+	dir, err := os.Open(procPath(fd))
+	if err != nil {
+		return fmt.Errorf("archiving %s: %w", name, err)
+	}
+	names, err := dir.Readdirnames(-1)
+	dir.Close()
+	if err != nil {
+		return fmt.Errorf("archiving %s: %w", name, err)
+	}
+	slices.Sort(names)
+	for _, child := range names {
+		childName := path.Join(name, child)
+		childFd, err := unix.Openat(fd, child, unix.O_PATH|unix.O_NOFOLLOW|unix.O_CLOEXEC, 0)
+		if err != nil {
+			return fmt.Errorf("archiving %s: %w", childName, err)
+		}
+		if self.skip == nil || !self.skip(procPath(childFd), childName) {
+			err = self.addFd(childFd, childName)
+		}
+		unix.Close(childFd)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (self *writer) write(path, name string, info fs.FileInfo, link string, xattrs map[string]string) error {
+	header, err := fileHeader(name, info, link, xattrs, self.links)
+	if err != nil {
+		return fmt.Errorf("archiving %s: %w", path, err)
+	}
+	if header.Uid == self.uid {
+		header.Uid = 0
+	}
+	if header.Gid == self.gid {
+		header.Gid = 0
+	}
+
+	err = self.WriteHeader(header)
+	if err != nil || header.Typeflag != tar.TypeReg {
+		return err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	// Files may grow while archiving, like logs, or have
+	// no size at all, like those in /proc
+	_, err = io.CopyN(self, f, header.Size)
+	if errors.Is(err, io.EOF) {
+		return fmt.Errorf("archiving %s: file shrank while archiving", path)
+	}
+	return err
+}
+
+func fileHeader(rel string, info fs.FileInfo, link string, xattrs map[string]string, links map[uint64]string) (*tar.Header, error) {
+	header, err := tar.FileInfoHeader(info, link)
+	if err != nil {
+		return nil, err
+	}
+	header.Name = filepath.ToSlash(rel)
+	if info.IsDir() {
+		header.Name += "/"
+	}
+	header.Uname, header.Gname = "", ""
+
+	stat := info.Sys().(*syscall.Stat_t)
+	if header.Typeflag == tar.TypeReg && stat.Nlink > 1 {
+		if first, ok := links[stat.Ino]; ok {
+			header.Typeflag = tar.TypeLink
+			header.Linkname = first
+			header.Size = 0
+		} else {
+			links[stat.Ino] = header.Name
+		}
+	}
+
+	for name, value := range xattrs {
+		if header.PAXRecords == nil {
+			header.PAXRecords = map[string]string{}
+		}
+		header.PAXRecords[xattrPrefix+name] = value
+	}
+	if header.PAXRecords != nil {
+		header.Format = tar.FormatPAX
+	}
+	return header, nil
+}
+
+// Reads the xattrs of path, following symlinks.
+func readXattrs(path string) (map[string]string, error) {
+	size, err := unix.Listxattr(path, nil)
+	if errors.Is(err, unix.ENOTSUP) || size == 0 {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("listing xattrs: %w", err)
+	}
+	buf := make([]byte, size)
+	size, err = unix.Listxattr(path, buf)
+	if err != nil {
+		return nil, fmt.Errorf("listing xattrs: %w", err)
+	}
+
+	xattrs := map[string]string{}
+	for _, name := range strings.Split(strings.TrimRight(string(buf[:size]), "\x00"), "\x00") {
+		// Internal state of overlayfs in rootless mode. Lists read
+		// through a mounted overlay may contain empty names as well.
+		if name == "" || strings.HasPrefix(name, "user.overlay.") {
+			continue
+		}
+		size, err := unix.Getxattr(path, name, nil)
+		if err != nil {
+			return nil, fmt.Errorf("reading xattr %s: %w", name, err)
+		}
+		value := make([]byte, size)
+		size, err = unix.Getxattr(path, name, value)
+		if err != nil {
+			return nil, fmt.Errorf("reading xattr %s: %w", name, err)
+		}
+		xattrs[name] = string(value[:size])
+	}
+	return xattrs, nil
+}
+
+func procPath(fd int) string {
+	return fmt.Sprintf("/proc/self/fd/%d", fd)
+}
+
+// Reads the target of a symlink opened with O_PATH.
+func readlinkFd(fd int) (string, error) {
+	for size := 256; ; size *= 2 {
+		buf := make([]byte, size)
+		n, err := unix.Readlinkat(fd, "", buf)
+		if err != nil {
+			return "", err
+		}
+		if n < size {
+			return string(buf[:n]), nil
+		}
+	}
+}
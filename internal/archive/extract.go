@@ -0,0 +1,440 @@
+// Package archive extracts tar archives into box file systems.
+//
+// All paths are resolved with openat2(RESOLVE_IN_ROOT), so neither
+// ../ entries nor symlinks in the archive can reach outside the root.
+package archive
+
+import (
+	"archive/tar"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+const xattrPrefix = "SCHILY.xattr."
+
+// Extracts the tar archive r into the existing directory root.
+// Later entries replace earlier ones. Device nodes are skipped
+// because they can’t be created without privileges. Ownership and
+// xattrs are restored where permitted.
+func Extract(r io.Reader, root string) error {
+	return extract(r, root, &extractor{})
+}
+
+// Like Extract, but applies an OCI image layer on top of root:
+// .wh.<name> entries remove <name> from lower layers and
+// .wh..wh..opq entries remove all lower contents of their directory.
+func ExtractLayer(r io.Reader, root string) error {
+	return extract(r, root, &extractor{layer: map[string]bool{}})
+}
+
+// Extracts an archive of a single file or directory, such as written
+// by CreateAt, to dst within root. Like with cp, it’s extracted into
+// dst if that is a directory and replaces dst otherwise. The parent
+// directory of dst must exist. dst is resolved like archive entries,
+// so symlinks in root can’t lead outside of it.
+func ExtractAt(r io.Reader, root, dst string) error {
+	x := &extractor{}
+	var from, to string
+	x.rename = func(name string) (string, error) {
+		name = clean(name)
+		if name == "" {
+			return "", nil
+		}
+		first, _, _ := strings.Cut(name, "/")
+		if from == "" {
+			var err error
+			from = first
+			to, err = x.target(clean(dst), first)
+			if err != nil {
+				return "", err
+			}
+		}
+		if first != from {
+			return "", fmt.Errorf("archive contains more than %s", from)
+		}
+		return to + strings.TrimPrefix(name, from), nil
+	}
+	return extract(r, root, x)
+}
+
+func extract(r io.Reader, root string, x *extractor) error {
+	rootFd, err := unix.Open(root, unix.O_PATH|unix.O_DIRECTORY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return fmt.Errorf("opening %s: %w", root, err)
+	}
+	defer unix.Close(rootFd)
+
+	x.root = rootFd
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		err = x.extract(header, tr)
+		if err != nil {
+			return fmt.Errorf("extracting %s: %w", header.Name, err)
+		}
+	}
+
+	return x.finishDirs()
+}
+
+type extractor struct {
+	root int
+	// Directory metadata is applied last, so read-only
+	// directories and mtimes aren’t affected by their children.
+	dirs []*tar.Header
+	// Paths extracted from the current layer, nil unless
+	// whiteouts are handled.
+	layer map[string]bool
+	// Maps entry and hardlink names, if set
+	rename func(name string) (string, error)
+}
+
+// Returns the path relative to the root or "." for the root itself.
+func clean(name string) string {
+	return strings.TrimPrefix(path.Clean("/"+name), "/")
+}
+
+func (self *extractor) extract(header *tar.Header, content io.Reader) error {
+	if self.rename != nil {
+		name, err := self.rename(header.Name)
+		if err != nil {
+			return err
+		}
+		if header.Typeflag == tar.TypeLink {
+			header.Linkname, err = self.rename(header.Linkname)
+			if err != nil {
+				return err
+			}
+		}
+		header.Name = name
+	}
+	rel := clean(header.Name)
+	if rel == "" {
+		// Metadata of the root directory stays as is
+		return nil
+	}
+
+	if self.layer != nil && strings.HasPrefix(path.Base(rel), whiteoutPrefix) {
+		return self.whiteout(rel)
+	}
+
+	switch header.Typeflag {
+	case tar.TypeChar, tar.TypeBlock, tar.TypeXGlobalHeader:
+		return nil
+	case tar.TypeDir, tar.TypeReg, tar.TypeGNUSparse, tar.TypeSymlink, tar.TypeLink, tar.TypeFifo:
+	default:
+		return fmt.Errorf("unsupported type %q", header.Typeflag)
+	}
+
+	parent, err := self.mkdirAll(path.Dir(rel))
+	if err != nil {
+		return err
+	}
+	defer unix.Close(parent)
+	base := path.Base(rel)
+
+	isDir := header.Typeflag == tar.TypeDir
+	// Layers replace directories of lower layers as a whole
+	exists, err := removeExisting(parent, base, isDir, self.layer != nil)
+	if err != nil {
+		return err
+	}
+	if self.layer != nil {
+		self.layer[rel] = true
+	}
+
+	switch header.Typeflag {
+	case tar.TypeDir:
+		if !exists {
+			err = unix.Mkdirat(parent, base, 0700)
+		}
+		if err == nil {
+			self.dirs = append(self.dirs, header)
+		}
+	case tar.TypeReg, tar.TypeGNUSparse:
+		err = writeFile(parent, base, content)
+	case tar.TypeSymlink:
+		err = unix.Symlinkat(header.Linkname, parent, base)
+	case tar.TypeLink:
+		err = self.link(header.Linkname, parent, base)
+	case tar.TypeFifo:
+		err = unix.Mknodat(parent, base, unix.S_IFIFO|0600, 0)
+	}
+	if err != nil {
+		return err
+	}
+
+	if isDir || header.Typeflag == tar.TypeLink {
+		// Hardlinks share the metadata of their target
+		return nil
+	}
+	return applyMetadata(parent, base, header)
+}
+
+const (
+	whiteoutPrefix = ".wh."
+	whiteoutOpaque = ".wh..wh..opq"
+)
+
+func (self *extractor) whiteout(rel string) error {
+	dir, base := path.Dir(rel), path.Base(rel)
+	parent, err := self.openDir(dir)
+	if errors.Is(err, unix.ENOENT) {
+		// Nothing to remove
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer unix.Close(parent)
+
+	if base != whiteoutOpaque {
+		return removeAt(parent, strings.TrimPrefix(base, whiteoutPrefix))
+	}
+
+	// Only lower layers are hidden, not what this layer added
+	f, err := os.Open(fdPath(parent, "."))
+	if err != nil {
+		return err
+	}
+	names, err := f.Readdirnames(-1)
+	f.Close()
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		if !self.layer[path.Join(dir, name)] {
+			err = removeAt(parent, name)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Removes parent/name recursively without following symlinks.
+func removeAt(parent int, name string) error {
+	if name == "" || name == "." || name == ".." || strings.Contains(name, "/") {
+		return fmt.Errorf("invalid file name %q", name)
+	}
+	return os.RemoveAll(fdPath(parent, name))
+}
+
+// Refers to name in the already resolved directory fd,
+// so only name itself is looked up again.
+func fdPath(fd int, name string) string {
+	return fmt.Sprintf("/proc/self/fd/%d/%s", fd, name)
+}
+
+// Opens the directory at rel, creating missing directories.
+func (self *extractor) mkdirAll(rel string) (int, error) {
+	fd, err := self.openDir(rel)
+	if !errors.Is(err, unix.ENOENT) || rel == "." {
+		return fd, err
+	}
+
+	parent, err := self.mkdirAll(path.Dir(rel))
+	if err != nil {
+		return -1, err
+	}
+	err = unix.Mkdirat(parent, path.Base(rel), 0755)
+	unix.Close(parent)
+	if err != nil && !errors.Is(err, unix.EEXIST) {
+		return -1, err
+	}
+	return self.openDir(rel)
+}
+
+func (self *extractor) openDir(rel string) (int, error) {
+	return unix.Openat2(self.root, rel, &unix.OpenHow{
+		Flags:   unix.O_PATH | unix.O_DIRECTORY | unix.O_CLOEXEC,
+		Resolve: unix.RESOLVE_IN_ROOT | unix.RESOLVE_NO_MAGICLINKS,
+	})
+}
+
+// Returns where the file name is extracted to for ExtractAt.
+func (self *extractor) target(dst, name string) (string, error) {
+	fd, err := self.openDir(path.Join(".", dst))
+	if err == nil {
+		unix.Close(fd)
+		return path.Join(dst, name), nil
+	}
+	if !errors.Is(err, unix.ENOENT) && !errors.Is(err, unix.ENOTDIR) {
+		return "", fmt.Errorf("opening %s: %w", dst, err)
+	}
+	fd, err = self.openDir(path.Dir(dst))
+	if err != nil {
+		return "", fmt.Errorf("opening %s: %w", path.Dir(dst), err)
+	}
+	unix.Close(fd)
+	return dst, nil
+}
+
+func (self *extractor) link(target string, parent int, base string) error {
+	rel := clean(target)
+	if rel == "" {
+		return fmt.Errorf("invalid hardlink target %q", target)
+	}
+	targetParent, err := self.openDir(path.Dir(rel))
+	if err != nil {
+		return fmt.Errorf("opening hardlink target %s: %w", target, err)
+	}
+	defer unix.Close(targetParent)
+	// Without AT_SYMLINK_FOLLOW, a symlink target is linked itself
+	return unix.Linkat(targetParent, path.Base(rel), parent, base, 0)
+}
+
+func (self *extractor) finishDirs() error {
+	for i := len(self.dirs) - 1; i >= 0; i-- {
+		header := self.dirs[i]
+		rel := clean(header.Name)
+		parent, err := self.openDir(path.Dir(rel))
+		if errors.Is(err, unix.ENOENT) || errors.Is(err, unix.ENOTDIR) {
+			// Removed by later entries
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("extracting %s: %w", header.Name, err)
+		}
+		base := path.Base(rel)
+		var stat unix.Stat_t
+		err = unix.Fstatat(parent, base, &stat, unix.AT_SYMLINK_NOFOLLOW)
+		if err == nil && stat.Mode&unix.S_IFMT == unix.S_IFDIR {
+			err = applyMetadata(parent, base, header)
+		} else if errors.Is(err, unix.ENOENT) {
+			// Replaced or removed by later entries
+			err = nil
+		}
+		unix.Close(parent)
+		if err != nil {
+			return fmt.Errorf("extracting %s: %w", header.Name, err)
+		}
+	}
+	return nil
+}
+
+// Removes whatever is at parent/base unless both it and the new
+// entry are directories, in which case exists is true. Directories
+// are only removed with their contents if recursive is set.
+func removeExisting(parent int, base string, isDir, recursive bool) (exists bool, err error) {
+	var stat unix.Stat_t
+	err = unix.Fstatat(parent, base, &stat, unix.AT_SYMLINK_NOFOLLOW)
+	if errors.Is(err, unix.ENOENT) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if stat.Mode&unix.S_IFMT == unix.S_IFDIR {
+		if isDir {
+			return true, nil
+		}
+		if recursive {
+			return false, removeAt(parent, base)
+		}
+		return false, unix.Unlinkat(parent, base, unix.AT_REMOVEDIR)
+	}
+	return false, unix.Unlinkat(parent, base, 0)
+}
+
+func writeFile(parent int, base string, content io.Reader) error {
+	fd, err := unix.Openat(parent, base, unix.O_WRONLY|unix.O_CREAT|unix.O_EXCL|unix.O_NOFOLLOW|unix.O_CLOEXEC, 0600)
+	if err != nil {
+		return err
+	}
+	f := os.NewFile(uintptr(fd), base)
+	_, err = io.Copy(f, content)
+	return errors.Join(err, f.Close())
+}
+
+func applyMetadata(parent int, base string, header *tar.Header) error {
+	// Only works for ids we own, i.e. not for most ids rootless.
+	// Ownership needs to be restored before the mode because
+	// chown clears setuid bits.
+	err := unix.Fchownat(parent, base, header.Uid, header.Gid, unix.AT_SYMLINK_NOFOLLOW)
+	if err != nil && !isNotPermitted(err) {
+		return fmt.Errorf("changing owner: %w", err)
+	}
+
+	if header.Typeflag != tar.TypeSymlink {
+		// Symlinks have no mode of their own on Linux
+		err = chmodNoFollow(parent, base, uint32(header.Mode&0o7777))
+		if err != nil {
+			return fmt.Errorf("changing mode: %w", err)
+		}
+	}
+
+	err = setXattrs(parent, base, header)
+	if err != nil {
+		return err
+	}
+
+	atime := header.AccessTime
+	if atime.IsZero() {
+		atime = header.ModTime
+	}
+	err = unix.UtimesNanoAt(parent, base, []unix.Timespec{
+		unix.NsecToTimespec(atime.UnixNano()),
+		unix.NsecToTimespec(header.ModTime.UnixNano()),
+	}, unix.AT_SYMLINK_NOFOLLOW)
+	if err != nil {
+		return fmt.Errorf("changing times: %w", err)
+	}
+	return nil
+}
+
+// Like fchmodat with AT_SYMLINK_NOFOLLOW, which needs fchmodat2.
+// Fails for symlinks rather than changing the mode of their target,
+// as a box could replace the file while its archive is extracted.
+func chmodNoFollow(parent int, base string, mode uint32) error {
+	fd, err := unix.Openat(parent, base, unix.O_PATH|unix.O_NOFOLLOW|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return err
+	}
+	defer unix.Close(fd)
+	var stat unix.Stat_t
+	err = unix.Fstat(fd, &stat)
+	if err != nil {
+		return err
+	}
+	if stat.Mode&unix.S_IFMT == unix.S_IFLNK {
+		return unix.ELOOP
+	}
+	return unix.Chmod(fmt.Sprintf("/proc/self/fd/%d", fd), mode)
+}
+
+func setXattrs(parent int, base string, header *tar.Header) error {
+	target := fdPath(parent, base)
+	for key, value := range header.PAXRecords {
+		name, ok := strings.CutPrefix(key, xattrPrefix)
+		if !ok {
+			continue
+		}
+		err := unix.Lsetxattr(target, name, []byte(value), 0)
+		if err != nil && !isNotPermitted(err) {
+			return fmt.Errorf("setting xattr %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// Errors for metadata that can’t be restored rootless
+// or isn’t supported by the file system.
+func isNotPermitted(err error) bool {
+	return errors.Is(err, unix.EPERM) || errors.Is(err, unix.EINVAL) || errors.Is(err, unix.ENOTSUP)
+}
@@ -0,0 +1,443 @@
+package archive_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/codingpa-ws/foxbox/internal/archive"
+	"github.com/stretchr/testify/require"
+)
+
+type entry struct {
+	header  tar.Header
+	content string
+}
+
+func file(name, content string) entry {
+	return entry{tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0644}, content}
+}
+
+func dir(name string) entry {
+	return entry{header: tar.Header{Name: name, Typeflag: tar.TypeDir, Mode: 0755}}
+}
+
+func symlink(name, target string) entry {
+	return entry{header: tar.Header{Name: name, Typeflag: tar.TypeSymlink, Linkname: target, Mode: 0777}}
+}
+
+func hardlink(name, target string) entry {
+	return entry{header: tar.Header{Name: name, Typeflag: tar.TypeLink, Linkname: target}}
+}
+
+func build(t *testing.T, entries ...entry) *bytes.Buffer {
+	buf := new(bytes.Buffer)
+	tw := tar.NewWriter(buf)
+	for _, entry := range entries {
+		entry.header.Size = int64(len(entry.content))
+		require.NoError(t, tw.WriteHeader(&entry.header))
+		_, err := tw.Write([]byte(entry.content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+	return buf
+}
+
+// Returns a root directory to extract into and a
+// sibling directory that must never be written to.
+func setup(t *testing.T) (root, outside string) {
+	base := t.TempDir()
+	root = filepath.Join(base, "root")
+	outside = filepath.Join(base, "outside")
+	require.NoError(t, os.Mkdir(root, 0755))
+	require.NoError(t, os.Mkdir(outside, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(outside, "secret"), []byte("secret"), 0644))
+	return
+}
+
+func requireOutsideUntouched(t *testing.T, outside string) {
+	entries, err := os.ReadDir(outside)
+	require.NoError(t, err)
+	require.Len(t, entries, 1, "no files may be created outside the root")
+	content, err := os.ReadFile(filepath.Join(outside, "secret"))
+	require.NoError(t, err)
+	require.Equal(t, "secret", string(content))
+	info, err := os.Stat(filepath.Join(outside, "secret"))
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0644), info.Mode(), "modes outside the root may not change")
+}
+
+func TestExtract(t *testing.T) {
+	require := require.New(t)
+	root, _ := setup(t)
+	mtime := time.Date(2023, 9, 28, 12, 0, 0, 0, time.UTC)
+
+	executable := file("bin/tool", "#!/bin/sh\n")
+	executable.header.Mode = 0755
+	executable.header.ModTime = mtime
+	readOnly := dir("ro")
+	readOnly.header.Mode = 0555
+	readOnly.header.ModTime = mtime
+	xattr := file("xattr", "")
+	xattr.header.PAXRecords = map[string]string{"SCHILY.xattr.user.fox": "box"}
+	fifo := entry{header: tar.Header{Name: "fifo", Typeflag: tar.TypeFifo, Mode: 0600}}
+	device := entry{header: tar.Header{Name: "null", Typeflag: tar.TypeChar, Mode: 0666, Devmajor: 1, Devminor: 3}}
+
+	err := archive.Extract(build(t,
+		dir("./"),
+		dir("bin/"),
+		executable,
+		symlink("bin/link", "tool"),
+		hardlink("bin/hard", "bin/tool"),
+		readOnly,
+		file("ro/file", "read only"),
+		xattr,
+		fifo,
+		device,
+		file("replaced", "old"),
+		file("replaced", "new"),
+	), root)
+	require.NoError(err)
+
+	info, err := os.Stat(filepath.Join(root, "bin/tool"))
+	require.NoError(err)
+	require.Equal(os.FileMode(0755), info.Mode().Perm())
+	require.True(mtime.Equal(info.ModTime()))
+
+	target, err := os.Readlink(filepath.Join(root, "bin/link"))
+	require.NoError(err)
+	require.Equal("tool", target)
+
+	hard, err := os.Stat(filepath.Join(root, "bin/hard"))
+	require.NoError(err)
+	require.True(os.SameFile(info, hard))
+
+	info, err = os.Stat(filepath.Join(root, "ro"))
+	require.NoError(err)
+	require.Equal(os.FileMode(0555), info.Mode().Perm())
+	require.True(mtime.Equal(info.ModTime()), "adding children must not change directory mtimes")
+	content, err := os.ReadFile(filepath.Join(root, "ro/file"))
+	require.NoError(err)
+	require.Equal("read only", string(content))
+	require.NoError(os.Chmod(filepath.Join(root, "ro"), 0755), "cleanup needs write access")
+
+	value := make([]byte, 16)
+	n, err := syscall.Getxattr(filepath.Join(root, "xattr"), "user.fox", value)
+	if err == nil {
+		require.Equal("box", string(value[:n]))
+	} else {
+		require.ErrorIs(err, syscall.ENOTSUP, "file system without user xattrs")
+	}
+
+	info, err = os.Lstat(filepath.Join(root, "fifo"))
+	require.NoError(err)
+	require.Equal(os.ModeNamedPipe, info.Mode().Type())
+
+	_, err = os.Lstat(filepath.Join(root, "null"))
+	require.ErrorIs(err, os.ErrNotExist, "device nodes are skipped")
+
+	content, err = os.ReadFile(filepath.Join(root, "replaced"))
+	require.NoError(err)
+	require.Equal("new", string(content))
+}
+
+func TestExtractMalicious(t *testing.T) {
+	cases := map[string][]entry{
+		"parent paths": {
+			file("../outside/secret", "pwned"),
+			file("../../outside/new", "pwned"),
+		},
+		"absolute paths": {
+			file("/outside/new", "pwned"),
+		},
+		"symlinked directories": {
+			symlink("escape", "../outside"),
+			file("escape/secret", "pwned"),
+			file("escape/new", "pwned"),
+		},
+		"absolute symlinked directories": {
+			symlink("escape", "/"),
+			file("escape/new", "pwned"),
+		},
+		"nested symlinks": {
+			dir("a/"),
+			symlink("a/up", ".."),
+			symlink("a/b", "up/up/up/outside"),
+			file("a/b/new", "pwned"),
+		},
+		"writing through file symlinks": {
+			symlink("secret", "../outside/secret"),
+			file("secret", "pwned"),
+		},
+		"hardlinks outside": {
+			hardlink("secret", "../outside/secret"),
+		},
+		"hardlinks through symlinks": {
+			symlink("escape", "../outside"),
+			hardlink("secret", "escape/secret"),
+		},
+		// Directory metadata is applied after all entries
+		"directories replaced by symlinks": {
+			{header: tar.Header{Name: "d", Typeflag: tar.TypeDir, Mode: 0777}},
+			symlink("d", "../outside/secret"),
+		},
+	}
+
+	for name, entries := range cases {
+		entries := entries
+		t.Run(name, func(t *testing.T) {
+			root, outside := setup(t)
+			// Failing is fine, escaping isn’t
+			_ = archive.Extract(build(t, entries...), root)
+			requireOutsideUntouched(t, outside)
+			_ = archive.ExtractLayer(build(t, entries...), root)
+			requireOutsideUntouched(t, outside)
+		})
+	}
+
+	t.Run("directory metadata is not applied to later entries", func(t *testing.T) {
+		require := require.New(t)
+		root, outside := setup(t)
+		err := archive.Extract(build(t,
+			entry{header: tar.Header{Name: "d", Typeflag: tar.TypeDir, Mode: 0700}},
+			file("d", "file"),
+			entry{header: tar.Header{Name: "link", Typeflag: tar.TypeDir, Mode: 0777}},
+			symlink("link", filepath.Join(outside, "secret")),
+		), root)
+		require.NoError(err)
+		requireOutsideUntouched(t, outside)
+		info, err := os.Stat(filepath.Join(root, "d"))
+		require.NoError(err)
+		require.Equal(os.FileMode(0644), info.Mode())
+		info, err = os.Lstat(filepath.Join(root, "link"))
+		require.NoError(err)
+		require.Equal(os.ModeSymlink, info.Mode().Type())
+	})
+
+	t.Run("symlinks are confined to the root", func(t *testing.T) {
+		require := require.New(t)
+		root, outside := setup(t)
+		err := archive.Extract(build(t,
+			dir("outside/"),
+			symlink("escape", "../../outside"),
+			file("escape/new", "confined"),
+			symlink("absolute", "/outside"),
+			file("absolute/other", "confined"),
+		), root)
+		require.NoError(err)
+		requireOutsideUntouched(t, outside)
+
+		content, err := os.ReadFile(filepath.Join(root, "outside/new"))
+		require.NoError(err)
+		require.Equal("confined", string(content))
+		content, err = os.ReadFile(filepath.Join(root, "outside/other"))
+		require.NoError(err)
+		require.Equal("confined", string(content))
+	})
+}
+
+func TestExtractLayer(t *testing.T) {
+	require := require.New(t)
+	root, outside := setup(t)
+
+	require.NoError(archive.ExtractLayer(build(t,
+		file("etc/hostname", "lower\n"),
+		file("etc/removed", ""),
+		dir("var/cache"),
+		file("var/cache/old", ""),
+		file("var/cache/older", ""),
+	), root))
+	require.NoError(archive.ExtractLayer(build(t,
+		file("etc/.wh.removed", ""),
+		file("etc/.wh.missing", ""),
+		file("var/cache/new", ""),
+		file("var/cache/.wh..wh..opq", ""),
+		file("gone/.wh.x", ""),
+	), root))
+
+	content, err := os.ReadFile(filepath.Join(root, "etc/hostname"))
+	require.NoError(err)
+	require.Equal("lower\n", string(content))
+	require.NoFileExists(filepath.Join(root, "etc/removed"))
+	require.NoFileExists(filepath.Join(root, "etc/.wh.removed"))
+
+	entries, err := os.ReadDir(filepath.Join(root, "var/cache"))
+	require.NoError(err)
+	require.Len(entries, 1)
+	require.Equal("new", entries[0].Name())
+	require.NoDirExists(filepath.Join(root, "gone"))
+	require.DirExists(root)
+	requireOutsideUntouched(t, outside)
+
+	// Files replace directories of lower layers with their contents
+	require.NoError(archive.ExtractLayer(build(t, file("var/cache", "file")), root))
+	content, err = os.ReadFile(filepath.Join(root, "var/cache"))
+	require.NoError(err)
+	require.Equal("file", string(content))
+}
+
+func TestExtractLayerMalicious(t *testing.T) {
+	require := require.New(t)
+	root, outside := setup(t)
+	require.NoError(archive.ExtractLayer(build(t, symlink("escape", "../outside")), root))
+	require.NoError(archive.ExtractLayer(build(t,
+		file("escape/.wh.secret", ""),
+		file("escape/.wh..wh..opq", ""),
+	), root))
+	require.Error(archive.ExtractLayer(build(t, file(".wh...", "")), root))
+	requireOutsideUntouched(t, outside)
+}
+
+func TestCreate(t *testing.T) {
+	require := require.New(t)
+	src, _ := setup(t)
+	mtime := time.Date(2023, 9, 28, 12, 0, 0, 0, time.UTC)
+
+	executable := file("bin/tool", "#!/bin/sh\n")
+	executable.header.Mode = 0755
+	executable.header.ModTime = mtime
+	require.NoError(archive.Extract(build(t,
+		dir("bin"),
+		executable,
+		hardlink("bin/tool2", "bin/tool"),
+		symlink("bin/link", "tool"),
+		file("etc/hostname", "fox\n"),
+	), src))
+
+	buf := new(bytes.Buffer)
+	require.NoError(archive.Create(buf, src))
+
+	var names []string
+	tr := tar.NewReader(bytes.NewReader(buf.Bytes()))
+	for {
+		header, err := tr.Next()
+		if err != nil {
+			break
+		}
+		names = append(names, header.Name)
+		require.Zero(header.Uid, header.Name)
+		if header.Name == "bin/tool2" || header.Name == "bin/tool" {
+			require.Contains([]byte{tar.TypeReg, tar.TypeLink}, header.Typeflag)
+		}
+	}
+	require.ElementsMatch([]string{"bin/", "bin/tool", "bin/tool2", "bin/link", "etc/", "etc/hostname"}, names)
+
+	dst, _ := setup(t)
+	require.NoError(archive.Extract(buf, dst))
+	info, err := os.Stat(filepath.Join(dst, "bin/tool"))
+	require.NoError(err)
+	require.Equal(os.FileMode(0755), info.Mode().Perm())
+	require.True(mtime.Equal(info.ModTime()))
+	info2, err := os.Stat(filepath.Join(dst, "bin/tool2"))
+	require.NoError(err)
+	require.True(os.SameFile(info, info2))
+	target, err := os.Readlink(filepath.Join(dst, "bin/link"))
+	require.NoError(err)
+	require.Equal("tool", target)
+	content, err := os.ReadFile(filepath.Join(dst, "etc/hostname"))
+	require.NoError(err)
+	require.Equal("fox\n", string(content))
+}
+
+// Returns the names and contents of the entries of a tar archive.
+func entries(t *testing.T, r io.Reader) map[string]string {
+	files := map[string]string{}
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return files
+		}
+		require.NoError(t, err)
+		content, err := io.ReadAll(tr)
+		require.NoError(t, err)
+		files[header.Name] = string(content)
+	}
+}
+
+func TestCreateAt(t *testing.T) {
+	require := require.New(t)
+	root, outside := setup(t)
+	require.NoError(archive.Extract(build(t,
+		file("bin/tool", "tool"),
+		symlink("bin/link", "tool"),
+		symlink("etc/bin", "/bin"),
+		symlink("escape", "../outside"),
+	), root))
+
+	buf := new(bytes.Buffer)
+	require.NoError(archive.CreateAt(buf, root, "etc/bin", "programs"))
+	require.Equal(map[string]string{"programs/": "", "programs/tool": "tool", "programs/link": ""}, entries(t, buf))
+
+	// Symlinks are resolved within root
+	buf.Reset()
+	require.NoError(archive.CreateAt(buf, root, "/etc/bin/link", "tool"))
+	require.Equal(map[string]string{"tool": "tool"}, entries(t, buf))
+	require.Error(archive.CreateAt(buf, root, "escape/secret", "secret"))
+	require.Error(archive.CreateAt(buf, root, "../outside/secret", "secret"))
+	require.Error(archive.CreateAt(buf, root, "bin", ""))
+	requireOutsideUntouched(t, outside)
+}
+
+func TestCreateLayer(t *testing.T) {
+	require := require.New(t)
+	root, outside := setup(t)
+	require.NoError(archive.Extract(build(t,
+		file("etc/motd", "welcome"),
+		symlink("escape", "/"),
+		file("secret", "box"),
+	), root))
+
+	buf := new(bytes.Buffer)
+	require.NoError(archive.CreateLayer(buf, root, []string{"etc", "etc/motd", "escape"}, []string{"etc/hostname"}))
+	require.Equal(map[string]string{"etc/": "", "etc/motd": "welcome", "escape": "", "etc/.wh.hostname": ""}, entries(t, buf))
+
+	// Symlinks are resolved within root, like in a box
+	buf.Reset()
+	require.NoError(archive.CreateLayer(buf, root, []string{"escape/secret"}, nil))
+	require.Equal(map[string]string{"escape/secret": "box"}, entries(t, buf))
+	require.Error(archive.CreateLayer(buf, root, []string{"escape/etc/../../outside/secret"}, nil))
+	requireOutsideUntouched(t, outside)
+}
+
+func TestExtractAt(t *testing.T) {
+	require := require.New(t)
+	root, outside := setup(t)
+	require.NoError(archive.Extract(build(t,
+		dir("bin"),
+		file("etc/hostname", "fox\n"),
+		symlink("usr/bin", "/bin"),
+		symlink("escape", "../outside"),
+	), root))
+	tool := func(name string) *bytes.Buffer {
+		return build(t, dir(name), file(name+"/tool", "tool"), hardlink(name+"/tool2", name+"/tool"))
+	}
+
+	// Into existing directories, resolving symlinks within root
+	require.NoError(archive.ExtractAt(tool("tools"), root, "usr/bin"))
+	content, err := os.ReadFile(filepath.Join(root, "bin/tools/tool2"))
+	require.NoError(err)
+	require.Equal("tool", string(content))
+	// The symlink leads to root/outside, which doesn’t exist
+	require.NoError(archive.ExtractAt(tool("tools"), root, "escape"))
+	require.FileExists(filepath.Join(root, "escape/tool"))
+
+	// As new files or replacing existing ones
+	require.NoError(archive.ExtractAt(tool("tools"), root, "/opt"))
+	require.FileExists(filepath.Join(root, "opt/tool"))
+	require.NoError(archive.ExtractAt(build(t, file("name", "box\n")), root, "etc/hostname"))
+	content, err = os.ReadFile(filepath.Join(root, "etc/hostname"))
+	require.NoError(err)
+	require.Equal("box\n", string(content))
+
+	require.Error(archive.ExtractAt(tool("tools"), root, "missing/opt"))
+	require.Error(archive.ExtractAt(build(t, file("a", ""), file("b", "")), root, "etc"))
+	require.Error(archive.ExtractAt(build(t, file("a", ""), hardlink("a2", "../outside/secret")), root, "etc"))
+	requireOutsideUntouched(t, outside)
+}
@@ -47,6 +47,11 @@ func (self CGroup) LimitCPUs(cores float32) error {
 	return self.write("cpu.max", fmt.Sprintf("%d %.0f", max, baseMicroseconds))
 }
 
+// Kills all processes in the cgroup (requires Linux 5.14).
+func (self CGroup) Kill() error {
+	return self.write("cgroup.kill", "1")
+}
+
 func (self CGroup) AddPID(pid int) error {
 	f, err := os.OpenFile(filepath.Join(self.path, "cgroup.procs"), os.O_WRONLY, 0)
 	if err != nil {
@@ -90,6 +95,21 @@ func Open(name string) (*CGroup, error) {
 	return cgroup, nil
 }
 
+// Returns the cgroup v2 the process with the given pid belongs to.
+func OfProcess(pid int) (*CGroup, error) {
+	b, err := os.ReadFile(fmt.Sprintf("/proc/%d/cgroup", pid))
+	if err != nil {
+		return nil, err
+	}
+	for _, line := range strings.Split(string(b), "\n") {
+		path, ok := strings.CutPrefix(line, "0::")
+		if ok {
+			return FromPath(filepath.Join("/sys/fs/cgroup", path)), nil
+		}
+	}
+	return nil, ErrUnavailable
+}
+
 func FromPath(path string) *CGroup {
 	return &CGroup{
 		path,
@@ -0,0 +1,76 @@
+package cli
+
+import (
+	"fmt"
+
+	"github.com/codingpa-ws/foxbox/client"
+	"github.com/urfave/cli/v2"
+)
+
+func init() {
+	app.Commands = append(app.Commands, &cli.Command{
+		Name:      "build",
+		Usage:     "Build an image from a Foxfile",
+		Action:    build,
+		ArgsUsage: "[context]",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:     "tag",
+				Aliases:  []string{"t"},
+				Usage:    "name to store the image as",
+				Required: true,
+			},
+			&cli.StringFlag{
+				Name:    "file",
+				Aliases: []string{"f"},
+				Usage:   "path of the Foxfile (default: <context>/Foxfile)",
+			},
+			&cli.BoolFlag{
+				Name:  "no-cache",
+				Usage: "run all steps instead of using cached results",
+			},
+			&cli.StringFlag{
+				Name:    "toolchains",
+				Usage:   "url of the toolchains.json used by install (http, https or file)",
+				EnvVars: []string{"FOXBOX_TOOLCHAINS"},
+			},
+			&cli.StringFlag{
+				Name:  "on-conflict",
+				Usage: "how merge resolves conflicts unless the instruction sets it: fail, left (earlier image wins) or right",
+				Value: string(client.ConflictFail),
+			},
+			&cli.StringFlag{
+				Name:  "pull",
+				Usage: "when to pull the image of from (missing, always or never)",
+				Value: string(client.PullMissing),
+			},
+		},
+	})
+}
+
+func build(ctx *cli.Context) error {
+	if ctx.Args().Len() > 1 {
+		return fmt.Errorf("usage: `foxbox build -t <name> [-f Foxfile] [context]`")
+	}
+	pull := client.PullPolicy(ctx.String("pull"))
+	switch pull {
+	case client.PullMissing, client.PullAlways, client.PullNever:
+	default:
+		return fmt.Errorf("invalid --pull %q: use missing, always or never", pull)
+	}
+
+	image, err := foxbox.Build(&client.BuildOptions{
+		Context:    ctx.Args().First(),
+		Foxfile:    ctx.String("file"),
+		Tag:        ctx.String("tag"),
+		Pull:       pull,
+		NoCache:    ctx.Bool("no-cache"),
+		Toolchains: ctx.String("toolchains"),
+		OnConflict: client.ConflictPolicy(ctx.String("on-conflict")),
+	})
+	if err != nil {
+		return fmt.Errorf("building %s: %w", ctx.String("tag"), err)
+	}
+	fmt.Println(image.Name)
+	return nil
+}
@@ -2,6 +2,9 @@ package cli
 
 import (
 	"fmt"
+	"os"
+	"os/exec"
+	"syscall"
 
 	"github.com/codingpa-ws/foxbox/client"
 	"github.com/codingpa-ws/foxbox/internal/store"
@@ -25,3 +28,12 @@ func Start(args []string) (err error) {
 
 	return app.Run(args)
 }
+
+// Exits with the status of a box process, using the shell
+// convention of 128+n for processes terminated by signal n.
+func exitWith(exitError *exec.ExitError) {
+	if status, ok := exitError.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+		os.Exit(128 + int(status.Signal()))
+	}
+	os.Exit(exitError.ExitCode())
+}
@@ -0,0 +1,70 @@
+package cli
+
+import (
+	"fmt"
+
+	"github.com/codingpa-ws/foxbox/client"
+	"github.com/codingpa-ws/foxbox/internal/foxfile"
+	"github.com/urfave/cli/v2"
+)
+
+func init() {
+	app.Commands = append(app.Commands, &cli.Command{
+		Name:      "commit",
+		Usage:     "Store the file system of a foxbox as image",
+		Action:    commit,
+		ArgsUsage: "[name] [image]",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:  "cmd",
+				Usage: `default command of the image, run by /bin/sh or written as JSON array like ["./main", "-v"]`,
+			},
+			&cli.StringFlag{
+				Name:  "entrypoint",
+				Usage: "entrypoint of the image, written like --cmd",
+			},
+			&cli.StringSliceFlag{
+				Name:    "env",
+				Aliases: []string{"e"},
+				Usage:   "sets environment variables of the image (KEY=value, or KEY to use the value of the current environment)",
+			},
+			&cli.StringFlag{
+				Name:    "workdir",
+				Aliases: []string{"w"},
+				Usage:   "working directory of the image",
+			},
+		},
+	})
+}
+
+func commit(ctx *cli.Context) (err error) {
+	if ctx.Args().Len() != 2 {
+		return fmt.Errorf("usage: `foxbox commit <name> <image>`")
+	}
+	name, image := ctx.Args().Get(0), ctx.Args().Get(1)
+
+	opt := &client.CommitOptions{WorkDir: ctx.String("workdir")}
+	if ctx.IsSet("cmd") {
+		opt.Cmd, err = foxfile.Instruction{Args: ctx.String("cmd")}.Command()
+		if err != nil {
+			return fmt.Errorf("invalid --cmd: %w", err)
+		}
+	}
+	if ctx.IsSet("entrypoint") {
+		opt.Entrypoint, err = foxfile.Instruction{Args: ctx.String("entrypoint")}.Command()
+		if err != nil {
+			return fmt.Errorf("invalid --entrypoint: %w", err)
+		}
+	}
+	opt.Env, err = parseEnv(nil, ctx.StringSlice("env"))
+	if err != nil {
+		return
+	}
+
+	err = foxbox.Commit(name, image, opt)
+	if err != nil {
+		return fmt.Errorf("committing %s: %w", name, err)
+	}
+	fmt.Println(image)
+	return
+}
@@ -0,0 +1,50 @@
+package cli
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+)
+
+func init() {
+	app.Commands = append(app.Commands, &cli.Command{
+		Name:      "cp",
+		Usage:     "Copy files between the host and a foxbox",
+		Action:    cp,
+		ArgsUsage: "[host path|name:path] [host path|name:path]",
+		Description: "Copies a file or directory into the destination if that is a directory and replaces it otherwise.\n" +
+			"Prefix host paths containing colons with ./ or /.",
+	})
+}
+
+func cp(ctx *cli.Context) error {
+	if ctx.Args().Len() != 2 {
+		return fmt.Errorf("usage: `foxbox cp <host path> <name>:<path>` or `foxbox cp <name>:<path> <host path>`")
+	}
+	src, dst := ctx.Args().Get(0), ctx.Args().Get(1)
+	srcBox, srcPath, srcInBox := parseBoxPath(src)
+	dstBox, dstPath, dstInBox := parseBoxPath(dst)
+
+	switch {
+	case srcInBox && dstInBox:
+		return fmt.Errorf("copying between boxes is not supported")
+	case srcInBox:
+		return foxbox.CopyFrom(srcBox, srcPath, dst)
+	case dstInBox:
+		return foxbox.CopyTo(dstBox, src, dstPath)
+	}
+	return fmt.Errorf("neither %s nor %s is in a box: use <name>:<path>", src, dst)
+}
+
+// Splits name:path arguments. Paths starting with / or . are on the host.
+func parseBoxPath(arg string) (name, path string, ok bool) {
+	if strings.HasPrefix(arg, "/") || strings.HasPrefix(arg, ".") {
+		return "", arg, false
+	}
+	name, path, ok = strings.Cut(arg, ":")
+	if name == "" || strings.Contains(name, "/") {
+		return "", arg, false
+	}
+	return
+}
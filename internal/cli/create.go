@@ -0,0 +1,87 @@
+package cli
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/codingpa-ws/foxbox/client"
+	"github.com/urfave/cli/v2"
+)
+
+func init() {
+	app.Commands = append(app.Commands, &cli.Command{
+		Name:      "create",
+		Usage:     "Create a foxbox without running it and print its name",
+		Action:    create,
+		ArgsUsage: "[image]",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:  "name",
+				Usage: "name of the foxbox (letters, digits and hyphens), random by default",
+			},
+			&cli.StringFlag{
+				Name:  "pull",
+				Usage: "when to pull the image from the registry (missing, always or never)",
+				Value: string(client.PullMissing),
+			},
+			&cli.StringSliceFlag{
+				Name:    "label",
+				Aliases: []string{"l"},
+				Usage:   "sets labels of the foxbox (key=value, or key for an empty value)",
+			},
+		},
+	})
+}
+
+func create(ctx *cli.Context) (err error) {
+	if ctx.Args().Len() != 1 {
+		return fmt.Errorf("usage: `foxbox create <image>`")
+	}
+	opt, err := createOptions(ctx)
+	if err != nil {
+		return
+	}
+
+	name, err := foxbox.Create(opt)
+	if err != nil {
+		return
+	}
+	fmt.Println(name)
+	return
+}
+
+// Reads the flags shared by create and run.
+func createOptions(ctx *cli.Context) (*client.CreateOptions, error) {
+	pull := client.PullPolicy(ctx.String("pull"))
+	switch pull {
+	case client.PullMissing, client.PullAlways, client.PullNever:
+	default:
+		return nil, fmt.Errorf("invalid --pull %q: use missing, always or never", pull)
+	}
+	labels, err := parseLabels(ctx.StringSlice("label"))
+	if err != nil {
+		return nil, err
+	}
+
+	return &client.CreateOptions{
+		Image:  ctx.Args().First(),
+		Name:   ctx.String("name"),
+		Pull:   pull,
+		Labels: labels,
+	}, nil
+}
+
+func parseLabels(labels []string) (map[string]string, error) {
+	if len(labels) == 0 {
+		return nil, nil
+	}
+	parsed := map[string]string{}
+	for _, label := range labels {
+		key, value, _ := strings.Cut(label, "=")
+		if key == "" {
+			return nil, fmt.Errorf("invalid label %q: must be formatted key=value", label)
+		}
+		parsed[key] = value
+	}
+	return parsed, nil
+}
@@ -0,0 +1,76 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/urfave/cli/v2"
+)
+
+func init() {
+	app.Commands = append(app.Commands, &cli.Command{
+		Name:      "diff",
+		Usage:     "Show the files a foxbox added (A), changed (C) or deleted (D) compared to its image",
+		Action:    diff,
+		ArgsUsage: "[name]",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:  "format",
+				Usage: "output format (text or json)",
+				Value: "text",
+			},
+			&cli.StringFlag{
+				Name:  "layer",
+				Usage: "writes the changes to `FILE` as tar image layer instead (- for stdout)",
+			},
+		},
+	})
+}
+
+func diff(ctx *cli.Context) (err error) {
+	if ctx.Args().Len() != 1 {
+		return fmt.Errorf("box not specified: use `foxbox diff <name>`")
+	}
+	name := ctx.Args().First()
+
+	if ctx.IsSet("layer") {
+		return diffLayer(name, ctx.String("layer"))
+	}
+
+	changes, err := foxbox.Diff(name)
+	if err != nil {
+		return
+	}
+	switch ctx.String("format") {
+	case "json":
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(changes)
+	case "text":
+		for _, change := range changes {
+			fmt.Printf("%s /%s\n", change.Kind, change.Path)
+		}
+		return
+	default:
+		return fmt.Errorf("unknown format %q: use text or json", ctx.String("format"))
+	}
+}
+
+func diffLayer(name, path string) (err error) {
+	if path == "-" {
+		return foxbox.DiffLayer(name, os.Stdout)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return
+	}
+	err = foxbox.DiffLayer(name, f)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path)
+	}
+	return
+}
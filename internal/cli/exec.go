@@ -0,0 +1,37 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+
+	"github.com/codingpa-ws/foxbox/client"
+	"github.com/urfave/cli/v2"
+)
+
+func init() {
+	app.Commands = append(app.Commands, &cli.Command{
+		Name:      "exec",
+		Usage:     "Run a command in a running foxbox",
+		Action:    execInBox,
+		ArgsUsage: "[name] [(command) (args...)]",
+	})
+}
+
+func execInBox(ctx *cli.Context) (err error) {
+	args := ctx.Args()
+	if args.Len() == 0 {
+		return fmt.Errorf("box not specified: use `foxbox exec <name> [command...]`")
+	}
+
+	err = foxbox.Exec(args.First(), &client.ExecOptions{
+		Command: args.Slice()[1:],
+	})
+
+	var exitError *exec.ExitError
+	if errors.As(err, &exitError) {
+		exitWith(exitError)
+	}
+
+	return
+}
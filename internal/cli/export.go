@@ -0,0 +1,51 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/urfave/cli/v2"
+)
+
+func init() {
+	app.Commands = append(app.Commands, &cli.Command{
+		Name:      "export",
+		Usage:     "Write a foxbox with its file system and config as tar archive to stdout",
+		Action:    export,
+		ArgsUsage: "[name]",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:    "output",
+				Aliases: []string{"o"},
+				Usage:   "writes the archive to `FILE` instead",
+			},
+		},
+	})
+}
+
+func export(ctx *cli.Context) (err error) {
+	if ctx.Args().Len() != 1 {
+		return fmt.Errorf("box not specified: use `foxbox export <name> > box.tar`")
+	}
+	name := ctx.Args().First()
+
+	path := ctx.String("output")
+	if path == "" {
+		if info, err := os.Stdout.Stat(); err == nil && info.Mode()&os.ModeCharDevice != 0 {
+			return fmt.Errorf("refusing to write the archive to a terminal: redirect stdout or use -o")
+		}
+		return foxbox.ExportBox(name, os.Stdout)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return
+	}
+	err = foxbox.ExportBox(name, f)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path)
+	}
+	return
+}
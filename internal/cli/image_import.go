@@ -0,0 +1,74 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+
+	"github.com/codingpa-ws/foxbox/client"
+	"github.com/codingpa-ws/foxbox/internal/registry"
+	"github.com/urfave/cli/v2"
+)
+
+func init() {
+	imageCommand.Subcommands = append(imageCommand.Subcommands, &cli.Command{
+		Name:      "import",
+		Usage:     "Import a rootfs tarball (plain, gzip, zstd or xz) or an OCI image as image",
+		Action:    imageImport,
+		ArgsUsage: "[name] [file|url|-]",
+		Flags: []cli.Flag{
+			&cli.BoolFlag{
+				Name:  "oci",
+				Usage: "import an OCI image layout directory or tarball, e.g. from `docker save`",
+			},
+			&cli.StringFlag{
+				Name:  "ref",
+				Usage: "tag of the OCI image to import if there are multiple",
+			},
+		},
+	})
+}
+
+func imageImport(ctx *cli.Context) (err error) {
+	args := ctx.Args()
+	if args.Len() == 0 || args.Len() > 2 {
+		return fmt.Errorf("usage: `foxbox image import <name> [file|url|-]`")
+	}
+	name, source := args.Get(0), args.Get(1)
+
+	if ctx.Bool("oci") {
+		if source == "" || source == "-" {
+			return fmt.Errorf("usage: `foxbox image import --oci <name> <dir|file>`")
+		}
+		err = foxbox.ImportOCIImage(name, source, &client.ImportOCIOptions{
+			Ref: ctx.String("ref"),
+		})
+		if err != nil {
+			return fmt.Errorf("importing %s: %w", name, err)
+		}
+		fmt.Println(name)
+		return
+	}
+
+	var image io.ReadCloser
+	switch u, _ := url.Parse(source); {
+	case source == "" || source == "-":
+		image = os.Stdin
+	case u != nil && (u.Scheme == "http" || u.Scheme == "https" || u.Scheme == "file"):
+		image, err = registry.Open(source)
+	default:
+		image, err = os.Open(source)
+	}
+	if err != nil {
+		return
+	}
+	defer image.Close()
+
+	err = foxbox.ImportImage(name, image)
+	if err != nil {
+		return fmt.Errorf("importing %s: %w", name, err)
+	}
+	fmt.Println(name)
+	return
+}
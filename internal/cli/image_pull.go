@@ -0,0 +1,42 @@
+package cli
+
+import (
+	"fmt"
+
+	"github.com/codingpa-ws/foxbox/client"
+	"github.com/urfave/cli/v2"
+)
+
+func init() {
+	imageCommand.Subcommands = append(imageCommand.Subcommands, &cli.Command{
+		Name:      "pull",
+		Usage:     "Download images from the registry or an OCI registry like docker.io",
+		Action:    imagePull,
+		ArgsUsage: "[name[:tag]|registry/repository[:tag|@digest]...]",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:    "registry",
+				Usage:   "url of the registry.json (http, https or file)",
+				EnvVars: []string{"FOXBOX_REGISTRY"},
+			},
+		},
+	})
+}
+
+func imagePull(ctx *cli.Context) (err error) {
+	if ctx.Args().Len() == 0 {
+		return fmt.Errorf("image not specified: use `foxbox image pull <name[:tag]>`")
+	}
+
+	for _, ref := range ctx.Args().Slice() {
+		image, err := foxbox.PullImage(ref, &client.PullOptions{
+			Registry: ctx.String("registry"),
+		})
+		if err != nil {
+			return err
+		}
+		fmt.Println(image.Name)
+	}
+
+	return nil
+}
@@ -0,0 +1,34 @@
+package cli
+
+import (
+	"fmt"
+
+	"github.com/urfave/cli/v2"
+)
+
+func init() {
+	imageCommand.Subcommands = append(imageCommand.Subcommands, &cli.Command{
+		Name:      "rm",
+		Usage:     "Remove images",
+		Action:    imageRm,
+		ArgsUsage: "[name...]",
+		Flags: []cli.Flag{
+			&cli.BoolFlag{
+				Name:    "force",
+				Aliases: []string{"f"},
+				Usage:   "removes images even if foxboxes were created from them",
+			},
+		},
+	})
+}
+
+func imageRm(ctx *cli.Context) (err error) {
+	for _, name := range ctx.Args().Slice() {
+		err := foxbox.RemoveImage(name, ctx.Bool("force"))
+		if err != nil {
+			return fmt.Errorf("removing %s: %w", name, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,37 @@
+package cli
+
+import (
+	"fmt"
+
+	"github.com/codingpa-ws/foxbox/client"
+	"github.com/urfave/cli/v2"
+)
+
+func init() {
+	app.Commands = append(app.Commands, &cli.Command{
+		Name:      "import",
+		Usage:     "Create a foxbox from an archive written by foxbox export",
+		Action:    importBox,
+		ArgsUsage: "[file]",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:  "name",
+				Usage: "name of the box, defaults to the exported name unless that is taken",
+			},
+		},
+	})
+}
+
+func importBox(ctx *cli.Context) error {
+	if ctx.Args().Len() != 1 {
+		return fmt.Errorf("archive not specified: use `foxbox import <file>`")
+	}
+	name, err := foxbox.ImportBox(ctx.Args().First(), &client.ImportBoxOptions{
+		Name: ctx.String("name"),
+	})
+	if err != nil {
+		return fmt.Errorf("importing %s: %w", ctx.Args().First(), err)
+	}
+	fmt.Println(name)
+	return nil
+}
@@ -0,0 +1,38 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/codingpa-ws/foxbox/client"
+	"github.com/urfave/cli/v2"
+)
+
+func init() {
+	app.Commands = append(app.Commands, &cli.Command{
+		Name:      "inspect",
+		Usage:     "Show the configuration and state of foxboxes as JSON",
+		Action:    inspect,
+		ArgsUsage: "[name...]",
+	})
+}
+
+func inspect(ctx *cli.Context) (err error) {
+	if ctx.Args().Len() == 0 {
+		return fmt.Errorf("box not specified: use `foxbox inspect <name...>`")
+	}
+
+	infos := make([]*client.BoxInfo, 0, ctx.Args().Len())
+	for _, name := range ctx.Args().Slice() {
+		info, err := foxbox.Inspect(name)
+		if err != nil {
+			return fmt.Errorf("inspecting %s: %w", name, err)
+		}
+		infos = append(infos, info)
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(infos)
+}
@@ -0,0 +1,60 @@
+package cli
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/urfave/cli/v2"
+	"golang.org/x/sys/unix"
+)
+
+func init() {
+	app.Commands = append(app.Commands, &cli.Command{
+		Name:      "kill",
+		Usage:     "Send a signal to running foxboxes",
+		Action:    kill,
+		ArgsUsage: "[name...]",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:    "signal",
+				Aliases: []string{"s"},
+				Usage:   `signal to send, e.g. "KILL", "SIGTERM" or "15"`,
+				Value:   "SIGKILL",
+			},
+		},
+	})
+}
+
+func kill(ctx *cli.Context) (err error) {
+	signal, err := parseSignal(ctx.String("signal"))
+	if err != nil {
+		return
+	}
+
+	for _, name := range ctx.Args().Slice() {
+		err := foxbox.Kill(name, signal)
+		if err != nil {
+			return fmt.Errorf("killing %s: %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+func parseSignal(value string) (syscall.Signal, error) {
+	if number, err := strconv.Atoi(value); err == nil {
+		return syscall.Signal(number), nil
+	}
+
+	name := strings.ToUpper(value)
+	if !strings.HasPrefix(name, "SIG") {
+		name = "SIG" + name
+	}
+	signal := unix.SignalNum(name)
+	if signal == 0 {
+		return 0, fmt.Errorf("unknown signal %s", value)
+	}
+	return signal, nil
+}
@@ -0,0 +1,90 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/codingpa-ws/foxbox/client"
+	"github.com/urfave/cli/v2"
+)
+
+func init() {
+	app.Commands = append(app.Commands, &cli.Command{
+		Name:      "logs",
+		Usage:     "Show the output of a foxbox",
+		Action:    logs,
+		ArgsUsage: "[name]",
+		Flags: []cli.Flag{
+			&cli.BoolFlag{
+				Name:    "follow",
+				Aliases: []string{"f"},
+				Usage:   "keeps printing new output until the foxbox exits",
+			},
+			&cli.StringFlag{
+				Name:  "since",
+				Usage: `only shows output since a timestamp (e.g. "2024-01-02T15:04:05Z") or relative duration (e.g. "10m")`,
+			},
+			&cli.IntFlag{
+				Name:  "tail",
+				Usage: "only shows the last n lines",
+			},
+			&cli.BoolFlag{
+				Name:  "stdout",
+				Usage: "only shows stdout (combine with --stderr for both)",
+			},
+			&cli.BoolFlag{
+				Name:  "stderr",
+				Usage: "only shows stderr (combine with --stdout for both)",
+			},
+			&cli.BoolFlag{
+				Name:    "timestamps",
+				Aliases: []string{"t"},
+				Usage:   "prefixes lines with their timestamp",
+			},
+		},
+	})
+}
+
+func logs(ctx *cli.Context) (err error) {
+	if ctx.Args().Len() != 1 {
+		return fmt.Errorf("box not specified: use `foxbox logs <name>`")
+	}
+
+	var since time.Time
+	if value := ctx.String("since"); value != "" {
+		since, err = parseSince(value)
+		if err != nil {
+			return
+		}
+	}
+
+	reader, err := foxbox.Logs(ctx.Args().First(), &client.LogsOptions{
+		Follow:     ctx.Bool("follow"),
+		Since:      since,
+		Tail:       ctx.Int("tail"),
+		Stdout:     ctx.Bool("stdout"),
+		Stderr:     ctx.Bool("stderr"),
+		Timestamps: ctx.Bool("timestamps"),
+	})
+	if err != nil {
+		return
+	}
+	defer reader.Close()
+
+	_, err = io.Copy(os.Stdout, reader)
+	return
+}
+
+func parseSince(value string) (time.Time, error) {
+	duration, err := time.ParseDuration(value)
+	if err == nil {
+		return time.Now().Add(-duration), nil
+	}
+	since, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return since, fmt.Errorf("invalid --since %q: use a duration or RFC 3339 timestamp", value)
+	}
+	return since, nil
+}
@@ -2,7 +2,9 @@ package cli
 
 import (
 	"fmt"
+	"strings"
 
+	"github.com/codingpa-ws/foxbox/client"
 	"github.com/urfave/cli/v2"
 )
 
@@ -11,11 +13,22 @@ func init() {
 		Name:   "ls",
 		Usage:  "List all foxboxes",
 		Action: ls,
+		Flags: []cli.Flag{
+			&cli.StringSliceFlag{
+				Name:    "filter",
+				Aliases: []string{"f"},
+				Usage:   "filters foxboxes by label=key[=value]",
+			},
+		},
 	})
 }
 
 func ls(ctx *cli.Context) (err error) {
-	ids, err := foxbox.List(nil)
+	selectors, err := labelFilters(ctx)
+	if err != nil {
+		return
+	}
+	ids, err := foxbox.List(&client.ListOptions{Labels: selectors})
 	if err != nil {
 		return
 	}
@@ -26,3 +39,22 @@ func ls(ctx *cli.Context) (err error) {
 
 	return
 }
+
+// Parses --filter flags of commands that only filter by label.
+func labelFilters(ctx *cli.Context) (selectors []client.LabelSelector, err error) {
+	for _, filter := range ctx.StringSlice("filter") {
+		key, value, ok := strings.Cut(filter, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid filter %q: must be formatted key=value", filter)
+		}
+		if key != "label" {
+			return nil, fmt.Errorf("unknown filter %q", key)
+		}
+		selector, err := client.ParseLabelSelector(value)
+		if err != nil {
+			return nil, err
+		}
+		selectors = append(selectors, selector)
+	}
+	return
+}
@@ -0,0 +1,159 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/codingpa-ws/foxbox/client"
+	"github.com/urfave/cli/v2"
+)
+
+func init() {
+	app.Commands = append(app.Commands, &cli.Command{
+		Name:   "ps",
+		Usage:  "List running foxes",
+		Action: ps,
+		Flags: []cli.Flag{
+			&cli.BoolFlag{
+				Name:    "all",
+				Aliases: []string{"a"},
+				Usage:   "shows all foxboxes instead of only running ones",
+			},
+			&cli.StringSliceFlag{
+				Name:    "filter",
+				Aliases: []string{"f"},
+				Usage:   "filters foxboxes by state=running|stopped|exited or label=key[=value]",
+			},
+			&cli.StringFlag{
+				Name:  "format",
+				Usage: "output format (table or json)",
+				Value: "table",
+			},
+		},
+	})
+}
+
+type psRow struct {
+	Name       string            `json:"name"`
+	PID        int               `json:"pid,omitempty"`
+	State      client.State      `json:"state"`
+	ExitCode   *int              `json:"exitCode,omitempty"`
+	Signal     string            `json:"signal,omitempty"`
+	Image      string            `json:"image"`
+	Labels     map[string]string `json:"labels,omitempty"`
+	StartedAt  *time.Time        `json:"startedAt,omitempty"`
+	FinishedAt *time.Time        `json:"finishedAt,omitempty"`
+	// Uptime of running boxes in seconds
+	Uptime float64 `json:"uptime,omitempty"`
+}
+
+func ps(ctx *cli.Context) (err error) {
+	opt, err := psOptions(ctx)
+	if err != nil {
+		return
+	}
+
+	infos, err := foxbox.Ps(opt)
+	if err != nil {
+		return
+	}
+
+	rows := make([]psRow, 0, len(infos))
+	for _, info := range infos {
+		info := info
+		row := psRow{
+			Name:   info.ID,
+			State:  info.State,
+			Image:  info.Image,
+			Labels: info.Labels,
+		}
+		if !info.StartedAt.IsZero() {
+			row.StartedAt = &info.StartedAt
+		}
+		switch info.State {
+		case client.StateRunning:
+			row.PID = info.PID
+			row.Uptime = time.Since(info.StartedAt).Seconds()
+		case client.StateExited:
+			row.ExitCode = &info.ExitCode
+			row.Signal = info.Signal
+			row.FinishedAt = &info.FinishedAt
+		}
+		rows = append(rows, row)
+	}
+
+	switch ctx.String("format") {
+	case "json":
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(rows)
+	case "table":
+		return printPsTable(rows)
+	default:
+		return fmt.Errorf("unknown format %q: use table or json", ctx.String("format"))
+	}
+}
+
+func psOptions(ctx *cli.Context) (*client.PsOptions, error) {
+	opt := new(client.PsOptions)
+
+	for _, filter := range ctx.StringSlice("filter") {
+		key, value, ok := strings.Cut(filter, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid filter %q: must be formatted key=value", filter)
+		}
+		switch key {
+		case "state":
+			state := client.State(value)
+			switch state {
+			case client.StateRunning, client.StateStopped, client.StateExited:
+			default:
+				return nil, fmt.Errorf("invalid state %q: use running, stopped or exited", value)
+			}
+			opt.States = append(opt.States, state)
+		case "label":
+			selector, err := client.ParseLabelSelector(value)
+			if err != nil {
+				return nil, err
+			}
+			opt.Labels = append(opt.Labels, selector)
+		default:
+			return nil, fmt.Errorf("unknown filter %q", key)
+		}
+	}
+
+	if len(opt.States) == 0 && !ctx.Bool("all") {
+		opt.States = []client.State{client.StateRunning}
+	}
+
+	return opt, nil
+}
+
+func printPsTable(rows []psRow) error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "NAME\tPID\tSTATE\tEXIT CODE\tIMAGE\tUPTIME")
+
+	for _, row := range rows {
+		pid, exitCode, uptime := "-", "-", "-"
+		if row.PID > 0 {
+			pid = strconv.Itoa(row.PID)
+		}
+		if row.ExitCode != nil {
+			exitCode = strconv.Itoa(*row.ExitCode)
+			if row.Signal != "" {
+				exitCode += " (" + row.Signal + ")"
+			}
+		}
+		if row.State == client.StateRunning {
+			uptime = (time.Duration(row.Uptime) * time.Second).String()
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", row.Name, pid, row.State, exitCode, row.Image, uptime)
+	}
+
+	return w.Flush()
+}
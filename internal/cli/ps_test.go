@@ -0,0 +1,140 @@
+package cli_test
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/codingpa-ws/foxbox/client"
+	"github.com/codingpa-ws/foxbox/internal/cli"
+	"github.com/codingpa-ws/foxbox/internal/store"
+	"github.com/stretchr/testify/require"
+)
+
+// Runs foxbox with the given arguments and returns its stdout.
+func runCLI(t *testing.T, args ...string) (string, error) {
+	require := require.New(t)
+	r, w, err := os.Pipe()
+	require.NoError(err)
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+
+	output := make(chan string)
+	go func() {
+		b, _ := io.ReadAll(r)
+		output <- string(b)
+	}()
+	err = cli.Start(append([]string{"foxbox"}, args...))
+	w.Close()
+	return <-output, err
+}
+
+// Adds boxes in every state to the store of a temporary home directory.
+func psStore(t *testing.T) {
+	require := require.New(t)
+	t.Setenv("HOME", t.TempDir())
+	boxStore, err := client.GetOrCreateUserStore()
+	require.NoError(err)
+
+	started := time.Now().Add(-time.Minute)
+	for name, state := range map[string]store.RunState{
+		"running": {StartedAt: started},
+		"exited":  {StartedAt: started, FinishedAt: started.Add(time.Second), ExitCode: 137, Signal: "SIGKILL"},
+		"stopped": {},
+	} {
+		entry, err := boxStore.NewEntry(name)
+		require.NoError(err)
+		require.NoError(entry.SetConfig(client.BoxConfig{
+			Version: client.BoxConfigVersion,
+			Name:    name,
+			Image:   client.ImageRef{Name: "alpine"},
+			Labels:  map[string]string{"state": name},
+		}))
+		if !state.StartedAt.IsZero() {
+			require.NoError(entry.SetRunState(state))
+		}
+		if name == "running" {
+			// Any live process counts as running box
+			require.NoError(entry.SetPID(os.Getpid()))
+		}
+	}
+}
+
+func TestPsFilters(t *testing.T) {
+	require := require.New(t)
+	psStore(t)
+
+	for args, want := range map[string][]string{
+		"":                                     {"running"},
+		"-a":                                   {"exited", "running", "stopped"},
+		"-f state=exited":                      {"exited"},
+		"-f state=exited -f state=stopped":     {"exited", "stopped"},
+		"-a -f state=running":                  {"running"},
+		"-a -f label=state=stopped":            {"stopped"},
+		"-f label=state -f state=stopped":      {"stopped"},
+		"-f state=running -f label=state=none": nil,
+	} {
+		output, err := runCLI(t, append([]string{"ps", "--format", "json"}, strings.Fields(args)...)...)
+		require.NoError(err, args)
+		var rows []struct{ Name string }
+		require.NoError(json.Unmarshal([]byte(output), &rows), args)
+		var names []string
+		for _, row := range rows {
+			names = append(names, row.Name)
+		}
+		require.Equal(want, names, args)
+	}
+
+	for _, filter := range []string{"state", "state=paused", "status=running", "label="} {
+		_, err := runCLI(t, "ps", "-f", filter)
+		require.Error(err, filter)
+	}
+	_, err := runCLI(t, "ps", "--format", "yaml")
+	require.ErrorContains(err, "unknown format")
+}
+
+func TestPsOutput(t *testing.T) {
+	require := require.New(t)
+	psStore(t)
+
+	output, err := runCLI(t, "ps", "-a", "--format", "json")
+	require.NoError(err)
+	var rows []map[string]any
+	require.NoError(json.Unmarshal([]byte(output), &rows))
+	require.Len(rows, 3)
+
+	// Fields scripts rely on, omitted where they don’t apply
+	exited, running, stopped := rows[0], rows[1], rows[2]
+	require.Equal("exited", exited["name"])
+	require.Equal("exited", exited["state"])
+	require.Equal("alpine", exited["image"])
+	require.Equal(float64(137), exited["exitCode"])
+	require.Equal("SIGKILL", exited["signal"])
+	require.Contains(exited, "startedAt")
+	require.Contains(exited, "finishedAt")
+	require.NotContains(exited, "pid")
+	require.NotContains(exited, "uptime")
+
+	require.Equal("running", running["state"])
+	require.Equal(float64(os.Getpid()), running["pid"])
+	require.InDelta(60, running["uptime"], 10)
+	require.NotContains(running, "exitCode")
+	require.NotContains(running, "finishedAt")
+
+	require.Equal("stopped", stopped["state"])
+	for _, key := range []string{"pid", "exitCode", "signal", "startedAt", "finishedAt", "uptime"} {
+		require.NotContains(stopped, key)
+	}
+
+	output, err = runCLI(t, "ps", "-a")
+	require.NoError(err)
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	require.Len(lines, 4)
+	require.Equal([]string{"NAME", "PID", "STATE", "EXIT", "CODE", "IMAGE", "UPTIME"}, strings.Fields(lines[0]))
+	require.Equal([]string{"exited", "-", "exited", "137", "(SIGKILL)", "alpine", "-"}, strings.Fields(lines[1]))
+	require.Equal([]string{"stopped", "-", "stopped", "-", "alpine", "-"}, strings.Fields(lines[3]))
+}
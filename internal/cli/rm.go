@@ -1,8 +1,11 @@
 package cli
 
 import (
+	"errors"
 	"fmt"
+	"time"
 
+	"github.com/codingpa-ws/foxbox/client"
 	"github.com/urfave/cli/v2"
 )
 
@@ -12,16 +15,64 @@ func init() {
 		Usage:     "Remove a foxbox",
 		Action:    rm,
 		UsageText: "[name...]",
+		Flags: []cli.Flag{
+			&cli.StringSliceFlag{
+				Name:  "filter",
+				Usage: "removes all foxboxes matching label=key[=value] instead of named ones",
+			},
+			&cli.BoolFlag{
+				Name:    "force",
+				Aliases: []string{"f"},
+				Usage:   "stops running foxboxes before removing them",
+			},
+		},
 	})
 }
 
 func rm(ctx *cli.Context) (err error) {
-	for _, id := range ctx.Args().Slice() {
-		err := foxbox.Delete(id, nil)
+	ids := ctx.Args().Slice()
+	filtered := ctx.IsSet("filter")
+	if filtered {
+		if len(ids) > 0 {
+			return fmt.Errorf("names can’t be combined with --filter")
+		}
+		selectors, err := labelFilters(ctx)
+		if err != nil {
+			return err
+		}
+		ids, err = foxbox.List(&client.ListOptions{Labels: selectors})
+		if err != nil {
+			return err
+		}
+	}
+
+	// Removes the other boxes if one fails
+	var errs []error
+	for _, id := range ids {
+		err := remove(id, ctx.Bool("force"))
 		if err != nil {
-			return fmt.Errorf("removing %s: %w", id, err)
+			errs = append(errs, fmt.Errorf("removing %s: %w", id, err))
+			continue
+		}
+		// Shows which boxes matched
+		if filtered {
+			fmt.Println(id)
 		}
 	}
 
-	return nil
+	return errors.Join(errs...)
+}
+
+func remove(id string, force bool) error {
+	if force {
+		err := foxbox.Stop(id, 10*time.Second)
+		if err != nil {
+			return err
+		}
+	}
+	err := foxbox.Delete(id, nil)
+	if errors.Is(err, client.ErrBoxRunning) {
+		return fmt.Errorf("%w (or use --force)", err)
+	}
+	return err
 }
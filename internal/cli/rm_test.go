@@ -0,0 +1,28 @@
+package cli_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/codingpa-ws/foxbox/client"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRmRunning(t *testing.T) {
+	require := require.New(t)
+	psStore(t)
+
+	// Running boxes are kept, while the others are still removed
+	output, err := runCLI(t, "rm", "--filter", "label=state")
+	require.ErrorIs(err, client.ErrBoxRunning)
+	require.ErrorContains(err, "removing running")
+	require.Equal([]string{"exited", "stopped"}, strings.Fields(output))
+
+	output, err = runCLI(t, "ls")
+	require.NoError(err)
+	require.Equal([]string{"running"}, strings.Fields(output))
+
+	_, err = runCLI(t, "rm", "running", "missing")
+	require.ErrorIs(err, client.ErrBoxRunning)
+	require.ErrorContains(err, "removing missing")
+}
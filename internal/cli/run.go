@@ -20,10 +20,29 @@ func init() {
 		Action:    run,
 		ArgsUsage: "[image] [(command) (args...)]",
 		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:  "name",
+				Usage: "name of the foxbox (letters, digits and hyphens), random by default",
+			},
 			&cli.BoolFlag{
 				Name:  "rm",
 				Usage: "removes the foxbox after execution has finished",
 			},
+			&cli.BoolFlag{
+				Name:    "detach",
+				Aliases: []string{"d"},
+				Usage:   "runs the foxbox in the background and prints its name",
+			},
+			&cli.StringFlag{
+				Name:  "pull",
+				Usage: "when to pull the image from the registry (missing, always or never)",
+				Value: string(client.PullMissing),
+			},
+			&cli.StringSliceFlag{
+				Name:    "label",
+				Aliases: []string{"l"},
+				Usage:   "sets labels of the foxbox (key=value, or key for an empty value)",
+			},
 			&cli.BoolFlag{
 				Name:  "disable-network",
 				Usage: "disables bridge networking (via slirp)",
@@ -45,6 +64,24 @@ func init() {
 				Aliases: []string{"v"},
 				Usage:   "mounts local volumes in the format host:box",
 			},
+			&cli.StringSliceFlag{
+				Name:    "env",
+				Aliases: []string{"e"},
+				Usage:   "sets environment variables (KEY=value, or KEY to use the value of the current environment)",
+			},
+			&cli.StringSliceFlag{
+				Name:  "env-file",
+				Usage: "reads environment variables from files with one KEY=value per line",
+			},
+			&cli.StringFlag{
+				Name:    "workdir",
+				Aliases: []string{"w"},
+				Usage:   "working directory inside the foxbox",
+			},
+			&cli.StringFlag{
+				Name:  "entrypoint",
+				Usage: `overrides the entrypoint of the image ("" removes it)`,
+			},
 		},
 	})
 }
@@ -54,6 +91,15 @@ func run(ctx *cli.Context) (err error) {
 	if args.Len() == 0 {
 		return fmt.Errorf("image not specified: use `foxbox run <image>`")
 	}
+	detach := ctx.Bool("detach")
+	if detach && ctx.Bool("rm") {
+		return fmt.Errorf("--rm can’t be combined with --detach")
+	}
+
+	createOpt, err := createOptions(ctx)
+	if err != nil {
+		return
+	}
 
 	var v datasize.ByteSize
 	if memory := ctx.String("memory"); memory != "" {
@@ -77,10 +123,16 @@ func run(ctx *cli.Context) (err error) {
 		}
 	}
 
-	id, err := foxbox.Create(&client.CreateOptions{
-		Image: args.First(),
-	})
+	env, err := parseEnv(ctx.StringSlice("env-file"), ctx.StringSlice("env"))
+	if err != nil {
+		return
+	}
+	var entrypoint []string
+	if ctx.IsSet("entrypoint") {
+		entrypoint = []string{ctx.String("entrypoint")}
+	}
 
+	id, err := foxbox.Create(createOpt)
 	if err != nil {
 		return err
 	}
@@ -96,17 +148,54 @@ func run(ctx *cli.Context) (err error) {
 
 	err = foxbox.Run(id, &client.RunOptions{
 		Command:          args.Slice()[1:],
+		Entrypoint:       entrypoint,
+		Env:              env,
+		WorkDir:          ctx.String("workdir"),
 		EnableNetworking: true,
 		MaxMemoryBytes:   uint(v.Bytes()),
 		MaxCPUs:          float32(ctx.Float64("cpu")),
 		MaxProcesses:     ctx.Uint("max-pids"),
 		Volumes:          volumes,
+		Detach:           detach,
 	})
+	if err == nil && detach {
+		fmt.Println(id)
+	}
 
 	var exitError *exec.ExitError
 	if errors.As(err, &exitError) {
-		os.Exit(exitError.ExitCode())
+		exitWith(exitError)
+	}
+
+	return
+}
+
+// Reads env files first, so variables given directly take precedence.
+// Variables without value are taken from the current environment.
+func parseEnv(files, vars []string) (env []string, err error) {
+	var all []string
+	for _, file := range files {
+		b, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("reading env file: %w", err)
+		}
+		for _, line := range strings.Split(string(b), "\n") {
+			line = strings.TrimSpace(line)
+			if line != "" && !strings.HasPrefix(line, "#") {
+				all = append(all, line)
+			}
+		}
 	}
 
+	for _, variable := range append(all, vars...) {
+		if !strings.Contains(variable, "=") {
+			value, ok := os.LookupEnv(variable)
+			if !ok {
+				continue
+			}
+			variable += "=" + value
+		}
+		env = append(env, variable)
+	}
 	return
 }
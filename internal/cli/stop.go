@@ -0,0 +1,36 @@
+package cli
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/urfave/cli/v2"
+)
+
+func init() {
+	app.Commands = append(app.Commands, &cli.Command{
+		Name:      "stop",
+		Usage:     "Stop running foxboxes",
+		Action:    stop,
+		ArgsUsage: "[name...]",
+		Flags: []cli.Flag{
+			&cli.DurationFlag{
+				Name:    "time",
+				Aliases: []string{"t"},
+				Usage:   "time to wait after SIGTERM before killing the foxbox",
+				Value:   10 * time.Second,
+			},
+		},
+	})
+}
+
+func stop(ctx *cli.Context) (err error) {
+	for _, name := range ctx.Args().Slice() {
+		err := foxbox.Stop(name, ctx.Duration("time"))
+		if err != nil {
+			return fmt.Errorf("stopping %s: %w", name, err)
+		}
+	}
+
+	return nil
+}
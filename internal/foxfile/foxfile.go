@@ -0,0 +1,249 @@
+// Package foxfile parses Foxfiles, which describe how to build
+// images similar to Dockerfiles:
+//
+//	from alpine:3.18
+//	env GREETING="hello world"
+//	workdir /app
+//	copy . .
+//	run apk add --no-cache curl
+//	cmd ["./main"]
+//
+// Keywords are case-insensitive, lines ending with a backslash
+// continue on the next line and lines starting with # are comments.
+package foxfile
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+const (
+	From       = "from"
+	Run        = "run"
+	Copy       = "copy"
+	Env        = "env"
+	Workdir    = "workdir"
+	Cmd        = "cmd"
+	Entrypoint = "entrypoint"
+	Merge      = "merge"
+	Install    = "install"
+)
+
+var keywords = map[string]bool{
+	From:       true,
+	Run:        true,
+	Copy:       true,
+	Env:        true,
+	Workdir:    true,
+	Cmd:        true,
+	Entrypoint: true,
+	Merge:      true,
+	Install:    true,
+}
+
+type Instruction struct {
+	// Line the instruction starts on
+	Line    int
+	Keyword string
+	// Everything after the keyword
+	Args string
+}
+
+func (self Instruction) String() string {
+	return self.Keyword + " " + self.Args
+}
+
+// Parses a Foxfile, which has to start with a from instruction.
+func Parse(r io.Reader) ([]Instruction, error) {
+	var instructions []Instruction
+	scanner := bufio.NewScanner(r)
+	var current *Instruction
+	line := 0
+
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(text, "#") || (current == nil && text == "") {
+			continue
+		}
+
+		continued := strings.HasSuffix(text, "\\")
+		text = strings.TrimSuffix(text, "\\")
+		if current == nil {
+			keyword, args, _ := strings.Cut(text, " ")
+			current = &Instruction{
+				Line:    line,
+				Keyword: strings.ToLower(keyword),
+				Args:    strings.TrimSpace(args),
+			}
+		} else {
+			current.Args = strings.TrimSpace(current.Args + " " + text)
+		}
+
+		if !continued {
+			instructions = append(instructions, *current)
+			current = nil
+		}
+	}
+	if scanner.Err() != nil {
+		return nil, scanner.Err()
+	}
+	if current != nil {
+		instructions = append(instructions, *current)
+	}
+
+	for _, instruction := range instructions {
+		err := validate(instruction)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", instruction.Line, err)
+		}
+	}
+	if len(instructions) == 0 || instructions[0].Keyword != From {
+		return nil, errors.New("a Foxfile has to start with from")
+	}
+	return instructions, nil
+}
+
+func validate(instruction Instruction) error {
+	if !keywords[instruction.Keyword] {
+		return fmt.Errorf("unknown instruction %q", instruction.Keyword)
+	}
+	if instruction.Args == "" {
+		return fmt.Errorf("%s needs arguments", instruction.Keyword)
+	}
+
+	switch instruction.Keyword {
+	case From:
+		words, err := Words(instruction.Args)
+		if err == nil && len(words) != 1 {
+			err = errors.New("from takes exactly one image")
+		}
+		return err
+	case Copy:
+		words, err := Words(instruction.Args)
+		if err == nil && len(words) < 2 {
+			err = errors.New("copy needs at least one source and a destination")
+		}
+		return err
+	case Env:
+		_, err := instruction.EnvVars()
+		return err
+	case Workdir, Install:
+		_, err := Words(instruction.Args)
+		return err
+	case Merge:
+		_, _, err := instruction.MergeArgs()
+		return err
+	case Run, Cmd, Entrypoint:
+		_, err := instruction.Command()
+		return err
+	}
+	return nil
+}
+
+// Returns the command of run, cmd and entrypoint instructions. Commands
+// written as JSON array are used as is, all others are run by /bin/sh.
+func (self Instruction) Command() ([]string, error) {
+	if !strings.HasPrefix(self.Args, "[") {
+		return []string{"/bin/sh", "-c", self.Args}, nil
+	}
+	var args []string
+	err := json.Unmarshal([]byte(self.Args), &args)
+	if err != nil {
+		return nil, fmt.Errorf("parsing command as JSON array: %w", err)
+	}
+	if len(args) == 0 {
+		return nil, errors.New("empty command")
+	}
+	return args, nil
+}
+
+// Returns the images of merge instructions and their conflict
+// policy, which is empty unless given with --on-conflict=policy.
+func (self Instruction) MergeArgs() (images []string, onConflict string, err error) {
+	words, err := Words(self.Args)
+	if err != nil {
+		return
+	}
+	for _, word := range words {
+		if value, ok := strings.CutPrefix(word, "--on-conflict="); ok {
+			onConflict = value
+		} else if strings.HasPrefix(word, "-") {
+			return nil, "", fmt.Errorf("unknown flag %s", word)
+		} else {
+			images = append(images, word)
+		}
+	}
+	if len(images) == 0 {
+		return nil, "", errors.New("merge needs at least one image")
+	}
+	return
+}
+
+// Returns the variables of env instructions as KEY=value. Both
+// env KEY=value KEY2="other value" and env KEY value are supported.
+func (self Instruction) EnvVars() ([]string, error) {
+	words, err := Words(self.Args)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.Contains(words[0], "=") {
+		key, value, _ := strings.Cut(self.Args, " ")
+		return []string{key + "=" + strings.TrimSpace(value)}, nil
+	}
+	for _, word := range words {
+		key, _, found := strings.Cut(word, "=")
+		if !found || key == "" {
+			return nil, fmt.Errorf("invalid variable %q: use KEY=value", word)
+		}
+	}
+	return words, nil
+}
+
+// Splits s into words separated by spaces, where double or single
+// quotes keep spaces and backslashes escape the next character.
+func Words(s string) ([]string, error) {
+	var words []string
+	var word strings.Builder
+	inWord := false
+	var quote rune
+	escaped := false
+
+	for _, r := range s {
+		switch {
+		case escaped:
+			word.WriteRune(r)
+			escaped = false
+		case r == '\\' && quote != '\'':
+			escaped, inWord = true, true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				word.WriteRune(r)
+			}
+		case r == '"' || r == '\'':
+			quote, inWord = r, true
+		case r == ' ' || r == '\t':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+	if quote != 0 {
+		return nil, errors.New("unterminated quote")
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words, nil
+}
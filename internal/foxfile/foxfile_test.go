@@ -0,0 +1,74 @@
+package foxfile_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/codingpa-ws/foxbox/internal/foxfile"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	require := require.New(t)
+
+	instructions, err := foxfile.Parse(strings.NewReader(`# A comment
+FROM alpine:3.18
+
+env GREETING="hello world" NAME=fox
+run apk add \
+    # comments inside continued lines are skipped
+    curl
+copy a "b c" /app/
+workdir /app
+cmd ["./main", "--verbose"]
+`))
+	require.NoError(err)
+	require.Equal([]foxfile.Instruction{
+		{Line: 2, Keyword: "from", Args: "alpine:3.18"},
+		{Line: 4, Keyword: "env", Args: `GREETING="hello world" NAME=fox`},
+		{Line: 5, Keyword: "run", Args: "apk add curl"},
+		{Line: 8, Keyword: "copy", Args: `a "b c" /app/`},
+		{Line: 9, Keyword: "workdir", Args: "/app"},
+		{Line: 10, Keyword: "cmd", Args: `["./main", "--verbose"]`},
+	}, instructions)
+
+	env, err := instructions[1].EnvVars()
+	require.NoError(err)
+	require.Equal([]string{"GREETING=hello world", "NAME=fox"}, env)
+
+	command, err := instructions[2].Command()
+	require.NoError(err)
+	require.Equal([]string{"/bin/sh", "-c", "apk add curl"}, command)
+	command, err = instructions[5].Command()
+	require.NoError(err)
+	require.Equal([]string{"./main", "--verbose"}, command)
+
+	images, onConflict, err := foxfile.Instruction{Keyword: "merge", Args: "golang:1.21.0 --on-conflict=right valkey"}.MergeArgs()
+	require.NoError(err)
+	require.Equal([]string{"golang:1.21.0", "valkey"}, images)
+	require.Equal("right", onConflict)
+
+	words, err := foxfile.Words(instructions[3].Args)
+	require.NoError(err)
+	require.Equal([]string{"a", "b c", "/app/"}, words)
+}
+
+func TestParseErrors(t *testing.T) {
+	invalid := map[string]string{
+		"empty":             "# nothing\n",
+		"no from":           "run true\n",
+		"unknown":           "from alpine\nfrobnicate\n",
+		"missing arguments": "from alpine\nrun\n",
+		"two images":        "from alpine debian\n",
+		"copy destination":  "from alpine\ncopy a\n",
+		"invalid env":       "from alpine\nenv A=1 =2\n",
+		"invalid json":      "from alpine\ncmd [\"a\"\n",
+		"open quote":        "from alpine\ncopy \"a b\n",
+		"merge nothing":     "from alpine\nmerge --on-conflict=left\n",
+		"merge flag":        "from alpine\nmerge --force golang\n",
+	}
+	for name, foxfileContent := range invalid {
+		_, err := foxfile.Parse(strings.NewReader(foxfileContent))
+		require.Error(t, err, name)
+	}
+}
@@ -0,0 +1,160 @@
+// Package fscopy copies directory trees, sharing file data through
+// reflinks where the file system supports them.
+//
+// Files are never hardlinked to the source: boxes write to their
+// files in place, which would modify the source as well.
+package fscopy
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// Copies the contents of src into the existing directory dst,
+// preserving file types, modes, times and, where permitted,
+// ownership. Hardlinks within src are hardlinks within dst.
+func Tree(src, dst string) error {
+	c := &copier{links: map[uint64]string{}}
+	var dirs []string
+
+	err := filepath.WalkDir(src, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		if rel != "." && entry.IsDir() {
+			err = os.Mkdir(target, 0700)
+			if err != nil {
+				return err
+			}
+		}
+		if entry.IsDir() {
+			// Applied last, see below
+			dirs = append(dirs, rel)
+			return nil
+		}
+
+		return c.copy(path, target, info)
+	})
+	if err != nil {
+		return err
+	}
+
+	// Children change the mtime of directories and
+	// read-only directories can’t get any children.
+	for i := len(dirs) - 1; i >= 0; i-- {
+		path := filepath.Join(src, dirs[i])
+		info, err := os.Lstat(path)
+		if err != nil {
+			return err
+		}
+		err = copyMetadata(filepath.Join(dst, dirs[i]), info)
+		if err != nil {
+			return fmt.Errorf("copying %s: %w", path, err)
+		}
+	}
+	return nil
+}
+
+type copier struct {
+	// Destination paths by source inode
+	links map[uint64]string
+}
+
+func (self *copier) copy(path, target string, info fs.FileInfo) (err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("copying %s: %w", path, err)
+		}
+	}()
+
+	stat := info.Sys().(*syscall.Stat_t)
+	if stat.Nlink > 1 && !info.IsDir() {
+		if first, ok := self.links[stat.Ino]; ok {
+			return os.Link(first, target)
+		}
+		self.links[stat.Ino] = target
+	}
+
+	switch info.Mode().Type() {
+	case 0:
+		err = copyFile(path, target)
+	case fs.ModeSymlink:
+		var link string
+		link, err = os.Readlink(path)
+		if err == nil {
+			err = os.Symlink(link, target)
+		}
+	case fs.ModeNamedPipe:
+		err = unix.Mkfifo(target, 0600)
+	case fs.ModeSocket, fs.ModeDevice, fs.ModeDevice | fs.ModeCharDevice:
+		// Can’t be created rootless and aren’t useful in an image
+		return nil
+	default:
+		return fmt.Errorf("unsupported file type %s", info.Mode().Type())
+	}
+	if err != nil {
+		return
+	}
+	return copyMetadata(target, info)
+}
+
+func copyFile(path, target string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+
+	err = unix.IoctlFileClone(int(dst.Fd()), int(src.Fd()))
+	if err != nil {
+		// No reflink support, io.Copy still uses
+		// copy_file_range where possible.
+		_, err = io.Copy(dst, src)
+	}
+	return errors.Join(err, dst.Close())
+}
+
+func copyMetadata(target string, info fs.FileInfo) error {
+	stat := info.Sys().(*syscall.Stat_t)
+
+	// Usually only permitted for our own ids when rootless
+	err := os.Lchown(target, int(stat.Uid), int(stat.Gid))
+	if err != nil && !errors.Is(err, unix.EPERM) && !errors.Is(err, unix.EINVAL) {
+		return err
+	}
+
+	if info.Mode().Type() != fs.ModeSymlink {
+		// Includes setuid, setgid and sticky bits
+		err = unix.Chmod(target, uint32(stat.Mode&0o7777))
+		if err != nil {
+			return err
+		}
+	}
+
+	return unix.UtimesNanoAt(unix.AT_FDCWD, target, []unix.Timespec{
+		unix.Timespec(stat.Atim),
+		unix.Timespec(stat.Mtim),
+	}, unix.AT_SYMLINK_NOFOLLOW)
+}
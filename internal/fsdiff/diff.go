@@ -0,0 +1,266 @@
+// Package fsdiff compares directory trees, such as box file systems
+// with the image they were created from, and merges their changes.
+package fsdiff
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"slices"
+	"sort"
+
+	"golang.org/x/sys/unix"
+)
+
+type Kind string
+
+const (
+	Added   Kind = "A"
+	Changed Kind = "C"
+	Deleted Kind = "D"
+)
+
+type Change struct {
+	// Relative to the root and separated by slashes
+	Path string `json:"path"`
+	Kind Kind   `json:"kind"`
+}
+
+// Returns the changes that turn base into dir, sorted by path. Files
+// are compared by type, permissions, link target and content hash,
+// while mtimes and ownership are ignored. Contents of added
+// directories are listed as well, those of deleted ones aren’t.
+func Diff(base, dir string) ([]Change, error) {
+	return DiffFiltered(base, dir, nil)
+}
+
+// Like Diff, but ignores paths for which skip returns true and the
+// contents of skipped directories. skip is called with a path to open
+// each file in dir with, which is empty if it doesn’t exist, and its
+// name relative to dir. Files are opened relative to their directory
+// without following symlinks, so dir can be the file system of a
+// running box.
+func DiffFiltered(base, dir string, skip func(path, name string) bool) ([]Change, error) {
+	baseFd, err := openRoot(base)
+	if err != nil {
+		return nil, err
+	}
+	defer unix.Close(baseFd)
+	dirFd, err := openRoot(dir)
+	if err != nil {
+		return nil, err
+	}
+	defer unix.Close(dirFd)
+
+	var changes []Change
+	err = walk(dirFd, "", func(fd int, name string, info fs.FileInfo) (bool, error) {
+		if skip != nil && skip(procPath(fd), name) {
+			return false, nil
+		}
+		baseFile, err := lookup(baseFd, name)
+		if missing(err) {
+			changes = append(changes, Change{name, Added})
+			return true, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		defer unix.Close(baseFile)
+		baseInfo, err := os.Stat(procPath(baseFile))
+		if err != nil {
+			return false, err
+		}
+		same, err := sameFile(baseFile, fd, baseInfo, info)
+		if err == nil && !same {
+			changes = append(changes, Change{name, Changed})
+		}
+		return true, err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = walk(baseFd, "", func(fd int, name string, info fs.FileInfo) (bool, error) {
+		dirFile, err := lookup(dirFd, name)
+		if missing(err) {
+			if skip == nil || !skip("", name) {
+				changes = append(changes, Change{name, Deleted})
+			}
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		defer unix.Close(dirFile)
+		if skip != nil && skip(procPath(dirFile), name) {
+			return false, nil
+		}
+		dirInfo, err := os.Stat(procPath(dirFile))
+		if err != nil {
+			return false, err
+		}
+		// Replaced directories had their contents removed as well
+		return dirInfo.IsDir(), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Path < changes[j].Path
+	})
+	return changes, nil
+}
+
+// Reports whether the files at a and b have the same
+// type, permissions, link target and content.
+func Same(a, b string) (bool, error) {
+	fdA, err := unix.Open(a, unix.O_PATH|unix.O_NOFOLLOW|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return false, &fs.PathError{Op: "open", Path: a, Err: err}
+	}
+	defer unix.Close(fdA)
+	fdB, err := unix.Open(b, unix.O_PATH|unix.O_NOFOLLOW|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return false, &fs.PathError{Op: "open", Path: b, Err: err}
+	}
+	defer unix.Close(fdB)
+	infoA, err := os.Stat(procPath(fdA))
+	if err != nil {
+		return false, err
+	}
+	infoB, err := os.Stat(procPath(fdB))
+	if err != nil {
+		return false, err
+	}
+	return sameFile(fdA, fdB, infoA, infoB)
+}
+
+// Compares the files opened as a and b with O_PATH.
+func sameFile(a, b int, infoA, infoB fs.FileInfo) (bool, error) {
+	if infoA.Mode() != infoB.Mode() {
+		return false, nil
+	}
+	switch {
+	case infoA.Mode()&fs.ModeSymlink != 0:
+		linkA, err := readlinkFd(a)
+		if err != nil {
+			return false, err
+		}
+		linkB, err := readlinkFd(b)
+		return linkA == linkB, err
+	case infoA.Mode().IsRegular():
+		if infoA.Size() != infoB.Size() {
+			return false, nil
+		}
+		hashA, err := hashFile(procPath(a))
+		if err != nil {
+			return false, err
+		}
+		hashB, err := hashFile(procPath(b))
+		return hashA == hashB, err
+	}
+	return true, nil
+}
+
+func hashFile(path string) ([sha256.Size]byte, error) {
+	var sum [sha256.Size]byte
+	f, err := os.Open(path)
+	if err != nil {
+		return sum, err
+	}
+	defer f.Close()
+	hash := sha256.New()
+	_, err = io.Copy(hash, f)
+	copy(sum[:], hash.Sum(nil))
+	return sum, err
+}
+
+// Calls fn with the files below the directory opened as fd, sorted
+// by name, which are opened with O_PATH relative to their directory.
+// fn returns whether to walk the contents of directories.
+func walk(fd int, name string, fn func(fd int, name string, info fs.FileInfo) (bool, error)) error {
+	dir, err := os.Open(procPath(fd))
+	if err != nil {
+		return err
+	}
+	names, err := dir.Readdirnames(-1)
+	dir.Close()
+	if err != nil {
+		return err
+	}
+	slices.Sort(names)
+	for _, child := range names {
+		childName := path.Join(name, child)
+		childFd, err := unix.Openat(fd, child, unix.O_PATH|unix.O_NOFOLLOW|unix.O_CLOEXEC, 0)
+		if missing(err) {
+			// Removed while walking
+			continue
+		}
+		if err != nil {
+			return &fs.PathError{Op: "open", Path: childName, Err: err}
+		}
+		err = walkFile(childFd, childName, fn)
+		unix.Close(childFd)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func walkFile(fd int, name string, fn func(fd int, name string, info fs.FileInfo) (bool, error)) error {
+	info, err := os.Stat(procPath(fd))
+	if err != nil {
+		return err
+	}
+	descend, err := fn(fd, name, info)
+	if err != nil || !descend || !info.IsDir() {
+		return err
+	}
+	return walk(fd, name, fn)
+}
+
+func openRoot(dir string) (int, error) {
+	fd, err := unix.Open(dir, unix.O_PATH|unix.O_DIRECTORY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return -1, &fs.PathError{Op: "open", Path: dir, Err: err}
+	}
+	return fd, nil
+}
+
+// Opens name below the directory root with O_PATH. Symlinks aren’t
+// followed, so paths below them are missing like paths below files.
+func lookup(root int, name string) (int, error) {
+	return unix.Openat2(root, name, &unix.OpenHow{
+		Flags:   unix.O_PATH | unix.O_NOFOLLOW | unix.O_CLOEXEC,
+		Resolve: unix.RESOLVE_BENEATH | unix.RESOLVE_NO_SYMLINKS | unix.RESOLVE_NO_MAGICLINKS,
+	})
+}
+
+func procPath(fd int) string {
+	return fmt.Sprintf("/proc/self/fd/%d", fd)
+}
+
+// Reads the target of a symlink opened with O_PATH.
+func readlinkFd(fd int) (string, error) {
+	for size := 256; ; size *= 2 {
+		buf := make([]byte, size)
+		n, err := unix.Readlinkat(fd, "", buf)
+		if err != nil {
+			return "", err
+		}
+		if n < size {
+			return string(buf[:n]), nil
+		}
+	}
+}
+
+// Paths below files and symlinks don’t exist either.
+func missing(err error) bool {
+	return errors.Is(err, fs.ErrNotExist) || errors.Is(err, unix.ENOTDIR) || errors.Is(err, unix.ELOOP)
+}
@@ -0,0 +1,117 @@
+package fsdiff_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/codingpa-ws/foxbox/internal/fsdiff"
+	"github.com/stretchr/testify/require"
+)
+
+// Creates files in dir, where contents starting with -> are symlinks
+// and names ending with a slash are directories.
+func writeTree(t *testing.T, dir string, files map[string]string) {
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		switch {
+		case name[len(name)-1] == '/':
+			require.NoError(t, os.MkdirAll(path, 0755))
+		case len(content) > 2 && content[:2] == "->":
+			require.NoError(t, os.Symlink(content[2:], path))
+		default:
+			require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+		}
+	}
+}
+
+func TestDiff(t *testing.T) {
+	require := require.New(t)
+	base, dir := t.TempDir(), t.TempDir()
+	writeTree(t, base, map[string]string{
+		"etc/hostname": "fox\n",
+		"etc/motd":     "welcome\n",
+		"bin/sh":       "#!\n",
+		"lib/link":     "->a",
+		"var/cache/1":  "1",
+		"opt/x/y":      "",
+	})
+	writeTree(t, dir, map[string]string{
+		"etc/hostname": "box\n",
+		"bin/sh":       "#!\n",
+		"lib/link":     "->b",
+		"usr/bin/tool": "tool",
+		"opt/x":        "now a file",
+		"var/":         "",
+	})
+	require.NoError(os.Chmod(filepath.Join(dir, "bin", "sh"), 0755))
+	// Same content and mode with another mtime
+	writeTree(t, dir, map[string]string{"etc/motd": "welcome\n"})
+	require.NoError(os.Chtimes(filepath.Join(dir, "etc", "motd"), time.Unix(0, 0), time.Unix(0, 0)))
+
+	changes, err := fsdiff.Diff(base, dir)
+	require.NoError(err)
+	require.Equal([]fsdiff.Change{
+		{Path: "bin/sh", Kind: fsdiff.Changed},
+		{Path: "etc/hostname", Kind: fsdiff.Changed},
+		{Path: "lib/link", Kind: fsdiff.Changed},
+		{Path: "opt/x", Kind: fsdiff.Changed},
+		{Path: "usr", Kind: fsdiff.Added},
+		{Path: "usr/bin", Kind: fsdiff.Added},
+		{Path: "usr/bin/tool", Kind: fsdiff.Added},
+		{Path: "var/cache", Kind: fsdiff.Deleted},
+	}, changes)
+
+	// Applying the changes turns base into dir
+	require.NoError(fsdiff.Apply(base, dir, changes))
+	changes, err = fsdiff.Diff(base, dir)
+	require.NoError(err)
+	require.Empty(changes)
+}
+
+func TestDiffSymlinks(t *testing.T) {
+	require := require.New(t)
+	base, dir, outside := t.TempDir(), t.TempDir(), t.TempDir()
+	writeTree(t, outside, map[string]string{"secret": "secret"})
+	writeTree(t, base, map[string]string{
+		"lib":     "->" + outside,
+		"var/old": "",
+	})
+	// Paths below symlinks are compared with the files in each tree
+	writeTree(t, dir, map[string]string{
+		"lib/secret": "secret",
+		"var":        "->" + outside,
+	})
+
+	changes, err := fsdiff.Diff(base, dir)
+	require.NoError(err)
+	require.Equal([]fsdiff.Change{
+		{Path: "lib", Kind: fsdiff.Changed},
+		{Path: "lib/secret", Kind: fsdiff.Added},
+		{Path: "var", Kind: fsdiff.Changed},
+	}, changes)
+}
+
+func TestDiffFiltered(t *testing.T) {
+	require := require.New(t)
+	base, dir := t.TempDir(), t.TempDir()
+	writeTree(t, base, map[string]string{
+		"tmp/old":      "",
+		"etc/hostname": "fox\n",
+	})
+	writeTree(t, dir, map[string]string{
+		"tmp/new":      "",
+		"proc/1/stat":  "",
+		"etc/hostname": "box\n",
+		"etc/motd":     "welcome\n",
+	})
+
+	changes, err := fsdiff.DiffFiltered(base, dir, func(path, name string) bool {
+		content, _ := os.ReadFile(path)
+		return name == "tmp" || name == "proc" || string(content) == "box\n"
+	})
+	require.NoError(err)
+	require.Equal([]fsdiff.Change{{Path: "etc/motd", Kind: fsdiff.Added}}, changes)
+}
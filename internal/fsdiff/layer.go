@@ -0,0 +1,58 @@
+package fsdiff
+
+import (
+	"errors"
+	"io"
+
+	"github.com/codingpa-ws/foxbox/internal/archive"
+)
+
+// Writes the changes as OCI image layer with the files from root,
+// where deleted paths become whiteouts.
+func WriteLayer(w io.Writer, root string, changes []Change) error {
+	var paths, deleted []string
+	for _, change := range changes {
+		if change.Kind == Deleted {
+			deleted = append(deleted, change.Path)
+		} else {
+			paths = append(paths, change.Path)
+		}
+	}
+	return archive.CreateLayer(w, root, paths, deleted)
+}
+
+// Applies the changes with the files from root to dir.
+func Apply(dir, root string, changes []Change) error {
+	return pipe(func(w io.Writer) error {
+		return WriteLayer(w, root, changes)
+	}, func(r io.Reader) error {
+		return archive.ExtractLayer(r, dir)
+	})
+}
+
+// Applies the merged changes of the trees to dir.
+func (self *Merged) Apply(dir string, trees []Tree) error {
+	for i, changes := range self.Changes {
+		err := Apply(dir, trees[i].Root, changes)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Streams what write writes to read.
+func pipe(write func(io.Writer) error, read func(io.Reader) error) error {
+	r, w := io.Pipe()
+	written := make(chan error, 1)
+	go func() {
+		err := write(w)
+		w.CloseWithError(err)
+		written <- err
+	}()
+
+	err := read(r)
+	// Unblocks write if reading failed
+	r.Close()
+	return errors.Join(err, <-written)
+}
@@ -0,0 +1,324 @@
+package fsdiff
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// How conflicting changes are resolved when merging.
+type Policy string
+
+const (
+	// Merging fails with a *ConflictError
+	PolicyFail Policy = "fail"
+	// The change of the earlier tree is kept
+	PolicyLeft Policy = "left"
+	// The change of the later tree is kept
+	PolicyRight Policy = "right"
+)
+
+// A directory tree and its changes to the base of the merge.
+type Tree struct {
+	Root    string
+	Changes []Change
+}
+
+type Conflict struct {
+	Path   string
+	Reason string
+}
+
+func (self Conflict) String() string {
+	return "/" + self.Path + ": " + self.Reason
+}
+
+type ConflictError struct {
+	Conflicts []Conflict
+}
+
+func (self *ConflictError) Error() string {
+	lines := make([]string, len(self.Conflicts))
+	for i, conflict := range self.Conflicts {
+		lines[i] = conflict.String()
+	}
+	return fmt.Sprintf("%d conflicts:\n%s", len(lines), strings.Join(lines, "\n"))
+}
+
+type Merged struct {
+	// Changes to apply from each tree, in the order of the trees
+	Changes [][]Change
+	// Conflicts resolved according to the policy
+	Conflicts []Conflict
+}
+
+// Merges the changes of trees with the same base. Changes of the same
+// path conflict unless they are equal, as do changes below paths
+// deleted by another tree. The apk database conflicts as a whole
+// if trees changed it differently, see apkPath.
+func Merge(trees []Tree, policy Policy) (*Merged, error) {
+	switch policy {
+	case PolicyFail, PolicyLeft, PolicyRight:
+	default:
+		return nil, fmt.Errorf("unknown conflict policy %q: use fail, left or right", policy)
+	}
+
+	merged := &Merged{}
+	apkOwner, err := merged.mergeAPK(trees, policy)
+	if err != nil {
+		return nil, err
+	}
+	// Index of the tree whose change of a path is applied
+	owners := map[string]int{}
+	kinds := make([]map[string]Kind, len(trees))
+
+	for i, tree := range trees {
+		kinds[i] = map[string]Kind{}
+		for _, change := range tree.Changes {
+			kinds[i][change.Path] = change.Kind
+			if apkPath(change.Path) {
+				if i == apkOwner {
+					owners[change.Path] = i
+				}
+				continue
+			}
+			j, ok := owners[change.Path]
+			if !ok {
+				if reason, ok := deletedAncestor(change.Path, i, owners, kinds); ok {
+					merged.add(Conflict{change.Path, reason})
+					if policy == PolicyLeft {
+						continue
+					}
+				}
+				owners[change.Path] = i
+				continue
+			}
+
+			reason, err := conflict(trees[j].Root, tree.Root, change.Path, kinds[j][change.Path], change.Kind)
+			if err != nil {
+				return nil, err
+			}
+			if reason == "" {
+				continue
+			}
+			merged.add(Conflict{change.Path, reason})
+			if policy == PolicyRight {
+				owners[change.Path] = i
+			}
+		}
+	}
+	if policy == PolicyFail && len(merged.Conflicts) > 0 {
+		return nil, &ConflictError{merged.Conflicts}
+	}
+
+	merged.Changes = make([][]Change, len(trees))
+	for i, tree := range trees {
+		for _, change := range tree.Changes {
+			if j, ok := owners[change.Path]; ok && j == i {
+				merged.Changes[i] = append(merged.Changes[i], change)
+			}
+		}
+	}
+	return merged, nil
+}
+
+func (self *Merged) add(conflict Conflict) {
+	self.Conflicts = append(self.Conflicts, conflict)
+}
+
+// Returns why the changes of both trees conflict or
+// an empty string if they are the same.
+func conflict(left, right, name string, leftKind, rightKind Kind) (string, error) {
+	switch {
+	case leftKind == Deleted && rightKind == Deleted:
+		return "", nil
+	case leftKind == Deleted || rightKind == Deleted:
+		return "deleted and changed", nil
+	}
+	same, err := Same(filepath.Join(left, name), filepath.Join(right, name))
+	if err != nil || same {
+		return "", err
+	}
+	return "changed differently", nil
+}
+
+// Reports whether another tree deleted a parent directory of name
+// or, if name is deleted, changed something below it.
+func deletedAncestor(name string, i int, owners map[string]int, kinds []map[string]Kind) (string, bool) {
+	for dir := path.Dir(name); dir != "."; dir = path.Dir(dir) {
+		if j, ok := owners[dir]; ok && j != i && kinds[j][dir] == Deleted {
+			return fmt.Sprintf("/%s is deleted", dir), true
+		}
+	}
+	if kinds[i][name] != Deleted {
+		return "", false
+	}
+	for other, j := range owners {
+		if j != i && strings.HasPrefix(other, name+"/") {
+			return fmt.Sprintf("deleted but /%s is changed", other), true
+		}
+	}
+	return "", false
+}
+
+// Files of the database of apk, the Alpine package manager. They are
+// only consistent with each other, so they are merged as a whole.
+func apkPath(name string) bool {
+	return name == "etc/apk/world" || name == "lib/apk/db" || strings.HasPrefix(name, "lib/apk/db/")
+}
+
+// Returns the index of the tree whose changes of the apk database are
+// applied, or -1 if no tree changed it. Trees that changed it
+// differently conflict.
+func (self *Merged) mergeAPK(trees []Tree, policy Policy) (owner int, err error) {
+	owner = -1
+	for i, tree := range trees {
+		if len(apkChanges(tree)) == 0 {
+			continue
+		}
+		if owner == -1 {
+			owner = i
+			continue
+		}
+		reason, err := apkConflict(trees[owner], tree)
+		if err != nil {
+			return -1, err
+		}
+		if reason == "" {
+			continue
+		}
+		self.add(Conflict{"lib/apk/db", reason})
+		if policy == PolicyRight {
+			owner = i
+		}
+	}
+	return owner, nil
+}
+
+func apkChanges(tree Tree) map[string]Kind {
+	changes := map[string]Kind{}
+	for _, change := range tree.Changes {
+		if apkPath(change.Path) {
+			changes[change.Path] = change.Kind
+		}
+	}
+	return changes
+}
+
+// Returns why the apk databases of both trees conflict, naming the
+// packages installed differently, or an empty string if they are
+// changed the same way.
+func apkConflict(left, right Tree) (string, error) {
+	leftChanges, rightChanges := apkChanges(left), apkChanges(right)
+	var files []string
+	for name, leftKind := range leftChanges {
+		rightKind, ok := rightChanges[name]
+		if !ok {
+			files = append(files, "/"+name)
+			continue
+		}
+		reason, err := conflict(left.Root, right.Root, name, leftKind, rightKind)
+		if err != nil {
+			return "", err
+		}
+		if reason != "" {
+			files = append(files, "/"+name)
+		}
+	}
+	for name := range rightChanges {
+		if _, ok := leftChanges[name]; !ok {
+			files = append(files, "/"+name)
+		}
+	}
+	if len(files) == 0 {
+		return "", nil
+	}
+
+	packages, err := apkVersionChanges(left.Root, right.Root)
+	if err != nil {
+		return "", err
+	}
+	if len(packages) > 0 {
+		return "packages installed differently: " + strings.Join(packages, ", "), nil
+	}
+	sort.Strings(files)
+	return "changed differently in " + strings.Join(files, ", "), nil
+}
+
+// Lists packages installed in different versions,
+// formatted like "curl 8.4.0-r0 and 8.5.0-r0".
+func apkVersionChanges(left, right string) ([]string, error) {
+	leftVersions, err := apkVersions(left)
+	if err != nil {
+		return nil, err
+	}
+	rightVersions, err := apkVersions(right)
+	if err != nil {
+		return nil, err
+	}
+	names := map[string]bool{}
+	for name := range leftVersions {
+		names[name] = true
+	}
+	for name := range rightVersions {
+		names[name] = true
+	}
+
+	var changes []string
+	for name := range names {
+		leftVersion, rightVersion := leftVersions[name], rightVersions[name]
+		if leftVersion == rightVersion {
+			continue
+		}
+		if leftVersion == "" {
+			leftVersion = "not installed"
+		}
+		if rightVersion == "" {
+			rightVersion = "not installed"
+		}
+		changes = append(changes, fmt.Sprintf("%s %s and %s", name, leftVersion, rightVersion))
+	}
+	sort.Strings(changes)
+	return changes, nil
+}
+
+// Maps the names of the packages installed in the
+// tree at root to their versions.
+func apkVersions(root string) (map[string]string, error) {
+	db, err := os.ReadFile(filepath.Join(root, "lib/apk/db/installed"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	versions := map[string]string{}
+	for _, pkg := range apkPackages(db) {
+		versions[apkField(pkg, "P")] = apkField(pkg, "V")
+	}
+	return versions, nil
+}
+
+func apkPackages(db []byte) [][]byte {
+	var packages [][]byte
+	for _, block := range bytes.Split(db, []byte("\n\n")) {
+		block = bytes.Trim(block, "\n")
+		if len(block) > 0 {
+			packages = append(packages, block)
+		}
+	}
+	return packages
+}
+
+func apkField(pkg []byte, key string) string {
+	for _, line := range strings.Split(string(pkg), "\n") {
+		if value, ok := strings.CutPrefix(line, key+":"); ok {
+			return value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,143 @@
+package fsdiff_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/codingpa-ws/foxbox/internal/fsdiff"
+	"github.com/stretchr/testify/require"
+)
+
+const apkBase = "P:musl\nV:1.2.4-r2\n\nP:busybox\nV:1.36.1-r5\n\n"
+
+// Returns a base tree with an apk database and two
+// trees built on it with the given extra files.
+func mergeTrees(t *testing.T, left, right map[string]string) (base string, trees []fsdiff.Tree) {
+	base = t.TempDir()
+	files := map[string]string{
+		"lib/apk/db/installed": apkBase,
+		"etc/apk/world":        "busybox\n",
+		"etc/hostname":         "fox\n",
+	}
+	writeTree(t, base, files)
+	for _, extra := range []map[string]string{left, right} {
+		dir := t.TempDir()
+		writeTree(t, dir, files)
+		writeTree(t, dir, extra)
+		changes, err := fsdiff.Diff(base, dir)
+		require.NoError(t, err)
+		trees = append(trees, fsdiff.Tree{Root: dir, Changes: changes})
+	}
+	return
+}
+
+func TestMerge(t *testing.T) {
+	require := require.New(t)
+	git := map[string]string{
+		"lib/apk/db/installed":   apkBase + "P:git\nV:2.40.1-r0\n\n",
+		"lib/apk/db/scripts.tar": "git scripts",
+		"etc/apk/world":          "busybox\ngit\n",
+	}
+	left := map[string]string{"usr/local/go/bin/go": "go", "etc/shared": "same"}
+	right := map[string]string{"usr/bin/valkey": "valkey", "etc/shared": "same"}
+	for name, content := range git {
+		left[name] = content
+	}
+	base, trees := mergeTrees(t, left, right)
+
+	merged, err := fsdiff.Merge(trees, fsdiff.PolicyFail)
+	require.NoError(err)
+	require.Empty(merged.Conflicts)
+	require.NoError(merged.Apply(base, trees))
+
+	for _, name := range []string{"usr/local/go/bin/go", "usr/bin/valkey", "etc/shared"} {
+		require.FileExists(filepath.Join(base, name))
+	}
+	for name, content := range git {
+		b, err := os.ReadFile(filepath.Join(base, name))
+		require.NoError(err)
+		require.Equal(content, string(b), name)
+	}
+
+	// Installing the same packages doesn’t conflict
+	_, trees = mergeTrees(t, git, git)
+	merged, err = fsdiff.Merge(trees, fsdiff.PolicyFail)
+	require.NoError(err)
+	require.Empty(merged.Conflicts)
+}
+
+func TestMergeConflicts(t *testing.T) {
+	left := map[string]string{
+		"etc/hostname":           "left\n",
+		"lib/apk/db/installed":   apkBase + "P:curl\nV:8.4.0-r0\n\n",
+		"lib/apk/db/scripts.tar": "left scripts",
+	}
+	right := map[string]string{
+		"etc/hostname":           "right\n",
+		"lib/apk/db/installed":   apkBase + "P:curl\nV:8.5.0-r0\n\nP:git\nV:2.40.1-r0\n\n",
+		"lib/apk/db/scripts.tar": "right scripts",
+	}
+
+	t.Run("fail", func(t *testing.T) {
+		_, trees := mergeTrees(t, left, right)
+		_, err := fsdiff.Merge(trees, fsdiff.PolicyFail)
+		var conflictErr *fsdiff.ConflictError
+		require.True(t, errors.As(err, &conflictErr))
+		require.Equal(t, []fsdiff.Conflict{
+			{Path: "lib/apk/db", Reason: "packages installed differently: curl 8.4.0-r0 and 8.5.0-r0, git not installed and 2.40.1-r0"},
+			{Path: "etc/hostname", Reason: "changed differently"},
+		}, conflictErr.Conflicts)
+	})
+
+	t.Run("apk scripts", func(t *testing.T) {
+		_, trees := mergeTrees(t,
+			map[string]string{"lib/apk/db/scripts.tar": "left scripts"},
+			map[string]string{"lib/apk/db/scripts.tar": "right scripts", "lib/apk/db/triggers": "triggers"},
+		)
+		_, err := fsdiff.Merge(trees, fsdiff.PolicyFail)
+		var conflictErr *fsdiff.ConflictError
+		require.True(t, errors.As(err, &conflictErr))
+		require.Equal(t, []fsdiff.Conflict{
+			{Path: "lib/apk/db", Reason: "changed differently in /lib/apk/db/scripts.tar, /lib/apk/db/triggers"},
+		}, conflictErr.Conflicts)
+	})
+
+	for policy, want := range map[fsdiff.Policy]string{fsdiff.PolicyLeft: "left", fsdiff.PolicyRight: "right"} {
+		policy, want := policy, want
+		t.Run(string(policy), func(t *testing.T) {
+			require := require.New(t)
+			base, trees := mergeTrees(t, left, right)
+			merged, err := fsdiff.Merge(trees, policy)
+			require.NoError(err)
+			require.Len(merged.Conflicts, 2)
+			require.NoError(merged.Apply(base, trees))
+
+			hostname, err := os.ReadFile(filepath.Join(base, "etc/hostname"))
+			require.NoError(err)
+			require.Equal(want+"\n", string(hostname))
+			// The apk database is kept as a whole
+			for name, content := range map[string]map[string]string{"left": left, "right": right}[want] {
+				b, err := os.ReadFile(filepath.Join(base, name))
+				require.NoError(err)
+				require.Equal(content, string(b), name)
+			}
+		})
+	}
+
+	t.Run("deleted directory", func(t *testing.T) {
+		base := t.TempDir()
+		writeTree(t, base, map[string]string{"srv/data": "data"})
+		deleting, adding := t.TempDir(), t.TempDir()
+		writeTree(t, adding, map[string]string{"srv/data": "data", "srv/new": "new"})
+		var trees []fsdiff.Tree
+		for _, dir := range []string{deleting, adding} {
+			changes, err := fsdiff.Diff(base, dir)
+			require.NoError(t, err)
+			trees = append(trees, fsdiff.Tree{Root: dir, Changes: changes})
+		}
+		_, err := fsdiff.Merge(trees, fsdiff.PolicyFail)
+		require.ErrorContains(t, err, "/srv/new: /srv is deleted")
+	})
+}
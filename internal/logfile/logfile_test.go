@@ -0,0 +1,141 @@
+package logfile_test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/codingpa-ws/foxbox/internal/logfile"
+	"github.com/stretchr/testify/require"
+)
+
+func readLines(t *testing.T, path string, opt logfile.ReadOptions) (lines []string) {
+	err := logfile.Read(path, opt, func(record logfile.Record) error {
+		lines = append(lines, record.Stream+": "+record.Line)
+		return nil
+	})
+	require.NoError(t, err)
+	return
+}
+
+func TestWriteAndRead(t *testing.T) {
+	require := require.New(t)
+	path := filepath.Join(t.TempDir(), "box.log")
+
+	require.Empty(readLines(t, path, logfile.ReadOptions{}), "missing logs must read as empty")
+
+	w, err := logfile.NewWriter(path, 1<<20, 1)
+	require.NoError(err)
+	stdout := w.Stream(logfile.Stdout)
+	stderr := w.Stream(logfile.Stderr)
+
+	_, err = fmt.Fprint(stdout, "hello\nwor")
+	require.NoError(err)
+	_, err = fmt.Fprint(stderr, "oops\n")
+	require.NoError(err)
+	_, err = fmt.Fprint(stdout, "ld\nunterminated")
+	require.NoError(err)
+	require.NoError(stdout.Close())
+	require.NoError(stderr.Close())
+	require.NoError(w.Close())
+
+	require.Equal([]string{
+		"stdout: hello",
+		"stderr: oops",
+		"stdout: world",
+		"stdout: unterminated",
+	}, readLines(t, path, logfile.ReadOptions{}))
+
+	require.Equal([]string{
+		"stdout: hello",
+		"stdout: world",
+		"stdout: unterminated",
+	}, readLines(t, path, logfile.ReadOptions{Streams: []string{logfile.Stdout}}))
+
+	require.Equal([]string{
+		"stdout: world",
+		"stdout: unterminated",
+	}, readLines(t, path, logfile.ReadOptions{Tail: 2}))
+
+	require.Empty(readLines(t, path, logfile.ReadOptions{Since: time.Now().Add(time.Minute)}))
+}
+
+func TestRotation(t *testing.T) {
+	require := require.New(t)
+	dir := t.TempDir()
+	path := filepath.Join(dir, "box.log")
+
+	// Every record is roughly 70 bytes, so each file holds two
+	w, err := logfile.NewWriter(path, 160, 2)
+	require.NoError(err)
+	stdout := w.Stream(logfile.Stdout)
+	for i := 0; i < 10; i++ {
+		_, err = fmt.Fprintf(stdout, "line %d\n", i)
+		require.NoError(err)
+	}
+	require.NoError(w.Close())
+
+	for _, file := range []string{"box.log", "box.log.1", "box.log.2"} {
+		info, err := os.Stat(filepath.Join(dir, file))
+		require.NoError(err)
+		require.LessOrEqual(info.Size(), int64(160))
+	}
+	_, err = os.Stat(filepath.Join(dir, "box.log.3"))
+	require.ErrorIs(err, os.ErrNotExist, "only maxFiles rotated files may be kept")
+
+	require.Equal([]string{
+		"stdout: line 4",
+		"stdout: line 5",
+		"stdout: line 6",
+		"stdout: line 7",
+		"stdout: line 8",
+		"stdout: line 9",
+	}, readLines(t, path, logfile.ReadOptions{}))
+}
+
+func TestFollow(t *testing.T) {
+	require := require.New(t)
+	path := filepath.Join(t.TempDir(), "box.log")
+
+	w, err := logfile.NewWriter(path, 200, 5)
+	require.NoError(err)
+	stdout := w.Stream(logfile.Stdout)
+	_, err = fmt.Fprint(stdout, "before\n")
+	require.NoError(err)
+
+	var done atomic.Bool
+	lines := make(chan string, 100)
+	result := make(chan error)
+	go func() {
+		result <- logfile.Read(path, logfile.ReadOptions{
+			Follow: true,
+			Done:   done.Load,
+		}, func(record logfile.Record) error {
+			lines <- record.Line
+			return nil
+		})
+	}()
+
+	require.Equal("before", <-lines)
+
+	// Enough lines to rotate while following
+	for i := 0; i < 8; i++ {
+		_, err = fmt.Fprintf(stdout, "after %d\n", i)
+		require.NoError(err)
+	}
+	for i := 0; i < 8; i++ {
+		select {
+		case line := <-lines:
+			require.Equal(fmt.Sprintf("after %d", i), line)
+		case <-time.After(2 * time.Second):
+			t.Fatalf("timed out waiting for line %d", i)
+		}
+	}
+
+	done.Store(true)
+	require.NoError(<-result)
+	require.NoError(w.Close())
+}
@@ -0,0 +1,255 @@
+package logfile
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"time"
+)
+
+type ReadOptions struct {
+	// Only records at or after Since
+	Since time.Time
+	// Only the last n records, 0 means all
+	Tail int
+	// Stdout and/or Stderr, empty means all streams
+	Streams []string
+
+	// Keep waiting for new records after reaching the end.
+	Follow bool
+	// Polled while following. Reading ends after the
+	// remaining records were read once it returns true.
+	Done func() bool
+}
+
+const pollInterval = 100 * time.Millisecond
+
+// Calls fn for every record of the log at path matching opt, oldest
+// first. A log that doesn’t exist (yet) is treated as empty.
+func Read(path string, opt ReadOptions, fn func(Record) error) error {
+	matches := func(record Record) bool {
+		if record.Time.Before(opt.Since) {
+			return false
+		}
+		return len(opt.Streams) == 0 || slices.Contains(opt.Streams, record.Stream)
+	}
+	emit := func(record Record) error {
+		if !matches(record) {
+			return nil
+		}
+		return fn(record)
+	}
+
+	// With a tail, existing records are only emitted
+	// once we know which ones are the last.
+	collect := emit
+	var tail []Record
+	if opt.Tail > 0 {
+		collect = func(record Record) error {
+			if matches(record) {
+				tail = append(tail, record)
+				if len(tail) > opt.Tail {
+					tail = tail[1:]
+				}
+			}
+			return nil
+		}
+	}
+
+	current, err := readRotated(path, collect)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if current != nil {
+			current.Close()
+		}
+	}()
+
+	for _, record := range tail {
+		err = fn(record)
+		if err != nil {
+			return err
+		}
+	}
+
+	if !opt.Follow {
+		return nil
+	}
+
+	for {
+		done := opt.Done != nil && opt.Done()
+
+		current, err = follow(path, current, emit)
+		if err != nil || done {
+			return err
+		}
+
+		time.Sleep(pollInterval)
+	}
+}
+
+// Reads all rotated files and the current one. Returns a reader
+// positioned at the end of the current file or nil if it doesn’t exist.
+func readRotated(path string, emit func(Record) error) (*recordReader, error) {
+	n := 1
+	for {
+		_, err := os.Stat(rotatedPath(path, n))
+		if err != nil {
+			break
+		}
+		n++
+	}
+	for n--; n > 0; n-- {
+		err := readFile(rotatedPath(path, n), emit)
+		if os.IsNotExist(err) {
+			// Rotated while we were reading
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	reader, err := openRecords(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = reader.readAll(emit)
+	if err != nil {
+		reader.Close()
+		return nil, err
+	}
+	return reader, nil
+}
+
+// Emits records appended to the current file since the last call.
+// If the file was rotated, the old one is read to its end before
+// switching to the new file.
+func follow(path string, current *recordReader, emit func(Record) error) (*recordReader, error) {
+	if current != nil {
+		err := current.readAll(emit)
+		if err != nil {
+			return current, err
+		}
+	}
+
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return current, nil
+	}
+	if err != nil {
+		return current, err
+	}
+	if current != nil && os.SameFile(info, current.info) {
+		return current, nil
+	}
+
+	if current != nil {
+		// Catch records written right before the rotation
+		err = current.readAll(emit)
+		current.Close()
+		if err != nil {
+			return nil, err
+		}
+		// The file may have been rotated more than once since the
+		// last poll, so read the files rotated after it first.
+		for n := rotatedIndex(path, current.info) - 1; n > 0; n-- {
+			err = readFile(rotatedPath(path, n), emit)
+			if err != nil && !os.IsNotExist(err) {
+				return nil, err
+			}
+		}
+	}
+
+	next, err := openRecords(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return next, next.readAll(emit)
+}
+
+// Returns n if path.n is the given file or 0 if it was removed.
+func rotatedIndex(path string, file os.FileInfo) int {
+	for n := 1; ; n++ {
+		info, err := os.Stat(rotatedPath(path, n))
+		if err != nil {
+			return 0
+		}
+		if os.SameFile(info, file) {
+			return n
+		}
+	}
+}
+
+func readFile(path string, emit func(Record) error) error {
+	reader, err := openRecords(path)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	return reader.readAll(emit)
+}
+
+type recordReader struct {
+	file    *os.File
+	info    os.FileInfo
+	reader  *bufio.Reader
+	partial []byte
+}
+
+func openRecords(path string) (*recordReader, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &recordReader{file: f, info: info, reader: bufio.NewReader(f)}, nil
+}
+
+// Emits all complete records up to the end of the file.
+// A trailing incomplete line is kept for the next call.
+func (self *recordReader) readAll(emit func(Record) error) error {
+	for {
+		line, err := self.reader.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			self.partial = append(self.partial, line...)
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if len(self.partial) > 0 {
+			line = append(self.partial, line...)
+			self.partial = nil
+		}
+
+		var record Record
+		err = json.Unmarshal(line, &record)
+		if err != nil {
+			return fmt.Errorf("parsing log record in %s: %w", self.file.Name(), err)
+		}
+		err = emit(record)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (self *recordReader) Close() error {
+	return self.file.Close()
+}
@@ -0,0 +1,174 @@
+// Package logfile stores the output of boxes as JSON lines in size
+// rotated files. The newest records are in the file at the given
+// path, older ones in path.1, path.2 and so on.
+package logfile
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	Stdout = "stdout"
+	Stderr = "stderr"
+)
+
+type Record struct {
+	Time   time.Time `json:"time"`
+	Stream string    `json:"stream"`
+	Line   string    `json:"log"`
+}
+
+type Writer struct {
+	path     string
+	maxSize  int64
+	maxFiles int
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+}
+
+// Opens the log at path for appending. Once the file would grow
+// beyond maxSize bytes, it is rotated. At most maxFiles rotated
+// files are kept.
+func NewWriter(path string, maxSize int64, maxFiles int) (*Writer, error) {
+	w := &Writer{path: path, maxSize: maxSize, maxFiles: maxFiles}
+	return w, w.open()
+}
+
+func (self *Writer) open() error {
+	f, err := os.OpenFile(self.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	self.file = f
+	self.size = info.Size()
+	return nil
+}
+
+func (self *Writer) write(record Record) error {
+	b, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	b = append(b, '\n')
+
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	if self.file == nil {
+		return os.ErrClosed
+	}
+	if self.size > 0 && self.size+int64(len(b)) > self.maxSize {
+		err = self.rotate()
+		if err != nil {
+			return fmt.Errorf("rotating %s: %w", self.path, err)
+		}
+	}
+
+	n, err := self.file.Write(b)
+	self.size += int64(n)
+	return err
+}
+
+func (self *Writer) rotate() error {
+	err := self.file.Close()
+	if err != nil {
+		return err
+	}
+	self.file = nil
+
+	if self.maxFiles > 0 {
+		err = os.Remove(rotatedPath(self.path, self.maxFiles))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		for i := self.maxFiles - 1; i > 0; i-- {
+			err = os.Rename(rotatedPath(self.path, i), rotatedPath(self.path, i+1))
+			if err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+		err = os.Rename(self.path, rotatedPath(self.path, 1))
+	} else {
+		err = os.Remove(self.path)
+	}
+	if err != nil {
+		return err
+	}
+
+	return self.open()
+}
+
+func (self *Writer) Close() error {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	if self.file == nil {
+		return nil
+	}
+	err := self.file.Close()
+	self.file = nil
+	return err
+}
+
+// Returns a writer that stores every line written to it as a
+// record of the given stream. Incomplete lines are buffered until
+// they are terminated or the stream is closed.
+func (self *Writer) Stream(stream string) io.WriteCloser {
+	return &streamWriter{log: self, stream: stream}
+}
+
+type streamWriter struct {
+	log    *Writer
+	stream string
+	buf    []byte
+}
+
+func (self *streamWriter) Write(p []byte) (int, error) {
+	self.buf = append(self.buf, p...)
+	for {
+		i := bytes.IndexByte(self.buf, '\n')
+		if i < 0 {
+			break
+		}
+		err := self.flush(self.buf[:i])
+		self.buf = self.buf[i+1:]
+		if err != nil {
+			return len(p), err
+		}
+	}
+	return len(p), nil
+}
+
+func (self *streamWriter) flush(line []byte) error {
+	return self.log.write(Record{
+		Time:   time.Now(),
+		Stream: self.stream,
+		Line:   string(line),
+	})
+}
+
+func (self *streamWriter) Close() error {
+	if len(self.buf) == 0 {
+		return nil
+	}
+	err := self.flush(self.buf)
+	self.buf = nil
+	return err
+}
+
+func rotatedPath(path string, n int) string {
+	return fmt.Sprintf("%s.%d", path, n)
+}
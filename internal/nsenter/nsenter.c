@@ -0,0 +1,123 @@
+#define _GNU_SOURCE
+#include <errno.h>
+#include <fcntl.h>
+#include <limits.h>
+#include <sched.h>
+#include <signal.h>
+#include <stdio.h>
+#include <stdlib.h>
+#include <string.h>
+#include <sys/wait.h>
+#include <unistd.h>
+
+#ifndef CLONE_NEWTIME
+#define CLONE_NEWTIME 0x00000080
+#endif
+
+// Runs before the Go runtime starts any threads, which is required
+// for setns(2) on user and mount namespaces. When FOXBOX_NSENTER is
+// set to the pid of a box process, the process joins all namespaces
+// of that box, changes its root to the box root and forks, so the
+// child is also part of the box's pid namespace. The child continues
+// into the Go runtime while the parent waits and forwards its exit
+// status.
+
+static void bail(const char *msg)
+{
+	fprintf(stderr, "foxbox nsenter: %s: %s\n", msg, strerror(errno));
+	exit(1);
+}
+
+static pid_t child_pid;
+
+static void forward_signal(int sig)
+{
+	if (child_pid > 0)
+		kill(child_pid, sig);
+}
+
+__attribute__((constructor)) static void foxbox_nsenter(void)
+{
+	const char *pid = getenv("FOXBOX_NSENTER");
+	if (pid == NULL || *pid == '\0')
+		return;
+
+	// The user namespace must come first to gain
+	// the capabilities needed to join the others.
+	const struct {
+		const char *name;
+		int type;
+	} namespaces[] = {
+		{"user", CLONE_NEWUSER},
+		{"mnt", CLONE_NEWNS},
+		{"pid", CLONE_NEWPID},
+		{"uts", CLONE_NEWUTS},
+		{"ipc", CLONE_NEWIPC},
+		{"net", CLONE_NEWNET},
+		{"cgroup", CLONE_NEWCGROUP},
+		{"time", CLONE_NEWTIME},
+	};
+	const int count = sizeof(namespaces) / sizeof(namespaces[0]);
+	int fds[sizeof(namespaces) / sizeof(namespaces[0])];
+	char path[PATH_MAX];
+
+	// Open everything upfront because /proc
+	// looks different after joining the mount namespace.
+	snprintf(path, sizeof(path), "/proc/%s/root", pid);
+	int root = open(path, O_RDONLY | O_DIRECTORY | O_CLOEXEC);
+	if (root < 0)
+		bail("opening box root");
+
+	for (int i = 0; i < count; i++) {
+		snprintf(path, sizeof(path), "/proc/%s/ns/%s", pid, namespaces[i].name);
+		fds[i] = open(path, O_RDONLY | O_CLOEXEC);
+		if (fds[i] < 0 && !(errno == ENOENT && namespaces[i].type == CLONE_NEWTIME))
+			bail(path);
+	}
+
+	for (int i = 0; i < count; i++) {
+		if (fds[i] < 0)
+			continue;
+		if (setns(fds[i], namespaces[i].type) < 0)
+			bail(namespaces[i].name);
+		close(fds[i]);
+	}
+
+	if (fchdir(root) < 0)
+		bail("entering box root");
+	if (chroot(".") < 0)
+		bail("changing root");
+	if (chdir("/") < 0)
+		bail("changing directory");
+	close(root);
+
+	child_pid = fork();
+	if (child_pid < 0)
+		bail("forking into pid namespace");
+	if (child_pid == 0)
+		return;
+
+	// Keyboard interrupts already reach the child
+	// because it shares our process group.
+	signal(SIGINT, SIG_IGN);
+	signal(SIGQUIT, SIG_IGN);
+
+	struct sigaction action = {0};
+	action.sa_handler = forward_signal;
+	const int forwarded[] = {SIGTERM, SIGHUP, SIGUSR1, SIGUSR2, SIGWINCH};
+	for (size_t i = 0; i < sizeof(forwarded) / sizeof(forwarded[0]); i++)
+		sigaction(forwarded[i], &action, NULL);
+
+	int status;
+	while (waitpid(child_pid, &status, 0) < 0) {
+		if (errno != EINTR)
+			bail("waiting for child");
+	}
+
+	if (WIFSIGNALED(status)) {
+		signal(WTERMSIG(status), SIG_DFL);
+		kill(getpid(), WTERMSIG(status));
+		exit(128 + WTERMSIG(status));
+	}
+	exit(WEXITSTATUS(status));
+}
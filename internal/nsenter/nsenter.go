@@ -0,0 +1,10 @@
+// Package nsenter joins the namespaces of a running box. Importing
+// it links a constructor that runs before the Go runtime starts,
+// see nsenter.c for details.
+package nsenter
+
+// #cgo CFLAGS: -Wall
+import "C"
+
+// Environment variable holding the host pid of the box to enter.
+const EnvPID = "FOXBOX_NSENTER"
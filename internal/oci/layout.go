@@ -0,0 +1,283 @@
+package oci
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"runtime"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// Loads the image tagged ref from a directory containing an OCI image
+// layout (index.json) or an extracted docker save archive
+// (manifest.json). ref may be empty if there is only one image.
+func Load(dir, ref string) (*Source, error) {
+	root, err := unix.Open(dir, unix.O_PATH|unix.O_DIRECTORY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, fmt.Errorf("opening %s: %w", dir, err)
+	}
+	d := &layoutDir{root: os.NewFile(uintptr(root), dir)}
+
+	var source *Source
+	if _, err = d.stat("index.json"); err == nil {
+		source, err = d.loadOCI(ref)
+	} else if _, err = d.stat("manifest.json"); err == nil {
+		source, err = d.loadDocker(ref)
+	} else {
+		err = fmt.Errorf("%s contains neither an OCI image layout nor a docker save archive", dir)
+	}
+	if err != nil {
+		d.root.Close()
+		return nil, err
+	}
+	source.root = d.root
+	return source, nil
+}
+
+// Files are opened relative to the layout directory, so symlinks
+// in untrusted archives can’t be used to read host files.
+type layoutDir struct {
+	root *os.File
+}
+
+func (self *layoutDir) open(name string) (*os.File, error) {
+	fd, err := unix.Openat2(int(self.root.Fd()), name, &unix.OpenHow{
+		Flags:   unix.O_RDONLY | unix.O_CLOEXEC,
+		Resolve: unix.RESOLVE_IN_ROOT | unix.RESOLVE_NO_MAGICLINKS,
+	})
+	if err != nil {
+		return nil, &os.PathError{Op: "open", Path: name, Err: err}
+	}
+	return os.NewFile(uintptr(fd), name), nil
+}
+
+func (self *layoutDir) stat(name string) (os.FileInfo, error) {
+	f, err := self.open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return f.Stat()
+}
+
+// Reads a JSON file, verifying its digest unless it is empty.
+func (self *layoutDir) readJSON(name, digest string, v any) error {
+	f, err := self.open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	var r io.Reader = f
+	if digest != "" {
+		r = Verify(f, digest)
+	}
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return fmt.Errorf("reading %s: %w", name, err)
+	}
+	err = json.Unmarshal(b, v)
+	if err != nil {
+		return fmt.Errorf("parsing %s: %w", name, err)
+	}
+	return nil
+}
+
+// Opens name lazily and verifies it against digest unless it is empty.
+func (self *layoutDir) opener(name, digest string) func() (io.ReadCloser, error) {
+	return func() (io.ReadCloser, error) {
+		f, err := self.open(name)
+		if err != nil || digest == "" {
+			return f, err
+		}
+		return struct {
+			io.Reader
+			io.Closer
+		}{Verify(f, digest), f}, nil
+	}
+}
+
+func blobPath(digest string) (string, error) {
+	err := ValidateDigest(digest)
+	if err != nil {
+		return "", err
+	}
+	return path.Join("blobs", "sha256", strings.TrimPrefix(digest, "sha256:")), nil
+}
+
+func (self *layoutDir) readBlob(digest string, v any) error {
+	name, err := blobPath(digest)
+	if err != nil {
+		return err
+	}
+	return self.readJSON(name, digest, v)
+}
+
+func (self *layoutDir) loadOCI(ref string) (*Source, error) {
+	var index Index
+	err := self.readJSON("index.json", "", &index)
+	if err != nil {
+		return nil, err
+	}
+
+	var candidates []Descriptor
+	for _, desc := range index.Manifests {
+		if ref == "" || matchesRef(desc, ref) {
+			candidates = append(candidates, desc)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil, fmt.Errorf("no image tagged %s in index.json", ref)
+	}
+	if ref == "" && !sameRef(candidates) {
+		return nil, errors.New("index.json contains multiple images, a tag is needed")
+	}
+
+	manifest, err := self.resolveManifest(candidates, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	var image Image
+	err = self.readBlob(manifest.Config.Digest, &image)
+	if err != nil {
+		return nil, fmt.Errorf("reading image config: %w", err)
+	}
+	if len(image.RootFS.DiffIDs) != len(manifest.Layers) {
+		return nil, fmt.Errorf("image config lists %d layers, manifest %d", len(image.RootFS.DiffIDs), len(manifest.Layers))
+	}
+
+	source := &Source{Config: image.Config}
+	for i, layer := range manifest.Layers {
+		name, err := blobPath(layer.Digest)
+		if err != nil {
+			return nil, err
+		}
+		source.Layers = append(source.Layers, Layer{
+			Open:   self.opener(name, layer.Digest),
+			DiffID: image.RootFS.DiffIDs[i],
+		})
+	}
+	return source, nil
+}
+
+func matchesRef(desc Descriptor, ref string) bool {
+	tag := desc.Annotations[AnnotationRefName]
+	name := desc.Annotations[AnnotationImageName]
+	return ref == tag || ref == name || (name != "" && strings.HasSuffix(name, "/"+ref))
+}
+
+// Whether all descriptors are tagged the same, e.g. manifests
+// of one image for different platforms.
+func sameRef(descs []Descriptor) bool {
+	for _, desc := range descs[1:] {
+		if desc.Annotations[AnnotationRefName] != descs[0].Annotations[AnnotationRefName] {
+			return false
+		}
+	}
+	return true
+}
+
+// Limits nested indexes
+const maxIndexDepth = 4
+
+func (self *layoutDir) resolveManifest(descs []Descriptor, depth int) (*Manifest, error) {
+	if depth > maxIndexDepth {
+		return nil, errors.New("too many nested indexes")
+	}
+
+	var errs []error
+	for _, desc := range descs {
+		if desc.Platform != nil && !desc.Platform.matches() {
+			continue
+		}
+		switch desc.MediaType {
+		case MediaTypeManifest, MediaTypeDockerManifest:
+			var manifest Manifest
+			err := self.readBlob(desc.Digest, &manifest)
+			if err != nil {
+				return nil, fmt.Errorf("reading manifest: %w", err)
+			}
+			return &manifest, nil
+		case MediaTypeIndex, MediaTypeDockerList:
+			var index Index
+			err := self.readBlob(desc.Digest, &index)
+			if err != nil {
+				return nil, fmt.Errorf("reading index: %w", err)
+			}
+			manifest, err := self.resolveManifest(index.Manifests, depth+1)
+			if err == nil {
+				return manifest, nil
+			}
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return nil, fmt.Errorf("no image for %s/%s", runtime.GOOS, runtime.GOARCH)
+}
+
+// An entry of manifest.json in docker save archives.
+type dockerManifest struct {
+	Config   string
+	RepoTags []string
+	Layers   []string
+}
+
+func (self *layoutDir) loadDocker(ref string) (*Source, error) {
+	var manifests []dockerManifest
+	err := self.readJSON("manifest.json", "", &manifests)
+	if err != nil {
+		return nil, err
+	}
+
+	var manifest *dockerManifest
+	for i := range manifests {
+		if ref == "" || matchesRepoTag(manifests[i].RepoTags, ref) {
+			manifest = &manifests[i]
+			break
+		}
+	}
+	if manifest == nil || (ref == "" && len(manifests) > 1) {
+		return nil, fmt.Errorf("no image tagged %q in manifest.json, archives with multiple images need a tag", ref)
+	}
+
+	// Named after their digest, either <hex>.json or blobs/sha256/<hex>
+	digest := "sha256:" + strings.TrimSuffix(path.Base(manifest.Config), ".json")
+	if ValidateDigest(digest) != nil {
+		digest = ""
+	}
+	var image Image
+	err = self.readJSON(manifest.Config, digest, &image)
+	if err != nil {
+		return nil, fmt.Errorf("reading image config: %w", err)
+	}
+	if len(image.RootFS.DiffIDs) != len(manifest.Layers) {
+		return nil, fmt.Errorf("image config lists %d layers, manifest.json %d", len(image.RootFS.DiffIDs), len(manifest.Layers))
+	}
+
+	source := &Source{Config: image.Config}
+	for i, layer := range manifest.Layers {
+		source.Layers = append(source.Layers, Layer{
+			// Verified through the diff id after decompression
+			Open:   self.opener(layer, ""),
+			DiffID: image.RootFS.DiffIDs[i],
+		})
+	}
+	return source, nil
+}
+
+// Matches e.g. docker.io/library/alpine:3.18 for alpine:3.18 or 3.18.
+func matchesRepoTag(tags []string, ref string) bool {
+	for _, tag := range tags {
+		if tag == ref || strings.HasSuffix(tag, "/"+ref) || strings.HasSuffix(tag, ":"+ref) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,135 @@
+// Package oci reads images from OCI image layouts and docker save
+// archives and flattens their layers into a single root file system.
+package oci
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"regexp"
+	"runtime"
+)
+
+const (
+	MediaTypeIndex          = "application/vnd.oci.image.index.v1+json"
+	MediaTypeManifest       = "application/vnd.oci.image.manifest.v1+json"
+	MediaTypeDockerList     = "application/vnd.docker.distribution.manifest.list.v2+json"
+	MediaTypeDockerManifest = "application/vnd.docker.distribution.manifest.v2+json"
+
+	// Tag of an image in an index, e.g. 3.18
+	AnnotationRefName = "org.opencontainers.image.ref.name"
+	// Full name of an image in an index written by docker or
+	// containerd, e.g. docker.io/library/alpine:3.18
+	AnnotationImageName = "io.containerd.image.name"
+)
+
+type Descriptor struct {
+	MediaType   string            `json:"mediaType"`
+	Digest      string            `json:"digest"`
+	Size        int64             `json:"size"`
+	Platform    *Platform         `json:"platform,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+type Platform struct {
+	Architecture string `json:"architecture"`
+	OS           string `json:"os"`
+	Variant      string `json:"variant,omitempty"`
+}
+
+func (self Platform) matches() bool {
+	return self.OS == runtime.GOOS && self.Architecture == runtime.GOARCH
+}
+
+// Also used for docker manifest lists.
+type Index struct {
+	MediaType string       `json:"mediaType,omitempty"`
+	Manifests []Descriptor `json:"manifests"`
+}
+
+type Manifest struct {
+	MediaType string       `json:"mediaType,omitempty"`
+	Config    Descriptor   `json:"config"`
+	Layers    []Descriptor `json:"layers"`
+}
+
+type Image struct {
+	Architecture string      `json:"architecture"`
+	OS           string      `json:"os"`
+	Config       ImageConfig `json:"config"`
+	RootFS       RootFS      `json:"rootfs"`
+}
+
+// The parts of the image config foxbox uses.
+type ImageConfig struct {
+	User       string   `json:"User,omitempty"`
+	Env        []string `json:"Env,omitempty"`
+	Entrypoint []string `json:"Entrypoint,omitempty"`
+	Cmd        []string `json:"Cmd,omitempty"`
+	WorkingDir string   `json:"WorkingDir,omitempty"`
+}
+
+type RootFS struct {
+	Type string `json:"type"`
+	// Digests of the uncompressed layers
+	DiffIDs []string `json:"diff_ids"`
+}
+
+var digestPattern = regexp.MustCompile(`^sha256:[0-9a-f]{64}$`)
+
+// Only sha256 digests are supported.
+func ValidateDigest(digest string) error {
+	if !digestPattern.MatchString(digest) {
+		return fmt.Errorf("unsupported digest %q", digest)
+	}
+	return nil
+}
+
+// Returns a reader that fails at EOF if the content read
+// through it doesn’t match the digest.
+func Verify(r io.Reader, digest string) io.Reader {
+	return &verifier{r: r, expected: digest, hash: sha256.New()}
+}
+
+type verifier struct {
+	r        io.Reader
+	expected string
+	hash     hash.Hash
+}
+
+func (self *verifier) Read(p []byte) (int, error) {
+	n, err := self.r.Read(p)
+	self.hash.Write(p[:n])
+	if errors.Is(err, io.EOF) {
+		actual := fmt.Sprintf("sha256:%x", self.hash.Sum(nil))
+		if actual != self.expected {
+			return n, fmt.Errorf("digest mismatch: expected %s, got %s", self.expected, actual)
+		}
+	}
+	return n, err
+}
+
+// An image ready to be unpacked.
+type Source struct {
+	Config ImageConfig
+	Layers []Layer
+	root   *os.File
+}
+
+func (self *Source) Close() error {
+	if self.root == nil {
+		return nil
+	}
+	return self.root.Close()
+}
+
+type Layer struct {
+	// Opens the (possibly compressed) layer tarball.
+	// Its digest is verified while reading it.
+	Open func() (io.ReadCloser, error)
+	// Digest of the uncompressed layer, empty if unknown
+	DiffID string
+}
@@ -0,0 +1,94 @@
+package oci
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+)
+
+// A reference to an image in an OCI distribution registry,
+// e.g. docker.io/library/alpine:3.18 or ghcr.io/owner/image@sha256:…
+type Reference struct {
+	// Registry host as written, e.g. docker.io or localhost:5000
+	Domain     string
+	Repository string
+	// Empty if the image is referenced by digest
+	Tag    string
+	Digest string
+}
+
+const DefaultTag = "latest"
+
+var repositoryPattern = regexp.MustCompile(`^[a-z0-9]+(?:(?:[._]|__|-+)[a-z0-9]+)*(?:/[a-z0-9]+(?:(?:[._]|__|-+)[a-z0-9]+)*)*$`)
+var tagPattern = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_.-]{0,127}$`)
+
+// Whether ref names a registry, which distinguishes references like
+// docker.io/library/alpine:3.18 from images of the JSON registry.
+// Like docker, the first component is a registry if it contains a dot
+// or port or is localhost.
+func IsReference(ref string) bool {
+	domain, _, found := strings.Cut(ref, "/")
+	return found && (strings.ContainsAny(domain, ".:") || domain == "localhost")
+}
+
+func ParseReference(ref string) (Reference, error) {
+	invalid := fmt.Errorf("invalid image reference %q: use registry/repository[:tag|@digest]", ref)
+	if !IsReference(ref) {
+		return Reference{}, invalid
+	}
+	domain, rest, _ := strings.Cut(ref, "/")
+	parsed := Reference{Domain: domain}
+
+	if repository, digest, found := strings.Cut(rest, "@"); found {
+		err := ValidateDigest(digest)
+		if err != nil {
+			return Reference{}, fmt.Errorf("%w: %w", invalid, err)
+		}
+		parsed.Repository, parsed.Digest = repository, digest
+	} else {
+		parsed.Repository, parsed.Tag = rest, DefaultTag
+		if i := strings.LastIndex(rest, ":"); i > strings.LastIndex(rest, "/") {
+			parsed.Repository, parsed.Tag = rest[:i], rest[i+1:]
+		}
+		if !tagPattern.MatchString(parsed.Tag) {
+			return Reference{}, invalid
+		}
+	}
+	if !repositoryPattern.MatchString(parsed.Repository) {
+		return Reference{}, invalid
+	}
+	return parsed, nil
+}
+
+// The reference as written with the default tag if it had none.
+func (self Reference) String() string {
+	if self.Digest != "" {
+		return self.Domain + "/" + self.Repository + "@" + self.Digest
+	}
+	return self.Domain + "/" + self.Repository + ":" + self.Tag
+}
+
+// Returns the base URL of the registry API. Registries on loopback
+// addresses are accessed with plain HTTP, everything else with HTTPS.
+func (self Reference) endpoint() string {
+	if self.Domain == "docker.io" || self.Domain == "index.docker.io" {
+		return "https://registry-1.docker.io"
+	}
+	host, _, err := net.SplitHostPort(self.Domain)
+	if err != nil {
+		host = self.Domain
+	}
+	if ip := net.ParseIP(host); host == "localhost" || (ip != nil && ip.IsLoopback()) {
+		return "http://" + self.Domain
+	}
+	return "https://" + self.Domain
+}
+
+// Official images on Docker Hub are in the library namespace.
+func (self Reference) repository() string {
+	if (self.Domain == "docker.io" || self.Domain == "index.docker.io") && !strings.Contains(self.Repository, "/") {
+		return "library/" + self.Repository
+	}
+	return self.Repository
+}
@@ -0,0 +1,38 @@
+package oci_test
+
+import (
+	"testing"
+
+	"github.com/codingpa-ws/foxbox/internal/oci"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseReference(t *testing.T) {
+	digest := "sha256:" + "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+	valid := map[string]oci.Reference{
+		"docker.io/library/alpine:3.18": {Domain: "docker.io", Repository: "library/alpine", Tag: "3.18"},
+		"docker.io/alpine":              {Domain: "docker.io", Repository: "alpine", Tag: "latest"},
+		"localhost:5000/fox/tiny":       {Domain: "localhost:5000", Repository: "fox/tiny", Tag: "latest"},
+		"localhost/tiny:1.0":            {Domain: "localhost", Repository: "tiny", Tag: "1.0"},
+		"ghcr.io/fox/tiny@" + digest:    {Domain: "ghcr.io", Repository: "fox/tiny", Digest: digest},
+	}
+	for ref, expected := range valid {
+		parsed, err := oci.ParseReference(ref)
+		require.NoError(t, err, ref)
+		require.Equal(t, expected, parsed, ref)
+	}
+
+	invalid := []string{
+		"alpine:3.18",
+		"alpine/tiny",
+		"docker.io/Alpine",
+		"docker.io/alpine:",
+		"docker.io/alpine:3.18/x",
+		"docker.io/alpine@sha256:abc",
+		"docker.io/../alpine",
+	}
+	for _, ref := range invalid {
+		_, err := oci.ParseReference(ref)
+		require.Error(t, err, ref)
+	}
+}
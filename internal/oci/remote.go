@@ -0,0 +1,361 @@
+package oci
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// Limits manifests and configs read into memory
+const maxMetadataSize = 16 << 20
+
+var manifestMediaTypes = []string{
+	MediaTypeIndex,
+	MediaTypeManifest,
+	MediaTypeDockerList,
+	MediaTypeDockerManifest,
+}
+
+// A repository in an OCI distribution registry.
+// Only anonymous token authentication is supported.
+type Remote struct {
+	ref    Reference
+	base   string
+	client *http.Client
+	token  string
+}
+
+func NewRemote(ref Reference) *Remote {
+	return &Remote{
+		ref:    ref,
+		base:   ref.endpoint() + "/v2/" + ref.repository(),
+		client: http.DefaultClient,
+	}
+}
+
+// Resolves the image for the current platform and downloads its
+// layers to dir. Downloads interrupted before are resumed, and
+// every layer is verified against its digest.
+func (self *Remote) Pull(dir string) (*Source, error) {
+	manifest, err := self.resolve()
+	if err != nil {
+		return nil, err
+	}
+
+	var image Image
+	err = self.readBlob(manifest.Config.Digest, &image)
+	if err != nil {
+		return nil, fmt.Errorf("reading image config: %w", err)
+	}
+	if len(image.RootFS.DiffIDs) != len(manifest.Layers) {
+		return nil, fmt.Errorf("image config lists %d layers, manifest %d", len(image.RootFS.DiffIDs), len(manifest.Layers))
+	}
+
+	source := &Source{Config: image.Config}
+	for i, layer := range manifest.Layers {
+		path, err := self.download(layer.Digest, dir)
+		if err != nil {
+			return nil, fmt.Errorf("downloading layer %s: %w", layer.Digest, err)
+		}
+		source.Layers = append(source.Layers, Layer{
+			// Already verified by download
+			Open: func() (io.ReadCloser, error) {
+				return os.Open(path)
+			},
+			DiffID: image.RootFS.DiffIDs[i],
+		})
+	}
+	return source, nil
+}
+
+// Returns the manifest for the current platform.
+func (self *Remote) resolve() (*Manifest, error) {
+	reference, digest := self.ref.Tag, self.ref.Digest
+	if digest != "" {
+		reference = digest
+	}
+
+	for depth := 0; depth <= maxIndexDepth; depth++ {
+		mediaType, body, err := self.fetchManifest(reference, digest)
+		if err != nil {
+			return nil, err
+		}
+
+		switch mediaType {
+		case MediaTypeManifest, MediaTypeDockerManifest:
+			var manifest Manifest
+			err = json.Unmarshal(body, &manifest)
+			if err != nil {
+				return nil, fmt.Errorf("parsing manifest: %w", err)
+			}
+			return &manifest, nil
+		case MediaTypeIndex, MediaTypeDockerList:
+			var index Index
+			err = json.Unmarshal(body, &index)
+			if err != nil {
+				return nil, fmt.Errorf("parsing index: %w", err)
+			}
+			digest = ""
+			for _, desc := range index.Manifests {
+				if desc.Platform != nil && desc.Platform.matches() {
+					digest = desc.Digest
+					break
+				}
+			}
+			if digest == "" {
+				return nil, fmt.Errorf("%s has no image for %s/%s", self.ref, runtime.GOOS, runtime.GOARCH)
+			}
+			reference = digest
+		default:
+			return nil, fmt.Errorf("unsupported manifest type %q", mediaType)
+		}
+	}
+	return nil, errors.New("too many nested indexes")
+}
+
+// Fetches a manifest by tag or digest. It is verified against
+// digest or, if that is empty, the digest the registry reports.
+func (self *Remote) fetchManifest(reference, digest string) (mediaType string, body []byte, err error) {
+	req, err := http.NewRequest(http.MethodGet, self.base+"/manifests/"+reference, nil)
+	if err != nil {
+		return
+	}
+	req.Header.Set("Accept", strings.Join(manifestMediaTypes, ", "))
+	resp, err := self.do(req)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", nil, fmt.Errorf("fetching manifest %s of %s: %w", reference, self.ref, statusError(resp))
+	}
+
+	if digest == "" {
+		digest = resp.Header.Get("Docker-Content-Digest")
+	}
+	var r io.Reader = io.LimitReader(resp.Body, maxMetadataSize)
+	if digest != "" {
+		err = ValidateDigest(digest)
+		if err != nil {
+			return
+		}
+		r = Verify(r, digest)
+	}
+	body, err = io.ReadAll(r)
+	if err != nil {
+		return "", nil, fmt.Errorf("reading manifest %s of %s: %w", reference, self.ref, err)
+	}
+
+	// The media type of the body takes precedence over the header
+	var typed struct {
+		MediaType string `json:"mediaType"`
+	}
+	_ = json.Unmarshal(body, &typed)
+	mediaType = typed.MediaType
+	if mediaType == "" {
+		mediaType, _, _ = strings.Cut(resp.Header.Get("Content-Type"), ";")
+	}
+	return
+}
+
+func (self *Remote) readBlob(digest string, v any) error {
+	err := ValidateDigest(digest)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodGet, self.base+"/blobs/"+digest, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := self.do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return statusError(resp)
+	}
+	b, err := io.ReadAll(Verify(io.LimitReader(resp.Body, maxMetadataSize), digest))
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+// Downloads a blob to dir/<hex>, resuming a partial download
+// in dir/<hex>.partial, and returns its path.
+func (self *Remote) download(digest, dir string) (path string, err error) {
+	err = ValidateDigest(digest)
+	if err != nil {
+		return
+	}
+	path = filepath.Join(dir, strings.TrimPrefix(digest, "sha256:"))
+	_, err = os.Stat(path)
+	if err == nil || !os.IsNotExist(err) {
+		return
+	}
+
+	partial := path + ".partial"
+	f, err := os.OpenFile(partial, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	offset, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return
+	}
+
+	req, err := http.NewRequest(http.MethodGet, self.base+"/blobs/"+digest, nil)
+	if err != nil {
+		return
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+	resp, err := self.do(req)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+
+	var body io.Reader = resp.Body
+	switch {
+	case resp.StatusCode == http.StatusPartialContent && strings.HasPrefix(resp.Header.Get("Content-Range"), fmt.Sprintf("bytes %d-", offset)):
+	case resp.StatusCode == http.StatusRequestedRangeNotSatisfiable && offset > 0:
+		// Downloaded completely before, but not verified yet
+		body = http.NoBody
+	case resp.StatusCode == http.StatusOK:
+		// The registry doesn’t support ranges
+		err = f.Truncate(0)
+		if err == nil {
+			_, err = f.Seek(0, io.SeekStart)
+		}
+		if err != nil {
+			return
+		}
+	default:
+		return "", statusError(resp)
+	}
+
+	_, err = io.Copy(f, body)
+	if err != nil {
+		// Kept to be resumed
+		return "", err
+	}
+
+	_, err = f.Seek(0, io.SeekStart)
+	if err != nil {
+		return
+	}
+	hash := sha256.New()
+	_, err = io.Copy(hash, f)
+	if err != nil {
+		return
+	}
+	actual := fmt.Sprintf("sha256:%x", hash.Sum(nil))
+	if actual != digest {
+		os.Remove(partial)
+		return "", fmt.Errorf("digest mismatch: expected %s, got %s", digest, actual)
+	}
+	return path, os.Rename(partial, path)
+}
+
+// Sends the request, authenticating with a token if the registry asks
+// for one. Only requests without body are supported.
+func (self *Remote) do(req *http.Request) (*http.Response, error) {
+	if self.token != "" {
+		req.Header.Set("Authorization", "Bearer "+self.token)
+	}
+	resp, err := self.client.Do(req)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized || self.token != "" {
+		return resp, err
+	}
+
+	challenge := resp.Header.Get("WWW-Authenticate")
+	resp.Body.Close()
+	self.token, err = self.fetchToken(challenge)
+	if err != nil {
+		return nil, fmt.Errorf("authenticating to %s: %w", self.ref.Domain, err)
+	}
+	req.Header.Set("Authorization", "Bearer "+self.token)
+	return self.client.Do(req)
+}
+
+// Requests an anonymous pull token as described by
+// https://distribution.github.io/distribution/spec/auth/token/
+func (self *Remote) fetchToken(challenge string) (string, error) {
+	scheme, params, _ := strings.Cut(challenge, " ")
+	if !strings.EqualFold(scheme, "Bearer") {
+		return "", fmt.Errorf("unsupported authentication scheme %q", scheme)
+	}
+	values := parseChallenge(params)
+	realm, err := url.Parse(values["realm"])
+	if err != nil || (realm.Scheme != "https" && realm.Scheme != "http") {
+		return "", fmt.Errorf("invalid token realm %q", values["realm"])
+	}
+
+	query := realm.Query()
+	if service := values["service"]; service != "" {
+		query.Set("service", service)
+	}
+	scope := values["scope"]
+	if scope == "" {
+		scope = "repository:" + self.ref.repository() + ":pull"
+	}
+	query.Set("scope", scope)
+	realm.RawQuery = query.Encode()
+
+	resp, err := self.client.Get(realm.String())
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", statusError(resp)
+	}
+	var token struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	err = json.NewDecoder(io.LimitReader(resp.Body, maxMetadataSize)).Decode(&token)
+	if err != nil {
+		return "", fmt.Errorf("parsing token: %w", err)
+	}
+	if token.Token == "" {
+		token.Token = token.AccessToken
+	}
+	if token.Token == "" {
+		return "", errors.New("registry returned no token")
+	}
+	return token.Token, nil
+}
+
+// Parses the parameters of a WWW-Authenticate header,
+// e.g. realm="https://auth.docker.io/token",service="registry.docker.io"
+func parseChallenge(params string) map[string]string {
+	values := map[string]string{}
+	for params != "" {
+		var key, value string
+		key, params, _ = strings.Cut(strings.TrimLeft(params, " ,"), "=")
+		if strings.HasPrefix(params, `"`) {
+			value, params, _ = strings.Cut(params[1:], `"`)
+		} else {
+			value, params, _ = strings.Cut(params, ",")
+		}
+		values[strings.ToLower(strings.TrimSpace(key))] = value
+	}
+	return values
+}
+
+func statusError(resp *http.Response) error {
+	return fmt.Errorf("unexpected status %s", resp.Status)
+}
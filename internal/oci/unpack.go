@@ -0,0 +1,81 @@
+package oci
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/codingpa-ws/foxbox/internal/archive"
+	"github.com/klauspost/compress/zstd"
+	"github.com/klauspost/pgzip"
+)
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// Applies the layers of the image in order to the directory root.
+// Fails if a layer doesn’t match its digest.
+func (self *Source) Unpack(root string) error {
+	for i, layer := range self.Layers {
+		err := unpackLayer(layer, root)
+		if err != nil {
+			return fmt.Errorf("layer %d: %w", i+1, err)
+		}
+	}
+	return nil
+}
+
+func unpackLayer(layer Layer, root string) error {
+	f, err := layer.Open()
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	buffered := bufio.NewReader(f)
+	magic, err := buffered.Peek(len(zstdMagic))
+	if err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+	var r io.Reader = buffered
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		gz, err := pgzip.NewReader(buffered)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		r = gz
+	case bytes.HasPrefix(magic, zstdMagic):
+		decoder, err := zstd.NewReader(buffered)
+		if err != nil {
+			return err
+		}
+		defer decoder.Close()
+		r = decoder
+	}
+	if layer.DiffID != "" {
+		err = ValidateDigest(layer.DiffID)
+		if err != nil {
+			return err
+		}
+		r = Verify(r, layer.DiffID)
+	}
+
+	err = archive.ExtractLayer(r, root)
+	if err != nil {
+		return err
+	}
+	// Digests are only checked at EOF, which the tar
+	// reader doesn’t reach because of trailing padding
+	_, err = io.Copy(io.Discard, r)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(io.Discard, buffered)
+	return err
+}
@@ -0,0 +1,147 @@
+// Package registry reads the JSON image registry described
+// by registry.schema.json in the repository root.
+package registry
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+)
+
+// Used unless FOXBOX_REGISTRY is set.
+const DefaultURL = "https://raw.githubusercontent.com/codingpa-ws/foxbox/main/registry.json"
+
+const DefaultTag = "latest"
+
+type Registry struct {
+	Images []Image `json:"images"`
+
+	// URL the registry was fetched from, relative
+	// rootfs URLs are resolved against it.
+	base *url.URL
+}
+
+type Image struct {
+	Name     string    `json:"name"`
+	Versions []Version `json:"versions"`
+}
+
+type Version struct {
+	Tags   []string `json:"tags"`
+	Arch   string   `json:"arch"`
+	RootFS RootFS   `json:"rootfs"`
+}
+
+type RootFS struct {
+	URL    string `json:"url"`
+	SHA256 string `json:"sha256"`
+}
+
+// Returns whether the rootfs is a gzipped tarball.
+func (self RootFS) Gzipped() bool {
+	return strings.HasSuffix(self.URL, ".gz")
+}
+
+// Returns FOXBOX_REGISTRY or DefaultURL.
+func URL() string {
+	if registry := os.Getenv("FOXBOX_REGISTRY"); registry != "" {
+		return registry
+	}
+	return DefaultURL
+}
+
+// Splits an image reference like alpine:3.18 into name and
+// tag. The tag defaults to DefaultTag.
+func ParseRef(ref string) (name, tag string, err error) {
+	name, tag, found := strings.Cut(ref, ":")
+	if name == "" || (found && tag == "") || strings.ContainsAny(tag, ":/") {
+		return "", "", fmt.Errorf("invalid image reference %q: use name or name:tag", ref)
+	}
+	if !found {
+		tag = DefaultTag
+	}
+	return name, tag, nil
+}
+
+// Loads the registry from an http(s) or file URL.
+func Fetch(rawURL string) (*Registry, error) {
+	base, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("parsing registry url: %w", err)
+	}
+
+	body, err := Open(base.String())
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	registry := &Registry{base: base}
+	err = json.NewDecoder(body).Decode(registry)
+	if err != nil {
+		return nil, fmt.Errorf("decoding registry %s: %w", rawURL, err)
+	}
+	return registry, nil
+}
+
+// Finds the version of an image with the given tag and arch.
+func (self Registry) Resolve(name, tag, arch string) (*Version, error) {
+	found := false
+	for _, image := range self.Images {
+		if image.Name != name {
+			continue
+		}
+		found = true
+		for _, version := range image.Versions {
+			if version.Arch == arch && slices.Contains(version.Tags, tag) {
+				return &version, nil
+			}
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("image %s not found in registry", name)
+	}
+	return nil, fmt.Errorf("image %s has no tag %s for %s", name, tag, arch)
+}
+
+// Returns the absolute URL of the version’s rootfs.
+func (self Registry) RootFSURL(version *Version) (string, error) {
+	ref, err := url.Parse(version.RootFS.URL)
+	if err != nil {
+		return "", fmt.Errorf("parsing rootfs url: %w", err)
+	}
+	if self.base != nil {
+		ref = self.base.ResolveReference(ref)
+	}
+	return ref.String(), nil
+}
+
+// Opens an http(s) or file URL for reading.
+func Open(rawURL string) (io.ReadCloser, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+
+	switch u.Scheme {
+	case "file":
+		return os.Open(u.Path)
+	case "http", "https":
+		res, err := http.Get(u.String())
+		if err != nil {
+			return nil, fmt.Errorf("requesting %s: %w", rawURL, err)
+		}
+		if res.StatusCode != http.StatusOK {
+			res.Body.Close()
+			return nil, fmt.Errorf("requesting %s: %s", rawURL, res.Status)
+		}
+		return res.Body, nil
+	default:
+		return nil, fmt.Errorf("unsupported url scheme %q in %s", u.Scheme, rawURL)
+	}
+}
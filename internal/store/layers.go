@@ -0,0 +1,147 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"syscall"
+)
+
+var digestPattern = regexp.MustCompile(`^sha256:[0-9a-f]{64}$`)
+
+// Directory of extracted images, created on demand.
+func (self Store) LayerBase() string {
+	return filepath.Join(self.base, "layers")
+}
+
+// Returns the directory of the layer with the given digest
+// (sha256:<hex>) of the image it was extracted from.
+func (self Store) LayerPath(digest string) (string, error) {
+	if !digestPattern.MatchString(digest) {
+		return "", fmt.Errorf("store: invalid layer digest %q", digest)
+	}
+	return filepath.Join(self.LayerBase(), strings.TrimPrefix(digest, "sha256:")), nil
+}
+
+// Creates the layer unless it already exists. extract is called
+// with a temporary directory that becomes the layer on success,
+// so incomplete layers are never visible.
+func (self Store) AddLayer(digest string, extract func(dir string) error) (path string, err error) {
+	path, err = self.LayerPath(digest)
+	if err != nil {
+		return
+	}
+	_, err = os.Stat(path)
+	if !os.IsNotExist(err) {
+		return
+	}
+
+	err = os.MkdirAll(self.LayerBase(), 0755)
+	if err != nil {
+		return
+	}
+	tmp, err := os.MkdirTemp(self.LayerBase(), ".tmp-")
+	if err != nil {
+		return
+	}
+	err = os.Chmod(tmp, 0755)
+	if err == nil {
+		err = extract(tmp)
+	}
+	if err == nil {
+		err = os.Rename(tmp, path)
+		if errors.Is(err, syscall.EEXIST) || errors.Is(err, syscall.ENOTEMPTY) {
+			// Extracted concurrently by someone else
+			err = nil
+		}
+	}
+	if _, statErr := os.Stat(tmp); statErr == nil {
+		err = errors.Join(err, RemoveAll(tmp))
+	}
+	return
+}
+
+// Returns the digests of all layers in the store.
+func (self Store) Layers() (digests []string, err error) {
+	entries, err := os.ReadDir(self.LayerBase())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	for _, entry := range entries {
+		digest := "sha256:" + entry.Name()
+		if entry.IsDir() && digestPattern.MatchString(digest) {
+			digests = append(digests, digest)
+		}
+	}
+	return
+}
+
+func (self Store) RemoveLayer(digest string) error {
+	path, err := self.LayerPath(digest)
+	if err != nil {
+		return err
+	}
+	return RemoveAll(path)
+}
+
+const (
+	// Kernel overlayfs mounted in the box’s user namespace
+	DriverOverlay = "overlay"
+	// A full copy of the layer (reflinked where supported)
+	DriverCopy = "copy"
+)
+
+// How the box file system is stored. Boxes created before layers
+// existed have no storage info and a fully extracted FileSystem.
+type Storage struct {
+	// Digest of the layer the box is based on
+	Layer  string `json:"layer"`
+	Driver string `json:"driver"`
+}
+
+// Returns the store containing the entry.
+func (self StoreEntry) Store() Store {
+	return Store{filepath.Dir(filepath.Dir(self.base))}
+}
+
+func (self StoreEntry) SetStorage(storage Storage) error {
+	return self.writeJSON("storage.json", storage)
+}
+
+// Returns an error satisfying os.IsNotExist for boxes without layer.
+func (self StoreEntry) GetStorage() (storage Storage, err error) {
+	err = self.readJSON("storage.json", &storage)
+	return
+}
+
+// Directories of overlay boxes holding the box’s changes
+// and overlayfs’ internal state.
+func (self StoreEntry) UpperDir() string {
+	return filepath.Join(self.base, "upper")
+}
+
+func (self StoreEntry) WorkDir() string {
+	return filepath.Join(self.base, "work")
+}
+
+// Like os.RemoveAll, but also removes directories without write or
+// search permission such as overlayfs’ work/work or read-only
+// directories from images, which is common when running rootless.
+func RemoveAll(path string) error {
+	err := os.RemoveAll(path)
+	if err == nil {
+		return nil
+	}
+	// WalkDir visits directories before reading them
+	_ = filepath.WalkDir(path, func(path string, entry fs.DirEntry, err error) error {
+		if err == nil && entry.IsDir() {
+			_ = os.Chmod(path, 0700)
+		}
+		return nil
+	})
+	return os.RemoveAll(path)
+}
@@ -1,12 +1,16 @@
 package store
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
+	"net/url"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strconv"
 	"strings"
+	"time"
 )
 
 type Store struct{ base string }
@@ -29,26 +33,111 @@ func (self Store) ImageBase() string {
 	return filepath.Join(self.base, "images")
 }
 
+// Unfinished downloads of images.
+func (self Store) DownloadBase() string {
+	return filepath.Join(self.base, "downloads")
+}
+
+// File system snapshots of image build steps.
+func (self Store) BuildCacheBase() string {
+	return filepath.Join(self.base, "build-cache")
+}
+
+// Returned by NewEntry if a box of that name exists.
+var ErrNameConflict = errors.New("store: foxbox name already in use")
+
+// Longest box name, which is the limit of hostnames as well.
+const MaxNameLength = 63
+
+var namePattern = regexp.MustCompile(`^[a-zA-Z0-9]([a-zA-Z0-9-]*[a-zA-Z0-9])?$`)
+
+// Checks that name can be used as box name. Names are valid hostnames
+// and cgroup directory names: letters, digits and inner hyphens.
+func ValidateName(name string) error {
+	if len(name) > MaxNameLength || !namePattern.MatchString(name) {
+		return fmt.Errorf("store: invalid foxbox name %q: use up to %d letters, digits and hyphens, starting and ending with a letter or digit", name, MaxNameLength)
+	}
+	return nil
+}
+
+// Returned by GetEntry if a prefix matches more than one box.
+type AmbiguousNameError struct {
+	Prefix     string
+	Candidates []string
+}
+
+func (self *AmbiguousNameError) Error() string {
+	return fmt.Sprintf("store: %q matches more than one foxbox: %s", self.Prefix, strings.Join(self.Candidates, ", "))
+}
+
+var (
+	prefixPattern = regexp.MustCompile(`^[a-zA-Z0-9-]+$`)
+	// Of generated names like adorable-fox-1a2b3c4d
+	hexSuffixPattern = regexp.MustCompile(`-([0-9a-f]{8})$`)
+)
+
+// Returns the entry of the box with the given name or, if there is
+// none, of the only box whose name or hex suffix starts with it.
+// Prefixes matching more than one box fail with *AmbiguousNameError.
 func (self Store) GetEntry(name string) (*StoreEntry, error) {
-	name = sanitize(name)
-	if strings.TrimSpace(name) == "" {
-		return nil, errors.New("store: invalid foxbox name")
+	if len(name) > MaxNameLength || !prefixPattern.MatchString(name) {
+		return nil, fmt.Errorf("store: invalid foxbox name %q", name)
 	}
 	entry := &StoreEntry{filepath.Join(self.EntryBase(), name)}
 
 	_, err := os.Stat(entry.base)
-	if os.IsNotExist(err) || err != nil {
+	if os.IsNotExist(err) {
+		return self.findEntry(name, err)
+	}
+	if err != nil {
 		return nil, err
 	}
 
 	return entry, entry.init()
 }
 
+// Looks up a box by prefix, failing with notFound if none matches.
+func (self Store) findEntry(prefix string, notFound error) (*StoreEntry, error) {
+	dirs, err := os.ReadDir(self.EntryBase())
+	if err != nil {
+		return nil, err
+	}
+	var candidates []string
+	for _, dir := range dirs {
+		name := dir.Name()
+		if !dir.IsDir() {
+			continue
+		}
+		suffix := hexSuffixPattern.FindStringSubmatch(name)
+		if strings.HasPrefix(name, prefix) || (suffix != nil && strings.HasPrefix(suffix[1], prefix)) {
+			candidates = append(candidates, name)
+		}
+	}
+
+	switch len(candidates) {
+	case 0:
+		return nil, notFound
+	case 1:
+		entry := &StoreEntry{filepath.Join(self.EntryBase(), candidates[0])}
+		return entry, entry.init()
+	}
+	return nil, &AmbiguousNameError{prefix, candidates}
+}
+
+// Creates the entry of a new box, failing with ErrNameConflict
+// if a box of that name exists.
 func (self Store) NewEntry(name string) (*StoreEntry, error) {
-	entry := &StoreEntry{filepath.Join(self.EntryBase(), sanitize(name))}
+	err := ValidateName(name)
+	if err != nil {
+		return nil, err
+	}
+	entry := &StoreEntry{filepath.Join(self.EntryBase(), name)}
 
-	_, err := os.Stat(entry.base)
-	if os.IsExist(err) || !os.IsNotExist(err) {
+	err = os.Mkdir(entry.base, 0755)
+	if os.IsExist(err) {
+		return nil, fmt.Errorf("%w: %s", ErrNameConflict, name)
+	}
+	if err != nil {
 		return nil, err
 	}
 
@@ -56,13 +145,46 @@ func (self Store) NewEntry(name string) (*StoreEntry, error) {
 }
 
 func (self Store) GetImagePath(name string, gzip bool) string {
-	path := filepath.Join(self.ImageBase(), sanitize(name)) + ".tar"
+	path := filepath.Join(self.ImageBase(), imageFile(name)) + ".tar"
 	if gzip {
 		path = path + ".gz"
 	}
 	return path
 }
 
+// Metadata stored next to an image, e.g. its digest.
+func (self Store) GetImageMetaPath(name string) string {
+	return filepath.Join(self.ImageBase(), imageFile(name)) + ".json"
+}
+
+// Names of images pulled from OCI registries contain slashes,
+// e.g. docker.io/library/alpine:3.18, so they are escaped. So is
+// a leading dot, which keeps names like ".." inside the image directory.
+func imageFile(name string) string {
+	file := url.PathEscape(name)
+	if strings.HasPrefix(file, ".") {
+		file = "%2E" + file[1:]
+	}
+	return file
+}
+
+// Returns the name of the image stored in the given file
+// of the image directory or false if it is no image.
+func ImageName(file string) (string, bool) {
+	base, ok := strings.CutSuffix(file, ".tar")
+	if !ok {
+		base, ok = strings.CutSuffix(file, ".tar.gz")
+	}
+	if !ok {
+		return "", false
+	}
+	name, err := url.PathUnescape(base)
+	if err != nil {
+		return base, true
+	}
+	return name, true
+}
+
 type StoreEntry struct{ base string }
 
 func (self Store) init() error {
@@ -76,18 +198,58 @@ func (self StoreEntry) Base() string {
 	return self.base
 }
 
+// Returns the full name of the box, also when the
+// entry was looked up by prefix.
+func (self StoreEntry) Name() string {
+	return filepath.Base(self.base)
+}
+
 func (self StoreEntry) FileSystem() string {
 	return filepath.Join(self.base, "boxfs")
 }
 
+// Path of the box’s current log file, see package logfile.
+func (self StoreEntry) LogPath() string {
+	return filepath.Join(self.base, "box.log")
+}
+
 func (self StoreEntry) SetPID(pid int) error {
+	return self.writePID("container.pid", pid)
+}
+
+func (self StoreEntry) GetPID() (pid int, running bool, err error) {
+	return self.readPID("container.pid")
+}
+
+// Stores the pid of the slirp4netns process providing networking.
+func (self StoreEntry) SetSlirpPID(pid int) error {
+	return self.writePID("slirp.pid", pid)
+}
+
+func (self StoreEntry) GetSlirpPID() (pid int, running bool, err error) {
+	return self.readPID("slirp.pid")
+}
+
+// Removes stored pids, e.g. after the box process was stopped.
+func (self StoreEntry) ClearPIDs() error {
+	var errs []error
+	for _, file := range []string{"container.pid", "slirp.pid"} {
+		err := os.Remove(filepath.Join(self.Base(), file))
+		if err != nil && !os.IsNotExist(err) {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (self StoreEntry) writePID(file string, pid int) error {
 	str := strconv.Itoa(pid)
-	path := filepath.Join(self.Base(), "container.pid")
+	path := filepath.Join(self.Base(), file)
 	return os.WriteFile(path, []byte(str), 0644)
 }
 
-func (self StoreEntry) GetPID() (pid int, running bool, err error) {
-	path := filepath.Join(self.Base(), "container.pid")
+func (self StoreEntry) readPID(file string) (pid int, running bool, err error) {
+	path := filepath.Join(self.Base(), file)
 	b, err := os.ReadFile(path)
 	if err != nil {
 		return 0, false, err
@@ -107,14 +269,70 @@ func (self StoreEntry) GetPID() (pid int, running bool, err error) {
 	return pid, true, nil
 }
 
+// State of the most recent box process. FinishedAt is zero
+// while the process is still running.
+type RunState struct {
+	StartedAt  time.Time `json:"startedAt"`
+	FinishedAt time.Time `json:"finishedAt"`
+	ExitCode   int       `json:"exitCode"`
+	Signal     string    `json:"signal,omitempty"`
+}
+
+func (self RunState) Finished() bool {
+	return !self.FinishedAt.IsZero()
+}
+
+func (self StoreEntry) SetRunState(state RunState) error {
+	return self.writeJSON("state.json", state)
+}
+
+// Returns an error satisfying os.IsNotExist if the box has never run.
+func (self StoreEntry) GetRunState() (state RunState, err error) {
+	err = self.readJSON("state.json", &state)
+	return
+}
+
+// Stores the box metadata (config.json) as JSON.
+func (self StoreEntry) SetConfig(config any) error {
+	return self.writeJSON("config.json", config)
+}
+
+// Reads the box metadata into config. Returns an error
+// satisfying os.IsNotExist if no metadata was stored.
+func (self StoreEntry) GetConfig(config any) error {
+	return self.readJSON("config.json", config)
+}
+
+func (self StoreEntry) writeJSON(file string, v any) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(self.Base(), file), b, 0644)
+}
+
+func (self StoreEntry) readJSON(file string, v any) error {
+	b, err := os.ReadFile(filepath.Join(self.Base(), file))
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
 func (self StoreEntry) init() error {
 	return os.MkdirAll(self.FileSystem(), 0755)
 }
 
 func (self StoreEntry) Delete() error {
-	return os.RemoveAll(self.base)
+	return RemoveAll(self.base)
 }
 
-func sanitize(subpath string) string {
-	return strings.ReplaceAll(subpath, "/", "")
+// Writes to a temporary file first, so readers never see partial data.
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	tmp := path + ".tmp"
+	err := os.WriteFile(tmp, data, perm)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
 }
@@ -2,8 +2,10 @@ package store_test
 
 import (
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/codingpa-ws/foxbox/internal/store"
 	"github.com/stretchr/testify/require"
@@ -63,3 +65,152 @@ func TestNew(t *testing.T) {
 
 	assertDirContents(t, store.EntryBase(), []string{})
 }
+
+func TestEntryNames(t *testing.T) {
+	require := require.New(t)
+	boxStore, removeStore := mustStore(t)
+	defer removeStore()
+
+	for _, name := range []string{"ci-runner-1", "a", "Fox", strings.Repeat("x", store.MaxNameLength)} {
+		require.NoError(store.ValidateName(name), name)
+	}
+	for _, name := range []string{"", ".", "..", "-box", "box-", "ci runner", "box/..", "box_1", "box.1", "box\n", strings.Repeat("x", store.MaxNameLength+1)} {
+		require.Error(store.ValidateName(name), name)
+		_, err := boxStore.NewEntry(name)
+		require.Error(err, name)
+		_, err = boxStore.GetEntry(name)
+		require.Error(err, name)
+	}
+	assertDirContents(t, boxStore.EntryBase(), nil)
+
+	_, err := boxStore.NewEntry("ci-runner-1")
+	require.NoError(err)
+	_, err = boxStore.NewEntry("ci-runner-1")
+	require.ErrorIs(err, store.ErrNameConflict)
+}
+
+func TestEntryPrefixes(t *testing.T) {
+	require := require.New(t)
+	boxStore, removeStore := mustStore(t)
+	defer removeStore()
+
+	for _, name := range []string{"brave-fox-1a2b3c4d", "brave-owl-1a9f0e2d", "web", "web-2"} {
+		_, err := boxStore.NewEntry(name)
+		require.NoError(err)
+	}
+
+	for prefix, want := range map[string]string{
+		"brave-f":  "brave-fox-1a2b3c4d",
+		"1a2":      "brave-fox-1a2b3c4d",
+		"1a9f0e2d": "brave-owl-1a9f0e2d",
+		"web":      "web",
+		"web-":     "web-2",
+	} {
+		entry, err := boxStore.GetEntry(prefix)
+		require.NoError(err, prefix)
+		require.Equal(want, entry.Name(), prefix)
+	}
+
+	_, err := boxStore.GetEntry("1a")
+	var ambiguous *store.AmbiguousNameError
+	require.ErrorAs(err, &ambiguous)
+	require.Equal([]string{"brave-fox-1a2b3c4d", "brave-owl-1a9f0e2d"}, ambiguous.Candidates)
+	require.ErrorContains(err, "brave-fox-1a2b3c4d, brave-owl-1a9f0e2d")
+
+	_, err = boxStore.GetEntry("owl")
+	require.ErrorIs(err, os.ErrNotExist)
+	_, err = boxStore.GetEntry("b/..")
+	require.Error(err)
+}
+
+func TestRunState(t *testing.T) {
+	boxStore, removeStore := mustStore(t)
+	defer removeStore()
+
+	entry, err := boxStore.NewEntry("testbox")
+	require.NoError(t, err)
+
+	_, err = entry.GetRunState()
+	require.ErrorIs(t, err, os.ErrNotExist)
+
+	started := time.Now().Add(-time.Second).Round(0)
+	err = entry.SetRunState(store.RunState{StartedAt: started})
+	require.NoError(t, err)
+
+	state, err := entry.GetRunState()
+	require.NoError(t, err)
+	require.True(t, started.Equal(state.StartedAt))
+	require.False(t, state.Finished())
+
+	finished := time.Now().Round(0)
+	err = entry.SetRunState(store.RunState{
+		StartedAt:  started,
+		FinishedAt: finished,
+		ExitCode:   137,
+		Signal:     "SIGKILL",
+	})
+	require.NoError(t, err)
+
+	state, err = entry.GetRunState()
+	require.NoError(t, err)
+	require.True(t, state.Finished())
+	require.True(t, finished.Equal(state.FinishedAt))
+	require.Equal(t, 137, state.ExitCode)
+	require.Equal(t, "SIGKILL", state.Signal)
+}
+
+func TestLayers(t *testing.T) {
+	require := require.New(t)
+	boxStore, removeStore := mustStore(t)
+	defer removeStore()
+
+	digest := "sha256:" + strings.Repeat("ab", 32)
+	_, err := boxStore.LayerPath("sha256:../../etc")
+	require.Error(err)
+
+	extracted := 0
+	extract := func(dir string) error {
+		extracted++
+		// Read-only directories are common in images
+		require.NoError(os.Mkdir(filepath.Join(dir, "ro"), 0755))
+		require.NoError(os.WriteFile(filepath.Join(dir, "ro", "file"), nil, 0644))
+		return os.Chmod(filepath.Join(dir, "ro"), 0555)
+	}
+	path, err := boxStore.AddLayer(digest, extract)
+	require.NoError(err)
+	require.FileExists(filepath.Join(path, "ro", "file"))
+	_, err = boxStore.AddLayer(digest, extract)
+	require.NoError(err)
+	require.Equal(1, extracted, "existing layers must not be extracted again")
+
+	_, err = boxStore.AddLayer("sha256:"+strings.Repeat("cd", 32), func(dir string) error {
+		return os.ErrInvalid
+	})
+	require.ErrorIs(err, os.ErrInvalid)
+	assertDirContents(t, boxStore.LayerBase(), []string{strings.Repeat("ab", 32)})
+
+	layers, err := boxStore.Layers()
+	require.NoError(err)
+	require.Equal([]string{digest}, layers)
+
+	require.NoError(boxStore.RemoveLayer(digest))
+	assertDirContents(t, boxStore.LayerBase(), nil)
+}
+
+func TestImagePaths(t *testing.T) {
+	require := require.New(t)
+	boxStore, removeStore := mustStore(t)
+	defer removeStore()
+
+	for _, name := range []string{"alpine:3.18", "docker.io/library/alpine:3.18", "../escape", "..", ".", ".hidden"} {
+		path := boxStore.GetImagePath(name, true)
+		require.Equal(boxStore.ImageBase(), filepath.Dir(path), name)
+		parsed, ok := store.ImageName(filepath.Base(path))
+		require.True(ok)
+		require.Equal(name, parsed)
+		require.Equal(boxStore.ImageBase(), filepath.Dir(boxStore.GetImageMetaPath(name)), name)
+	}
+
+	_, ok := store.ImageName("alpine.json")
+	require.False(ok)
+}
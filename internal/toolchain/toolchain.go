@@ -0,0 +1,261 @@
+// Package toolchain reads the catalog of prebuilt toolchains described
+// by toolchains.schema.json in the repository root, which the install
+// instruction of Foxfiles unpacks into images.
+package toolchain
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/codingpa-ws/foxbox/internal/archive"
+	"github.com/codingpa-ws/foxbox/internal/registry"
+	"github.com/klauspost/compress/zstd"
+	"github.com/klauspost/pgzip"
+)
+
+// Used unless FOXBOX_TOOLCHAINS is set.
+const DefaultURL = "https://raw.githubusercontent.com/codingpa-ws/foxbox/main/toolchains.json"
+
+type Catalog struct {
+	Toolchains []Toolchain `json:"toolchains"`
+
+	// URL the catalog was fetched from, relative
+	// tarball URLs are resolved against it.
+	base *url.URL
+}
+
+type Toolchain struct {
+	Name     string    `json:"name"`
+	Versions []Version `json:"versions"`
+}
+
+type Version struct {
+	Version string `json:"version"`
+	Arch    string `json:"arch"`
+	URL     string `json:"url"`
+	SHA256  string `json:"sha256"`
+	// Absolute directory the tarball is unpacked to
+	Prefix string `json:"prefix"`
+	// Number of leading path components removed from the
+	// tarball’s entries, e.g. 1 for node-v20.1.0-linux-x64/
+	Strip int `json:"strip,omitempty"`
+	// Directories relative to the prefix that are added
+	// to PATH, defaults to bin.
+	Path []string `json:"path,omitempty"`
+}
+
+var sha256Pattern = regexp.MustCompile("^[0-9a-f]{64}$")
+
+// Returns FOXBOX_TOOLCHAINS or DefaultURL.
+func URL() string {
+	if catalog := os.Getenv("FOXBOX_TOOLCHAINS"); catalog != "" {
+		return catalog
+	}
+	return DefaultURL
+}
+
+// Splits a reference like node@20.1 into name and version.
+// Without version, the latest version is used.
+func ParseRef(ref string) (name, version string, err error) {
+	name, version, found := strings.Cut(ref, "@")
+	if name == "" || (found && version == "") || strings.ContainsAny(name, "/:") {
+		return "", "", fmt.Errorf("invalid toolchain %q: use name or name@version", ref)
+	}
+	return name, version, nil
+}
+
+// Loads the catalog from an http(s) or file URL.
+func Fetch(rawURL string) (*Catalog, error) {
+	base, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("parsing toolchain catalog url: %w", err)
+	}
+
+	body, err := registry.Open(base.String())
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	catalog := &Catalog{base: base}
+	err = json.NewDecoder(body).Decode(catalog)
+	if err != nil {
+		return nil, fmt.Errorf("decoding toolchain catalog %s: %w", rawURL, err)
+	}
+	return catalog, nil
+}
+
+// Finds the latest version of a toolchain for arch that matches
+// version, which may be a prefix like 20 or 20.1 of 20.1.0.
+func (self Catalog) Resolve(name, version, arch string) (*Version, error) {
+	var latest *Version
+	found := false
+	for _, toolchain := range self.Toolchains {
+		if toolchain.Name != name {
+			continue
+		}
+		found = true
+		for i, candidate := range toolchain.Versions {
+			matches := version == "" || candidate.Version == version ||
+				strings.HasPrefix(candidate.Version, version+".")
+			if candidate.Arch == arch && matches &&
+				(latest == nil || compareVersions(candidate.Version, latest.Version) > 0) {
+				latest = &toolchain.Versions[i]
+			}
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("toolchain %s not found in catalog", name)
+	}
+	if latest == nil {
+		return nil, fmt.Errorf("toolchain %s has no version %s for %s", name, version, arch)
+	}
+	if !sha256Pattern.MatchString(latest.SHA256) {
+		return nil, fmt.Errorf("toolchain %s@%s: invalid sha256 %q", name, latest.Version, latest.SHA256)
+	}
+	if !path.IsAbs(latest.Prefix) {
+		return nil, fmt.Errorf("toolchain %s@%s: prefix %q is not absolute", name, latest.Version, latest.Prefix)
+	}
+	return latest, nil
+}
+
+// Compares dot-separated versions numerically where possible.
+func compareVersions(a, b string) int {
+	partsA, partsB := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(partsA) && i < len(partsB); i++ {
+		numA, errA := strconv.Atoi(partsA[i])
+		numB, errB := strconv.Atoi(partsB[i])
+		switch {
+		case errA == nil && errB == nil && numA != numB:
+			return numA - numB
+		case (errA != nil || errB != nil) && partsA[i] != partsB[i]:
+			return strings.Compare(partsA[i], partsB[i])
+		}
+	}
+	return len(partsA) - len(partsB)
+}
+
+// Returns the absolute URL of the version’s tarball.
+func (self Catalog) TarballURL(version *Version) (string, error) {
+	ref, err := url.Parse(version.URL)
+	if err != nil {
+		return "", fmt.Errorf("parsing tarball url: %w", err)
+	}
+	if self.base != nil {
+		ref = self.base.ResolveReference(ref)
+	}
+	return ref.String(), nil
+}
+
+// Returns the absolute directories to add to PATH.
+func (self Version) PathDirs() []string {
+	dirs := self.Path
+	if len(dirs) == 0 {
+		dirs = []string{"bin"}
+	}
+	abs := make([]string, len(dirs))
+	for i, dir := range dirs {
+		abs[i] = path.Join(self.Prefix, dir)
+	}
+	return abs
+}
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// Unpacks the plain, gzip or zstd compressed tarball r
+// below the version’s prefix in root.
+func (self Version) Unpack(r io.Reader, root string) error {
+	buffered := bufio.NewReader(r)
+	magic, err := buffered.Peek(len(zstdMagic))
+	if err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+	r = buffered
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		gz, err := pgzip.NewReader(buffered)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		r = gz
+	case bytes.HasPrefix(magic, zstdMagic):
+		decoder, err := zstd.NewReader(buffered)
+		if err != nil {
+			return err
+		}
+		defer decoder.Close()
+		r = decoder
+	}
+
+	pr, pw := io.Pipe()
+	rewritten := make(chan error, 1)
+	go func() {
+		err := self.rewrite(r, pw)
+		pw.CloseWithError(err)
+		rewritten <- err
+	}()
+	err = archive.Extract(pr, root)
+	// Unblocks rewrite if extracting failed
+	pr.Close()
+	return errors.Join(err, <-rewritten)
+}
+
+// Moves the entries of the tarball below the prefix,
+// removing the leading components to strip.
+func (self Version) rewrite(r io.Reader, w io.Writer) error {
+	tr := tar.NewReader(r)
+	tw := tar.NewWriter(w)
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		name, ok := self.target(header.Name)
+		if !ok {
+			continue
+		}
+		header.Name = name
+		if header.Typeflag == tar.TypeLink {
+			header.Linkname, ok = self.target(header.Linkname)
+			if !ok {
+				continue
+			}
+		}
+		err = tw.WriteHeader(header)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(tw, tr)
+		if err != nil {
+			return err
+		}
+	}
+	return tw.Close()
+}
+
+func (self Version) target(name string) (string, bool) {
+	parts := strings.Split(strings.Trim(path.Clean("/"+name), "/"), "/")
+	if len(parts) <= self.Strip || parts[0] == "" {
+		return "", false
+	}
+	return path.Join(self.Prefix, path.Join(parts[self.Strip:]...)), true
+}
@@ -0,0 +1,76 @@
+package toolchain_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/codingpa-ws/foxbox/internal/toolchain"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolve(t *testing.T) {
+	require := require.New(t)
+	sha := strings.Repeat("a", 64)
+	catalog := toolchain.Catalog{Toolchains: []toolchain.Toolchain{{
+		Name: "node",
+		Versions: []toolchain.Version{
+			{Version: "20.1.0", Arch: "amd64", SHA256: sha, Prefix: "/opt/node"},
+			{Version: "20.10.0", Arch: "amd64", SHA256: sha, Prefix: "/opt/node"},
+			{Version: "20.1.1", Arch: "amd64", SHA256: sha, Prefix: "/opt/node"},
+			{Version: "20.1.2", Arch: "arm64", SHA256: sha, Prefix: "/opt/node"},
+			{Version: "21.0.0", Arch: "amd64", SHA256: sha, Prefix: "relative"},
+		},
+	}}}
+
+	for want, version := range map[string]string{
+		"20.1.1":  "20.1",
+		"20.10.0": "20",
+		"20.1.0":  "20.1.0",
+	} {
+		resolved, err := catalog.Resolve("node", version, "amd64")
+		require.NoError(err)
+		require.Equal(want, resolved.Version)
+	}
+
+	_, err := catalog.Resolve("ruby", "", "amd64")
+	require.ErrorContains(err, "not found")
+	_, err = catalog.Resolve("node", "20.2", "amd64")
+	require.ErrorContains(err, "no version")
+	_, err = catalog.Resolve("node", "", "amd64")
+	require.ErrorContains(err, "not absolute")
+
+	name, version, err := toolchain.ParseRef("node@20.1")
+	require.NoError(err)
+	require.Equal("node", name)
+	require.Equal("20.1", version)
+	_, _, err = toolchain.ParseRef("node@")
+	require.Error(err)
+}
+
+func TestUnpack(t *testing.T) {
+	require := require.New(t)
+	buf := new(bytes.Buffer)
+	tw := tar.NewWriter(buf)
+	require.NoError(tw.WriteHeader(&tar.Header{Name: "node-v20/", Typeflag: tar.TypeDir, Mode: 0755}))
+	require.NoError(tw.WriteHeader(&tar.Header{Name: "node-v20/bin/node", Typeflag: tar.TypeReg, Mode: 0755, Size: 4}))
+	_, err := tw.Write([]byte("node"))
+	require.NoError(err)
+	require.NoError(tw.WriteHeader(&tar.Header{Name: "node-v20/bin/nodejs", Typeflag: tar.TypeLink, Linkname: "node-v20/bin/node"}))
+	require.NoError(tw.WriteHeader(&tar.Header{Name: "../../escape", Typeflag: tar.TypeReg, Mode: 0644}))
+	require.NoError(tw.Close())
+
+	root := t.TempDir()
+	version := toolchain.Version{Prefix: "/usr/local/node", Strip: 1}
+	require.NoError(version.Unpack(buf, root))
+
+	content, err := os.ReadFile(filepath.Join(root, "usr", "local", "node", "bin", "nodejs"))
+	require.NoError(err)
+	require.Equal("node", string(content))
+	require.NoFileExists(filepath.Join(root, "escape"))
+	require.NoFileExists(filepath.Join(filepath.Dir(root), "escape"))
+	require.Equal([]string{"/usr/local/node/bin"}, version.PathDirs())
+}